@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/audit"
+	consulRegistry "github.com/x-cray/marathon-registrator/consul"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// printAudit prints audit trail entries selected by command filters.
+func printAudit(config *types.Config) {
+	filter := &audit.Filter{
+		Service:  *auditService,
+		Registry: *auditRegistry,
+		Action:   *auditAction,
+		Outcome:  *auditOutcome,
+	}
+	if *auditSince > 0 {
+		filter.Since = time.Now().Add(-*auditSince)
+	}
+
+	entries, err := audit.Query(auditSource(config), filter)
+	assert(err)
+
+	if *auditOutput == "json" {
+		printJSON(os.Stdout, entries)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tSERVICE\tREGISTRY\tTRIGGER\tREASON\tOUTCOME")
+	for _, entry := range entries {
+		trigger := entry.Trigger
+		if entry.EventType != "" {
+			trigger = fmt.Sprintf("%s (%s %s)", trigger, entry.EventType, entry.EventID)
+		}
+		outcome := entry.Outcome
+		if entry.Error != "" {
+			outcome = fmt.Sprintf("%s: %s", outcome, entry.Error)
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Time.Local().Format(time.RFC3339),
+			entry.Action,
+			entry.ServiceID,
+			entry.Registry,
+			trigger,
+			entry.Reason,
+			outcome,
+		)
+	}
+	w.Flush()
+}
+
+// auditSource returns the audit trail selected by --source.
+func auditSource(config *types.Config) audit.Source {
+	if *auditSourceName == "file" {
+		if *auditFile == "" {
+			log.Fatal("--audit-file is required to read audit trail from file")
+		}
+		return &audit.FileSource{Path: *auditFile}
+	}
+
+	if *auditConsulPrefix == "" {
+		log.Fatal("--audit-consul-prefix is required to read audit trail from Consul")
+	}
+	for _, registryConfig := range config.Registries {
+		if registryConfig.Type != "consul" {
+			continue
+		}
+
+		adapter, err := consulRegistry.New(registryConfig.URL, config.ConsulOptions, false)
+		assert(err)
+		return adapter.AuditSink(*auditConsulPrefix)
+	}
+
+	log.Fatal("No Consul registry is configured")
+	return nil
+}
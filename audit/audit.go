@@ -0,0 +1,160 @@
+// Package audit keeps append-only trail of registration changes, so that incident reviews could tell
+// when and why service was registered or removed.
+package audit
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// TriggerSync denotes change made to fix registry drift found by sync.
+	TriggerSync = "sync"
+
+	// TriggerEvent denotes change made in response to scheduler event.
+	TriggerEvent = "event"
+
+	// OutcomeSuccess denotes change applied to registry.
+	OutcomeSuccess = "success"
+
+	// OutcomeFailure denotes change registry failed to apply.
+	OutcomeFailure = "failure"
+
+	// OutcomeDryRun denotes change registry would apply if registrator was not running in dry run mode.
+	OutcomeDryRun = "dry-run"
+)
+
+// Entry describes a single registration change.
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Action        string    `json:"action"`
+	Registry      string    `json:"registry,omitempty"`
+	GroupID       string    `json:"groupId"`
+	ServiceID     string    `json:"serviceId"`
+	Name          string    `json:"name"`
+	IP            string    `json:"ip"`
+	Port          int       `json:"port"`
+	Trigger       string    `json:"trigger"`
+	EventType     string    `json:"eventType,omitempty"`
+	EventID       string    `json:"eventId,omitempty"`
+	Reason        string    `json:"reason"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	Outcome       string    `json:"outcome"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Sink stores audit entries.
+type Sink interface {
+	Write(entry *Entry) error
+}
+
+// Source reads stored audit entries.
+type Source interface {
+	Entries() ([]*Entry, error)
+}
+
+// Auditor writes entries to all sinks. Failure to write audit entry is logged and does not affect
+// registration. Methods of nil Auditor do nothing, so that audit may be disabled.
+type Auditor struct {
+	sinks []Sink
+	now   func() time.Time
+}
+
+// NewAuditor creates Auditor writing to sinks.
+func NewAuditor(sinks ...Sink) *Auditor {
+	return &Auditor{
+		sinks: sinks,
+		now:   time.Now,
+	}
+}
+
+// Record stamps entry with the current time and writes it to sinks.
+func (a *Auditor) Record(entry *Entry) {
+	if a == nil {
+		return
+	}
+
+	entry.Time = a.now().UTC()
+	for _, sink := range a.sinks {
+		if err := sink.Write(entry); err != nil {
+			log.WithFields(log.Fields{
+				"prefix":  "audit",
+				"service": entry.ServiceID,
+				"action":  entry.Action,
+				"err":     err,
+			}).Error("Failed to write audit entry")
+		}
+	}
+}
+
+// Close closes sinks holding any resources.
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, sink := range a.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Filter selects audit entries. Empty fields match any entry.
+type Filter struct {
+	// Part of service or group ID.
+	Service  string
+	Registry string
+	Action   string
+	Outcome  string
+	Since    time.Time
+}
+
+// Match tells whether entry is selected by filter.
+func (f *Filter) Match(entry *Entry) bool {
+	switch {
+	case f.Service != "" && !strings.Contains(entry.ServiceID, f.Service) && !strings.Contains(entry.GroupID, f.Service):
+		return false
+	case f.Registry != "" && entry.Registry != f.Registry:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	case f.Outcome != "" && entry.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	}
+	return true
+}
+
+// Query returns entries of source selected by filter ordered by time.
+func Query(source Source, filter *Filter) ([]*Entry, error) {
+	entries, err := source.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*Entry{}
+	for _, entry := range entries {
+		if filter.Match(entry) {
+			result = append(result, entry)
+		}
+	}
+	sort.Stable(entriesByTime(result))
+
+	return result, nil
+}
+
+type entriesByTime []*Entry
+
+func (e entriesByTime) Len() int           { return len(e) }
+func (e entriesByTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e entriesByTime) Less(i, j int) bool { return e[i].Time.Before(e[j].Time) }
@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAudit(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Audit Suite")
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(entry *Entry) error {
+	return errors.New("sink-error")
+}
+
+type entriesSource []*Entry
+
+func (s entriesSource) Entries() ([]*Entry, error) {
+	return s, nil
+}
+
+var _ = Describe("Audit", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "audit")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "audit.log")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Auditor", func() {
+		It("Should stamp entries and write them to all sinks despite failures", func() {
+			// Arrange.
+			sink, err := NewFileSink(path, 0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			auditor := NewAuditor(failingSink{}, sink)
+			auditor.now = func() time.Time { return time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC) }
+
+			// Act.
+			auditor.Record(&Entry{Action: "register", ServiceID: "web_app.1:31000", Outcome: OutcomeSuccess})
+			closeErr := auditor.Close()
+			entries, err := (&FileSource{Path: path}).Entries()
+
+			// Assert.
+			Ω(closeErr).ShouldNot(HaveOccurred())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(HaveLen(1))
+			Ω(entries[0].Time).Should(Equal(time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)))
+			Ω(entries[0].ServiceID).Should(Equal("web_app.1:31000"))
+		})
+
+		It("Should do nothing when disabled", func() {
+			// Arrange.
+			var auditor *Auditor
+
+			// Act.
+			auditor.Record(&Entry{Action: "register"})
+			err := auditor.Close()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Describe("FileSink", func() {
+		It("Should rotate file keeping limited number of backups", func() {
+			// Arrange.
+			sink, err := NewFileSink(path, 100, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// Act.
+			for _, id := range []string{"app.1", "app.2", "app.3", "app.4"} {
+				Ω(sink.Write(&Entry{Action: "register", ServiceID: id})).Should(Succeed())
+			}
+			Ω(sink.Close()).Should(Succeed())
+			entries, err := (&FileSource{Path: path}).Entries()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(path + ".1").Should(BeAnExistingFile())
+			Ω(path + ".2").Should(BeAnExistingFile())
+			Ω(path + ".3").ShouldNot(BeAnExistingFile())
+			Ω(entries).Should(HaveLen(3))
+			Ω(entries[0].ServiceID).Should(Equal("app.2"))
+			Ω(entries[2].ServiceID).Should(Equal("app.4"))
+		})
+
+		It("Should require a backup to keep when rotation is enabled", func() {
+			// Act.
+			_, err := NewFileSink(path, 100, 0)
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+			Ω(path).ShouldNot(BeAnExistingFile())
+		})
+
+		It("Should append to existing file", func() {
+			// Arrange.
+			first, err := NewFileSink(path, 0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(first.Write(&Entry{ServiceID: "app.1"})).Should(Succeed())
+			Ω(first.Close()).Should(Succeed())
+
+			// Act.
+			second, err := NewFileSink(path, 0, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(second.Write(&Entry{ServiceID: "app.2"})).Should(Succeed())
+			Ω(second.Close()).Should(Succeed())
+			entries, err := (&FileSource{Path: path}).Entries()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(HaveLen(2))
+		})
+	})
+
+	Describe("FileSource", func() {
+		It("Should report malformed line", func() {
+			// Arrange.
+			Ω(ioutil.WriteFile(path, []byte("{}\nnot-json\n"), 0644)).Should(Succeed())
+
+			// Act.
+			_, err := (&FileSource{Path: path}).Entries()
+
+			// Assert.
+			Ω(err).Should(MatchError(HavePrefix(path + ":2:")))
+		})
+	})
+
+	Describe("Query()", func() {
+		It("Should return entries selected by filter ordered by time", func() {
+			// Arrange.
+			now := time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)
+			source := entriesSource{
+				{Time: now.Add(time.Minute), Action: "deregister", GroupID: "web_app.1", ServiceID: "web_app.1:31000", Outcome: OutcomeSuccess},
+				{Time: now, Action: "register", GroupID: "web_app.1", ServiceID: "web_app.1:31000", Outcome: OutcomeSuccess},
+				{Time: now.Add(-time.Hour), Action: "register", GroupID: "web_app.1", ServiceID: "web_app.1:31000", Outcome: OutcomeSuccess},
+				{Time: now, Action: "register", GroupID: "db.1", ServiceID: "db.1:27017", Outcome: OutcomeFailure},
+			}
+
+			// Act.
+			entries, err := Query(source, &Filter{Service: "web_app", Since: now})
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(Equal([]*Entry{source[1], source[0]}))
+		})
+
+		It("Should filter by registry, action and outcome", func() {
+			// Arrange.
+			source := entriesSource{
+				{Action: "register", Registry: "consul://127.0.0.1:8500", Outcome: OutcomeFailure},
+				{Action: "register", Registry: "consul://127.0.0.1:8500", Outcome: OutcomeSuccess},
+				{Action: "deregister", Registry: "consul://127.0.0.1:8500", Outcome: OutcomeFailure},
+				{Action: "register", Registry: "consul://127.0.0.2:8500", Outcome: OutcomeFailure},
+			}
+
+			// Act.
+			entries, err := Query(source, &Filter{Registry: "consul://127.0.0.1:8500", Action: "register", Outcome: OutcomeFailure})
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(Equal([]*Entry{source[0]}))
+		})
+	})
+})
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink appends entries to file in JSON lines format. When file grows over maxSize it is rotated:
+// path is renamed to path.1, path.1 to path.2 and so on, keeping at most maxBackups rotated files.
+type FileSink struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink opens file at path for appending. Zero maxSize disables rotation, otherwise at least
+// one backup must be kept, so that rotation never discards entries just written.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize > 0 && maxBackups < 1 {
+		return nil, errors.New("Audit file rotation requires at least one backup to keep")
+	}
+
+	sink := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write appends entry to the file rotating it beforehand if needed.
+func (s *FileSink) Write(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := s.file.Write(line)
+	s.size += int64(written)
+	return err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(backupPath(s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i > 0; i-- {
+		os.Rename(backupPath(s.path, i), backupPath(s.path, i+1))
+	}
+	if err := os.Rename(s.path, backupPath(s.path, 1)); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+func backupPath(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+// FileSource reads entries written by FileSink from file at path and its rotated backups.
+type FileSource struct {
+	Path string
+}
+
+// Entries returns entries of rotated backups, oldest first, followed by entries of the current file.
+func (s *FileSource) Entries() ([]*Entry, error) {
+	var paths []string
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backupPath(s.Path, i)); err != nil {
+			break
+		}
+		paths = append([]string{backupPath(s.Path, i)}, paths...)
+	}
+	paths = append(paths, s.Path)
+
+	var result []*Entry
+	for _, path := range paths {
+		entries, err := readEntries(path)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entries...)
+	}
+
+	return result, nil
+}
+
+func readEntries(path string) ([]*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var result []*Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		result = append(result, entry)
+	}
+
+	return result, scanner.Err()
+}
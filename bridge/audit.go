@@ -0,0 +1,87 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+
+	"github.com/x-cray/marathon-registrator/audit"
+	"github.com/x-cray/marathon-registrator/consul"
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// newAuditor creates auditor writing to audit file and, if KV prefix is set, to KV of the first Consul registry.
+func newAuditor(options *types.AuditOptions, registries []*Registry) (*audit.Auditor, error) {
+	var sinks []audit.Sink
+	if options.File != "" {
+		sink, err := audit.NewFileSink(options.File, options.MaxSize, options.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if options.ConsulPrefix != "" {
+		var sink audit.Sink
+		for _, registry := range registries {
+			if adapter, ok := registry.Adapter.(*consul.Adapter); ok {
+				sink = adapter.AuditSink(options.ConsulPrefix)
+				break
+			}
+		}
+		if sink == nil {
+			return nil, errors.New("Audit Consul prefix requires Consul registry")
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return audit.NewAuditor(sinks...), nil
+}
+
+// auditPlanEntry records change made by sync to fix registry drift described by plan entry.
+func (b *Bridge) auditPlanEntry(ctx context.Context, registry *Registry, entry *PlanEntry, err error) {
+	b.auditor.Record(b.newAuditEntry(ctx, registry, &audit.Entry{
+		Action:    string(entry.Action),
+		GroupID:   entry.GroupID,
+		ServiceID: entry.ServiceID,
+		Name:      entry.Name,
+		IP:        entry.IP,
+		Port:      entry.Port,
+		Trigger:   audit.TriggerSync,
+		Reason:    entry.Reason,
+	}, err))
+}
+
+// auditEvent records change of each group service made in response to scheduler event.
+func (b *Bridge) auditEvent(ctx context.Context, registry *Registry, action PlanAction, group *types.ServiceGroup, event *types.ServiceEvent, reason string, err error) {
+	for _, service := range group.Services {
+		b.auditor.Record(b.newAuditEntry(ctx, registry, &audit.Entry{
+			Action:    string(action),
+			GroupID:   group.ID,
+			ServiceID: service.ID,
+			Name:      service.Name,
+			IP:        group.IP,
+			Port:      service.ExposedPort,
+			Trigger:   audit.TriggerEvent,
+			EventType: event.EventType,
+			EventID:   event.EventID,
+			Reason:    reason,
+		}, err))
+	}
+}
+
+// newAuditEntry completes entry with registry, correlation ID and outcome of the change. Changes are
+// never applied in dry run mode, so they are recorded with the dry-run outcome unless they fail.
+func (b *Bridge) newAuditEntry(ctx context.Context, registry *Registry, entry *audit.Entry, err error) *audit.Entry {
+	entry.Registry = registry.Name
+	entry.CorrelationID = types.CorrelationID(ctx)
+	switch {
+	case err != nil:
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	case b.config.DryRun:
+		entry.Outcome = audit.OutcomeDryRun
+	default:
+		entry.Outcome = audit.OutcomeSuccess
+	}
+	return entry
+}
@@ -0,0 +1,187 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/x-cray/marathon-registrator/audit"
+	"github.com/x-cray/marathon-registrator/memory"
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// auditTrail is the audit sink keeping entries in memory.
+type auditTrail struct {
+	lock    sync.Mutex
+	entries []audit.Entry
+}
+
+func (t *auditTrail) Write(entry *audit.Entry) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.entries = append(t.entries, *entry)
+	return nil
+}
+
+func (t *auditTrail) Entries() []audit.Entry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]audit.Entry(nil), t.entries...)
+}
+
+// rejectingRegistry is the registry failing to register services.
+type rejectingRegistry struct {
+	*memory.Registry
+}
+
+func (r rejectingRegistry) RegisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	return errors.New("registry-error")
+}
+
+var _ = Describe("Bridge audit", func() {
+	var (
+		scheduler *memory.Scheduler
+		registry  *memory.Registry
+		trail     *auditTrail
+		bridge    *Bridge
+	)
+
+	webGroup := func() *types.ServiceGroup {
+		return &types.ServiceGroup{
+			ID: "web_app.1",
+			IP: localIP,
+			Services: []*types.Service{
+				{ID: "web_app.1:31000", Name: "web-app", ExposedPort: 31000, Healthy: true},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		scheduler = memory.NewScheduler()
+		registry = memory.NewRegistry(localIP)
+		trail = &auditTrail{}
+		bridge = NewFromAdapters(
+			&types.Config{},
+			[]*Scheduler{{Name: "marathon", Adapter: scheduler}},
+			[]*Registry{{Name: "memory", Adapter: registry}},
+		)
+		bridge.auditor = audit.NewAuditor(trail)
+	})
+
+	It("Should record changes made by sync along with their reasons", func() {
+		// Arrange.
+		scheduler.Start(webGroup())
+		registry.Register(&types.ServiceGroup{
+			ID:       "gone_app.1",
+			IP:       localIP,
+			Services: []*types.Service{{ID: "gone_app.1:31001", Name: "gone-app", ExposedPort: 31001}},
+		})
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		entries := trail.Entries()
+		Ω(entries).Should(HaveLen(2))
+		Ω(entries[0].Action).Should(Equal("register"))
+		Ω(entries[0].ServiceID).Should(Equal("web_app.1:31000"))
+		Ω(entries[0].Reason).Should(Equal("service is absent from registry"))
+		Ω(entries[1].Action).Should(Equal("deregister"))
+		Ω(entries[1].ServiceID).Should(Equal("gone_app.1:31001"))
+		Ω(entries[1].Reason).Should(Equal("service is absent from scheduler"))
+		for _, entry := range entries {
+			Ω(entry.Trigger).Should(Equal(audit.TriggerSync))
+			Ω(entry.Registry).Should(Equal("memory"))
+			Ω(entry.Outcome).Should(Equal(audit.OutcomeSuccess))
+			Ω(entry.CorrelationID).Should(Equal(entries[0].CorrelationID))
+			Ω(entry.Time.IsZero()).Should(BeFalse())
+		}
+	})
+
+	It("Should record failed changes with their errors", func() {
+		// Arrange.
+		scheduler.Start(webGroup())
+		bridge.registries[0].Adapter = rejectingRegistry{registry}
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).Should(HaveOccurred())
+		entries := trail.Entries()
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].Action).Should(Equal("register"))
+		Ω(entries[0].Outcome).Should(Equal(audit.OutcomeFailure))
+		Ω(entries[0].Error).Should(Equal("registry-error"))
+	})
+
+	It("Should record changes not applied in dry run mode", func() {
+		// Arrange.
+		bridge.config.DryRun = true
+		scheduler.Start(webGroup())
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		entries := trail.Entries()
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].Outcome).Should(Equal(audit.OutcomeDryRun))
+	})
+
+	It("Should record changes made in response to scheduler events with event ID", func() {
+		// Arrange.
+		scheduler.Start(webGroup())
+		Ω(bridge.ProcessEvent(&types.ServiceEvent{ServiceID: "web_app.1", IP: localIP, Action: types.ServiceStarted})).Should(Succeed())
+
+		// Act.
+		err := bridge.ProcessEvent(&types.ServiceEvent{
+			ServiceID: "web_app.1",
+			IP:        localIP,
+			Action:    types.ServiceStopped,
+			EventType: "status_update_event",
+			EventID:   "2016-03-01T10:00:00.000Z",
+		})
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		entries := trail.Entries()
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].Action).Should(Equal("deregister"))
+		Ω(entries[0].GroupID).Should(Equal("web_app.1"))
+		Ω(entries[0].ServiceID).Should(Equal("web_app.1:31000"))
+		Ω(entries[0].Trigger).Should(Equal(audit.TriggerEvent))
+		Ω(entries[0].EventType).Should(Equal("status_update_event"))
+		Ω(entries[0].EventID).Should(Equal("2016-03-01T10:00:00.000Z"))
+		Ω(entries[0].Reason).Should(Equal("service stopped"))
+		Ω(entries[0].CorrelationID).ShouldNot(BeEmpty())
+	})
+
+	It("Should not record anything when audit is disabled", func() {
+		// Arrange.
+		bridge.auditor = nil
+		scheduler.Start(webGroup())
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(registry.Services()).Should(HaveLen(1))
+	})
+
+	Describe("newAuditor()", func() {
+		It("Should require Consul registry to keep audit trail in KV", func() {
+			// Act.
+			_, err := newAuditor(&types.AuditOptions{ConsulPrefix: "registrator/audit"}, bridge.registries)
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("requires Consul registry")))
+		})
+	})
+})
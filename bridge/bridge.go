@@ -1,13 +1,27 @@
 package bridge
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/x-cray/marathon-registrator/consul"
-	"github.com/x-cray/marathon-registrator/marathon"
+	"github.com/x-cray/marathon-registrator/audit"
+	"github.com/x-cray/marathon-registrator/chaos"
+	"github.com/x-cray/marathon-registrator/recorder"
+	"github.com/x-cray/marathon-registrator/tracing"
 	"github.com/x-cray/marathon-registrator/types"
 
 	log "github.com/Sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// Delay between retries of failed registry sync.
+	registryRetryInterval = time.Second
 )
 
 type serviceGroupPair struct {
@@ -16,31 +30,187 @@ type serviceGroupPair struct {
 }
 
 type Bridge struct {
+	// Guards scheduler services cache. Registries are synchronized with their own locks.
 	sync.Mutex
 
-	scheduler              types.SchedulerAdapter
+	schedulers             []*Scheduler
 	schedulerServiceGroups map[string]*types.ServiceGroup
-	registry               types.RegistryAdapter
-	registryAdvertiseAddr  string
+	registries             []*Registry
 	config                 *types.Config
+
+	// Scheduler events multiplexed from all schedulers.
+	events          types.EventsChannel
+	eventStreams    sync.WaitGroup
+	listening       map[*Scheduler]bool
+	closeEventsOnce sync.Once
+
+	// Recorder of scheduler events and services, when recording is enabled.
+	recorder *recorder.Recorder
+
+	// Audit trail of registration changes, nil when audit is disabled.
+	auditor *audit.Auditor
 }
 
 func New(c *types.Config) (*Bridge, error) {
-	marathon, err := marathon.New(c.Marathon)
-	if err != nil {
-		return nil, err
+	var registries []*Registry
+	for _, registryConfig := range c.Registries {
+		registry, err := NewRegistry(registryConfig, c)
+		if err != nil {
+			return nil, err
+		}
+		registries = append(registries, registry)
+	}
+	if len(registries) == 0 {
+		return nil, errors.New("No service registry is configured")
 	}
 
-	consul, err := consul.New(c.Consul, c.DryRun)
-	if err != nil {
-		return nil, err
+	// Audit sinks are created before fault injection since they need concrete registry adapters.
+	var auditor *audit.Auditor
+	if c.Audit != nil {
+		var err error
+		if auditor, err = newAuditor(c.Audit, registries); err != nil {
+			return nil, err
+		}
+	}
+	if c.RegistryChaos != nil {
+		for _, registry := range registries {
+			log.WithField("prefix", "bridge").Warnf("Injecting faults into registry %s", registry.Name)
+			registry.Adapter = chaos.WrapRegistry(registry.Adapter, c.RegistryChaos)
+		}
+	}
+
+	var rec *recorder.Recorder
+	if c.RecordEvents != "" {
+		var err error
+		if rec, err = recorder.Create(c.RecordEvents); err != nil {
+			return nil, err
+		}
+	}
+
+	var schedulers []*Scheduler
+	for _, schedulerConfig := range c.Schedulers {
+		scheduler, err := NewScheduler(schedulerConfig, c, registries[0].Adapter)
+		if err != nil {
+			if rec != nil {
+				rec.Close()
+			}
+			return nil, err
+		}
+		// Schedulers are recorded before fault injection, so that recording holds what they actually reported.
+		if rec != nil {
+			scheduler.Adapter = rec.Wrap(scheduler.Name, scheduler.Adapter)
+		}
+		if c.SchedulerChaos != nil {
+			log.WithField("prefix", "bridge").Warnf("Injecting faults into scheduler %s", scheduler.Name)
+			scheduler.Adapter = chaos.WrapScheduler(scheduler.Adapter, c.SchedulerChaos)
+		}
+		schedulers = append(schedulers, scheduler)
+	}
+
+	if rec != nil && c.RecordSnapshotInterval > 0 {
+		rec.SnapshotEvery(c.RecordSnapshotInterval)
 	}
 
+	b := NewFromAdapters(c, schedulers, registries)
+	b.recorder = rec
+	b.auditor = auditor
+
+	return b, nil
+}
+
+// NewFromAdapters creates Bridge syncing already created schedulers to registries.
+func NewFromAdapters(c *types.Config, schedulers []*Scheduler, registries []*Registry) *Bridge {
 	return &Bridge{
-		config:    c,
-		scheduler: marathon,
-		registry:  consul,
-	}, nil
+		config:     c,
+		schedulers: schedulers,
+		registries: registries,
+	}
+}
+
+// Ping checks whether service registries are reachable and usable. Unavailable registries are reported and
+// skipped, error is returned only when none of the registries are available.
+func (b *Bridge) Ping() error {
+	ctx, span := tracing.Start(context.Background(), "bridge.Ping")
+	var firstErr error
+	available := 0
+	for _, registry := range b.registries {
+		registryCtx, registrySpan := tracing.Start(ctx, "registry.Ping", attribute.String("registry", registry.Name))
+		err := types.PingContext(registryCtx, registry.Adapter)
+		tracing.End(registrySpan, err)
+		if err == nil {
+			available++
+			continue
+		}
+
+		if firstErr == nil {
+			firstErr = registry.wrap(err)
+		}
+		log.WithFields(log.Fields{
+			"prefix":   "bridge",
+			"registry": registry.Name,
+			"err":      err,
+		}).Error("Service registry is not available")
+	}
+
+	if available == 0 {
+		tracing.End(span, firstErr)
+		return firstErr
+	}
+
+	tracing.End(span, nil)
+	return nil
+}
+
+// Close releases resources held by schedulers and registries, i.e. removes Marathon callback subscriptions
+// or stops watching Consul ACL token file, and stops recording and audit.
+func (b *Bridge) Close() error {
+	var firstErr error
+	if b.recorder != nil {
+		defer b.recorder.Close()
+	}
+	defer b.auditor.Close()
+	for _, scheduler := range b.schedulers {
+		closer, ok := scheduler.Adapter.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		if err := closer.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"prefix":    "bridge",
+				"scheduler": scheduler.Name,
+				"err":       err,
+			}).Error("Failed to close scheduler")
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	for _, registry := range b.registries {
+		if closer, ok := registry.Adapter.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+
+	return firstErr
+}
+
+// Stats returns sync metrics of all registries.
+func (b *Bridge) Stats() []RegistryStats {
+	var result []RegistryStats
+	for _, registry := range b.registries {
+		result = append(result, registry.Stats())
+	}
+	return result
+}
+
+// SchedulerStatus returns the state of all schedulers.
+func (b *Bridge) SchedulerStatus() []SchedulerStatus {
+	var result []SchedulerStatus
+	for _, scheduler := range b.schedulers {
+		result = append(result, scheduler.Status())
+	}
+	return result
 }
 
 func (b *Bridge) cachedServiceGroup(groupID, actionText string) *types.ServiceGroup {
@@ -64,88 +234,311 @@ func logSkipMessage(ip string) {
 	}).Debug("Skipping event due to unrelated service host")
 }
 
-func (b *Bridge) processServiceEvent(event *types.ServiceEvent) error {
-	b.Lock()
-	defer b.Unlock()
+func (b *Bridge) processServiceEvent(ctx context.Context, event *types.ServiceEvent) error {
+	if event.Action == types.ServiceResync {
+		// Scheduler might have missed some events, i.e. while reconnecting, perform full sync.
+		log.WithField("prefix", "bridge").WithFields(types.ContextFields(ctx)).Infof("Resyncing services: %v", event.OriginalEvent)
+		_, err := b.syncWithSummary(ctx)
+		return err
+	}
 
 	switch event.Action {
 	case types.ServiceStarted:
 		// New service is started, we need to refresh service cache.
-		_, err := b.refreshSchedulerServices()
+		b.refreshAdvertiseAddrs(ctx)
+		b.Lock()
+		defer b.Unlock()
+		_, err := b.refreshSchedulerServices(ctx)
 		if err != nil {
 			return err
 		}
 	case types.ServiceStopped:
 		// Service stopped, deregister and remove it from cache.
-		// Only consider services registered on current registry's advertized address.
-		if event.IP == b.registryAdvertiseAddr {
-			if group := b.cachedServiceGroup(event.ServiceID, "deregister"); group != nil {
-				b.registry.Deregister(group)
-				delete(b.schedulerServiceGroups, event.ServiceID)
+		b.Lock()
+		group := b.cachedServiceGroup(event.ServiceID, "deregister")
+		delete(b.schedulerServiceGroups, event.ServiceID)
+		b.Unlock()
+		if group == nil {
+			return nil
+		}
+
+		b.eachRegistry(func(registry *Registry) {
+			// Only consider services registered on current registry's advertized address.
+			if event.IP != registry.advertiseAddr {
+				logSkipMessage(event.IP)
+				return
 			}
-		} else {
-			logSkipMessage(event.IP)
+			err := registry.deregister(ctx, group)
+			if err != nil {
+				registry.logError(ctx, err, "Failed to deregister service")
+			}
+			b.auditEvent(ctx, registry, PlanDeregister, group, event, "service stopped", err)
+		})
+	case types.ServiceWentUp, types.ServiceWentDown:
+		// Service health changed, register it once it went up. Registries tracking readiness are updated
+		// either way, the others take unhealthy services out of rotation with their own health checks.
+		healthy := event.Action == types.ServiceWentUp
+		b.Lock()
+		group := b.cachedServiceGroup(event.ServiceID, "update health of")
+		if group != nil {
+			group = withHealth(group, healthy)
+			b.schedulerServiceGroups[event.ServiceID] = group
+		}
+		b.Unlock()
+		if group == nil {
+			return nil
 		}
-	case types.ServiceWentUp:
-		// Service went up, register it.
-		if group := b.cachedServiceGroup(event.ServiceID, "register"); group != nil {
+
+		b.eachRegistry(func(registry *Registry) {
+			if !healthy && !registry.tracksReadiness() {
+				return
+			}
 			// Only consider services registered on current registry's advertized address.
-			if group.IP == b.registryAdvertiseAddr {
-				b.registry.Register(group)
-			} else {
+			if group.IP != registry.advertiseAddr {
 				logSkipMessage(group.IP)
+				return
 			}
-		}
+			err := registry.register(ctx, group)
+			if err != nil {
+				registry.logError(ctx, err, "Failed to register service")
+			}
+			if healthy {
+				b.auditEvent(ctx, registry, PlanRegister, group, event, "service went up", err)
+			} else {
+				b.auditEvent(ctx, registry, PlanUpdate, group, event, "service went down", err)
+			}
+		})
 	}
 
 	return nil
 }
 
+// eachRegistry calls fn for all registries concurrently, each call serialized with other syncs and events
+// of the same registry.
+func (b *Bridge) eachRegistry(fn func(registry *Registry)) {
+	var wg sync.WaitGroup
+	for _, registry := range b.registries {
+		wg.Add(1)
+		go func(registry *Registry) {
+			defer wg.Done()
+			registry.syncLock.Lock()
+			defer registry.syncLock.Unlock()
+			fn(registry)
+		}(registry)
+	}
+	wg.Wait()
+}
+
+// ProcessSchedulerEvents listens for events of all schedulers and processes them until all event streams are closed.
+// It may be called again after failure to subscribe to some of the schedulers to retry the remaining ones.
 func (b *Bridge) ProcessSchedulerEvents() error {
-	schedulerEvents := make(types.EventsChannel, 5)
-	err := b.scheduler.ListenForEvents(schedulerEvents)
-	if err != nil {
-		return err
+	if b.events == nil {
+		b.events = make(types.EventsChannel, 5)
+		b.listening = make(map[*Scheduler]bool)
 	}
 
-	log.WithField("prefix", "bridge").Info("Registered for scheduler event stream")
+	for _, scheduler := range b.schedulers {
+		if b.listening[scheduler] {
+			continue
+		}
+
+		schedulerEvents := make(types.EventsChannel, 5)
+		err := scheduler.Adapter.ListenForEvents(schedulerEvents)
+		if err != nil {
+			return err
+		}
+
+		b.listening[scheduler] = true
+		b.eventStreams.Add(1)
+		go b.forwardEvents(scheduler, schedulerEvents)
+
+		log.WithFields(log.Fields{
+			"prefix":    "bridge",
+			"scheduler": scheduler.Name,
+		}).Info("Registered for scheduler event stream")
+	}
+
+	// All schedulers are subscribed at this point, so no more streams are added.
+	b.closeEventsOnce.Do(func() {
+		go func() {
+			b.eventStreams.Wait()
+			close(b.events)
+		}()
+	})
+
 	for {
-		event, more := <-schedulerEvents
+		event, more := <-b.events
 		if !more {
 			break
 		}
 
-		if event.Action != types.ServiceUnchanged {
-			log.WithFields(log.Fields{
-				"prefix":  "bridge",
-				"service": event.ServiceID,
-				"action":  event.Action,
-				"event":   event.OriginalEvent,
-			}).Debug("Received scheduler event")
-			err := b.processServiceEvent(event)
-			if err != nil {
-				log.WithField("prefix", "bridge").Errorf("Failed to process scheduler event: %v", err)
-			}
+		if err := b.ProcessEvent(event); err != nil {
+			log.WithField("prefix", "bridge").Errorf("Failed to process scheduler event: %v", err)
 		}
 	}
 
 	return nil
 }
 
-// Sync performs full synchronization of scheduler tasks to service registry.
+// ProcessEvent processes a single scheduler event. Log lines of the event processing, including ones
+// of registry adapters, share the same correlation ID.
+func (b *Bridge) ProcessEvent(event *types.ServiceEvent) error {
+	if event.Action == types.ServiceUnchanged {
+		return nil
+	}
+
+	ctx := types.WithCorrelationID(context.Background(), types.NewCorrelationID())
+	log.WithFields(log.Fields{
+		"prefix":  "bridge",
+		"service": event.ServiceID,
+		"action":  event.Action,
+		"event":   event.OriginalEvent,
+	}).WithFields(types.ContextFields(ctx)).Debug("Received scheduler event")
+
+	ctx, span := tracing.Start(ctx, "bridge.ProcessEvent",
+		attribute.String("service.id", event.ServiceID),
+		attribute.String("event.action", event.Action.String()),
+		attribute.String(types.CorrelationIDField, types.CorrelationID(ctx)),
+	)
+	err := b.processServiceEvent(ctx, event)
+	tracing.End(span, err)
+
+	return err
+}
+
+// forwardEvents copies events of a single scheduler to the multiplexed events channel.
+func (b *Bridge) forwardEvents(scheduler *Scheduler, schedulerEvents types.EventsChannel) {
+	defer b.eventStreams.Done()
+	for event := range schedulerEvents {
+		b.events <- event
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":    "bridge",
+		"scheduler": scheduler.Name,
+	}).Warn("Scheduler event stream closed")
+}
+
+// Sync performs full synchronization of scheduler tasks to service registries.
 func (b *Bridge) Sync() error {
-	b.Lock()
-	defer b.Unlock()
+	_, err := b.SyncWithSummary()
+	return err
+}
+
+// SyncWithSummary performs full synchronization of scheduler tasks to service registries and reports performed
+// actions summed up across registries. Registries are synchronized concurrently, each with its own retries, so
+// failure of one registry or some of the services does not prevent processing of the rest of them.
+func (b *Bridge) SyncWithSummary() (*SyncSummary, error) {
+	return b.syncWithSummary(types.WithCorrelationID(context.Background(), types.NewCorrelationID()))
+}
+
+// syncWithSummary performs full synchronization as part of the operation described by ctx. Scheduler
+// services are shared by registries, while each registry is planned and applied under its own lock.
+func (b *Bridge) syncWithSummary(ctx context.Context) (*SyncSummary, error) {
+	ctx, span := tracing.Start(ctx, "bridge.Sync", attribute.String(types.CorrelationIDField, types.CorrelationID(ctx)))
+	schedulerServices := b.lazySchedulerServices(ctx)
+	summaries := make([]*SyncSummary, len(b.registries))
+	var wg sync.WaitGroup
+	for i, registry := range b.registries {
+		wg.Add(1)
+		go func(i int, registry *Registry) {
+			defer wg.Done()
+			summaries[i], _ = b.syncRegistry(ctx, registry, schedulerServices)
+		}(i, registry)
+	}
+	wg.Wait()
+
+	summary := &SyncSummary{}
+	for i, registry := range b.registries {
+		summary.add(summaries[i], registry)
+	}
+	tracing.End(span, summary.err())
+
+	return summary, summary.err()
+}
+
+// syncRegistry synchronizes a single registry retrying failed attempts. Returned summary
+// sums up actions of all attempts and holds errors of the last one along with failures
+// of the last attempt which got to applying changes.
+func (b *Bridge) syncRegistry(ctx context.Context, registry *Registry, schedulerServices func() (map[string]*serviceGroupPair, error)) (*SyncSummary, error) {
+	ctx, span := tracing.Start(ctx, "bridge.syncRegistry", attribute.String("registry", registry.Name))
+	summary := &SyncSummary{}
+	var err error
+	attempt := 0
+	for ; ; attempt++ {
+		var attemptSummary *SyncSummary
+		attemptSummary, err = b.syncRegistryOnce(ctx, registry, schedulerServices)
+		if attemptSummary == nil {
+			summary.Errors = []error{err}
+		} else {
+			summary.Registered += attemptSummary.Registered
+			summary.Deregistered += attemptSummary.Deregistered
+			summary.Updated += attemptSummary.Updated
+			summary.Failed = attemptSummary.Failed
+			summary.Errors = attemptSummary.Errors
+		}
+		if err == nil || attempt >= registry.retries {
+			break
+		}
+
+		// Registry is not locked while waiting, so that events are still processed.
+		registry.logError(ctx, err, fmt.Sprintf("Failed to sync, retrying in %v (%d of %d)", registryRetryInterval, attempt+1, registry.retries))
+		time.Sleep(registryRetryInterval)
+	}
+
+	registry.recordSync(summary, attempt, err)
+	log.WithFields(log.Fields{
+		"prefix":   "bridge",
+		"registry": registry.Name,
+	}).WithFields(types.ContextFields(ctx)).Infof("Sync summary: %s", summary)
+	tracing.End(span, err)
+
+	return summary, err
+}
+
+// syncRegistryOnce plans and applies changes to the registry. Nil summary is returned when changes
+// could not be planned.
+func (b *Bridge) syncRegistryOnce(ctx context.Context, registry *Registry, schedulerServices func() (map[string]*serviceGroupPair, error)) (*SyncSummary, error) {
+	registry.syncLock.Lock()
+	defer registry.syncLock.Unlock()
+
+	plan, err := b.planRegistry(ctx, registry, schedulerServices)
+	if err != nil {
+		return nil, err
+	}
+	return b.apply(ctx, registry, plan)
+}
+
+// Plan computes actions required to synchronize scheduler tasks to each service registry without performing them.
+func (b *Bridge) Plan() ([]*Plan, error) {
+	schedulerServices := b.lazySchedulerServices(context.Background())
+	var plans []*Plan
+	for _, registry := range b.registries {
+		registry.syncLock.Lock()
+		plan, err := b.planRegistry(context.Background(), registry, schedulerServices)
+		registry.syncLock.Unlock()
+		if err != nil {
+			return nil, registry.wrap(err)
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
 
-	actionsPerformed := false
+func (b *Bridge) planRegistry(ctx context.Context, registry *Registry, schedulerServices func() (map[string]*serviceGroupPair, error)) (*Plan, error) {
+	plan := &Plan{Registry: registry.Name}
 
 	// Get services from registry.
-	registryServiceGroups, err := b.registry.Services()
+	registryServiceGroups, err := types.ServicesContext(ctx, registry.Adapter)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.WithField("prefix", "bridge").Infof("Received %d services from registry", len(registryServiceGroups))
+	log.WithFields(log.Fields{
+		"prefix":   "bridge",
+		"registry": registry.Name,
+	}).Infof("Received %d services from registry", len(registryServiceGroups))
 
 	// Build service:ip:port-indexed service map.
 	registryServicesMap := make(map[string]*serviceGroupPair)
@@ -158,24 +551,47 @@ func (b *Bridge) Sync() error {
 		}
 	}
 
-	schedulerServicesMap, err := b.refreshSchedulerServices()
+	if err := registry.refreshAdvertiseAddr(); err != nil {
+		return nil, err
+	}
+
+	schedulerServicesMap, err := schedulerServices()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Register scheduler services absent from registry.
+	// Register scheduler services absent from registry or having outdated definition in registry.
 	for _, schedulerService := range schedulerServicesMap {
 		group := schedulerService.group
 		service := schedulerService.service
 
+		// Only consider services registered on current registry's advertised address, healthy ones unless
+		// registry tracks readiness.
+		if reason := group.SkipReason(service, registry.advertiseAddr, registry.tracksReadiness()); reason != "" {
+			plan.Skipped = append(plan.Skipped, newPlanEntry(PlanSkip, schedulerService, reason))
+			continue
+		}
+
 		// If service is not yet registered we need to register it.
-		// Only consider healthy services registered on current registry's advertised address.
-		if group.IP == b.registryAdvertiseAddr && service.Healthy && registryServicesMap[group.ServiceKey(service)] == nil {
-			err := b.registry.Register(group)
-			if err != nil {
-				return err
-			}
-			actionsPerformed = true
+		registryService := registryServicesMap[group.ServiceKey(service)]
+		if registryService == nil {
+			plan.Register = append(plan.Register, newPlanEntry(PlanRegister, schedulerService, "service is absent from registry"))
+			continue
+		}
+
+		// If service definition has changed we need to register it again to update in place.
+		diff := serviceDiff(schedulerService, registryService, registry.tracksReadiness())
+		if len(diff) > 0 {
+			entry := newPlanEntry(PlanUpdate, schedulerService, "service definition has changed")
+			entry.Diff = diff
+			plan.Update = append(plan.Update, entry)
+
+			log.WithFields(log.Fields{
+				"prefix":   "bridge",
+				"registry": registry.Name,
+				"service":  service.ID,
+				"diff":     strings.Join(diff, "; "),
+			}).Debug("Service definition changed")
 		}
 	}
 
@@ -185,40 +601,128 @@ func (b *Bridge) Sync() error {
 		service := registryService.service
 
 		// If service is registered and we don't have it in scheduler we need to deregister it.
-		if schedulerServicesMap[group.ServiceKey(service)] == nil {
-			err := b.registry.Deregister(group)
-			if err != nil {
-				return err
-			}
-			actionsPerformed = true
+		// Services registered from other schedulers are left intact.
+		if schedulerServicesMap[group.ServiceKey(service)] == nil && b.owns(service) {
+			plan.Deregister = append(plan.Deregister, newPlanEntry(PlanDeregister, registryService, "service is absent from scheduler"))
 		}
 	}
 
-	if !actionsPerformed {
-		log.WithField("prefix", "bridge").Info("All services are in sync, no actions performed")
-	}
+	plan.sort()
 
-	return nil
+	return plan, nil
 }
 
-func (b *Bridge) refreshSchedulerServices() (map[string]*serviceGroupPair, error) {
-	log.WithField("prefix", "bridge").Info("Refreshing scheduler services")
+// apply performs actions from the plan on the registry.
+func (b *Bridge) apply(ctx context.Context, registry *Registry, plan *Plan) (*SyncSummary, error) {
+	summary := &SyncSummary{}
 
-	// Get registry's advertise address.
-	addr, err := b.registry.AdvertiseAddr()
-	if err != nil {
-		return nil, err
+	// Register each group once even if several of its services are out of sync.
+	groupErrors := make(map[string]error)
+	for _, entry := range append(plan.Register, plan.Update...) {
+		if err, registered := groupErrors[entry.group.ID]; registered {
+			b.auditPlanEntry(ctx, registry, entry, err)
+			continue
+		}
+
+		err := registry.register(ctx, entry.group)
+		groupErrors[entry.group.ID] = err
+		b.auditPlanEntry(ctx, registry, entry, err)
+		if err != nil {
+			summary.fail(entry, err)
+			continue
+		}
+
+		if entry.Action == PlanUpdate {
+			summary.Updated++
+		} else {
+			summary.Registered++
+		}
+	}
+
+	for _, entry := range plan.Deregister {
+		err := registry.deregister(ctx, entry.group)
+		b.auditPlanEntry(ctx, registry, entry, err)
+		if err != nil {
+			summary.fail(entry, err)
+			continue
+		}
+		summary.Deregistered++
 	}
 
-	b.registryAdvertiseAddr = addr
+	// Remove health checks left without services.
+	if cleaner, ok := registry.Adapter.(types.RegistryChecksCleaner); ok {
+		err := cleaner.CleanupDanglingChecks(ctx)
+		if err != nil {
+			summary.Errors = append(summary.Errors, err)
+		}
+	}
 
-	// Get services from scheduler.
-	schedulerServiceGroups, err := b.scheduler.Services()
-	if err != nil {
-		return nil, err
+	if !plan.HasDrift() {
+		log.WithFields(log.Fields{
+			"prefix":   "bridge",
+			"registry": registry.Name,
+		}).WithFields(types.ContextFields(ctx)).Info("All services are in sync, no actions performed")
+	}
+
+	return summary, summary.err()
+}
+
+// refreshAdvertiseAddrs updates advertise addresses of all registries. Registries failed to report
+// their address keep the previous one.
+func (b *Bridge) refreshAdvertiseAddrs(ctx context.Context) {
+	b.eachRegistry(func(registry *Registry) {
+		if err := registry.refreshAdvertiseAddr(); err != nil {
+			registry.logError(ctx, err, "Failed to get registry advertise address")
+		}
+	})
+}
+
+// lazySchedulerServices returns the function refreshing scheduler services until it succeeds once,
+// so that concurrently synchronized registries share the same scheduler services while retried
+// syncs may still recover from scheduler failure. Services are refreshed under bridge lock.
+func (b *Bridge) lazySchedulerServices(ctx context.Context) func() (map[string]*serviceGroupPair, error) {
+	var lock sync.Mutex
+	var servicesMap map[string]*serviceGroupPair
+	return func() (map[string]*serviceGroupPair, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if servicesMap != nil {
+			return servicesMap, nil
+		}
+		b.Lock()
+		result, err := b.refreshSchedulerServices(ctx)
+		b.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		servicesMap = result
+		return servicesMap, nil
 	}
+}
 
-	log.WithField("prefix", "bridge").Infof("Registry advertise address is %s", b.registryAdvertiseAddr)
+func (b *Bridge) refreshSchedulerServices(ctx context.Context) (map[string]*serviceGroupPair, error) {
+	log.WithField("prefix", "bridge").WithFields(types.ContextFields(ctx)).Info("Refreshing scheduler services")
+	ctx, span := tracing.Start(ctx, "bridge.refreshSchedulerServices")
+
+	// Get services from all schedulers.
+	var schedulerServiceGroups []*types.ServiceGroup
+	for _, scheduler := range b.schedulers {
+		schedulerCtx, schedulerSpan := tracing.Start(ctx, "scheduler.Services", attribute.String("scheduler", scheduler.Name))
+		groups, err := types.ServicesContext(schedulerCtx, scheduler.Adapter)
+		tracing.End(schedulerSpan, err)
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+
+		// Sources are only told apart with several schedulers, so that single scheduler setups keep
+		// registrations of earlier versions intact and do not expose bookkeeping metadata.
+		if scheduler.Name != "" && len(b.schedulers) > 1 {
+			tagSource(groups, scheduler.Name)
+		}
+		schedulerServiceGroups = append(schedulerServiceGroups, groups...)
+	}
 
 	// Build 2 maps of services:
 	// ServiceID-indexed and service:ip:port-indexed
@@ -238,6 +742,51 @@ func (b *Bridge) refreshSchedulerServices() (map[string]*serviceGroupPair, error
 		"Received %d services from scheduler",
 		len(schedulerServiceGroups),
 	)
+	span.SetAttributes(attribute.Int("service.groups", len(schedulerServiceGroups)))
+	tracing.End(span, nil)
 
 	return servicesMap, nil
 }
+
+// withHealth returns copy of the group with health of all services updated, since scheduler reports health
+// of the whole group. Cached group is not modified, as registries being synchronized may still refer to it.
+func withHealth(group *types.ServiceGroup, healthy bool) *types.ServiceGroup {
+	result := *group
+	result.Services = nil
+	for _, service := range group.Services {
+		copied := *service
+		copied.Healthy = healthy
+		result.Services = append(result.Services, &copied)
+	}
+	return &result
+}
+
+// tagSource marks services with the name of the scheduler they are registered from.
+func tagSource(groups []*types.ServiceGroup, source string) {
+	for _, group := range groups {
+		for _, service := range group.Services {
+			if service.Meta == nil {
+				service.Meta = make(map[string]string)
+			}
+			service.Meta[types.SourceMetaKey] = source
+		}
+	}
+}
+
+// owns tells whether registry service was registered from one of bridge schedulers. Services without
+// source are considered owned only when there is a single scheduler, since they were registered
+// before sources were tracked.
+func (b *Bridge) owns(service *types.Service) bool {
+	source := service.Source()
+	if source == "" {
+		return len(b.schedulers) == 1
+	}
+
+	for _, scheduler := range b.schedulers {
+		if scheduler.Name == source {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,255 @@
+package bridge
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/x-cray/marathon-registrator/kubernetes"
+	"github.com/x-cray/marathon-registrator/marathon"
+	"github.com/x-cray/marathon-registrator/marathon/marathontest"
+	"github.com/x-cray/marathon-registrator/memory"
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeRegistry keeps registered service groups in memory.
+type fakeRegistry struct {
+	sync.Mutex
+	groups map[string]*types.ServiceGroup
+}
+
+func (r *fakeRegistry) Services() ([]*types.ServiceGroup, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var result []*types.ServiceGroup
+	for _, group := range r.groups {
+		result = append(result, group)
+	}
+	return result, nil
+}
+
+func (r *fakeRegistry) Ping() error {
+	return nil
+}
+
+func (r *fakeRegistry) Register(group *types.ServiceGroup) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.groups[group.ID] = group
+	return nil
+}
+
+func (r *fakeRegistry) Deregister(group *types.ServiceGroup) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.groups, group.ID)
+	return nil
+}
+
+func (r *fakeRegistry) AdvertiseAddr() (string, error) {
+	return "127.0.0.1", nil
+}
+
+// registeredGroups returns sorted IDs of registered service groups.
+func (r *fakeRegistry) registeredGroups() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	result := []string{}
+	for id := range r.groups {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+var _ = Describe("Bridge with fake Marathon", func() {
+	var (
+		server   *marathontest.Server
+		registry *fakeRegistry
+		bridge   *Bridge
+	)
+
+	BeforeEach(func() {
+		server = marathontest.NewServer()
+		registry = &fakeRegistry{groups: make(map[string]*types.ServiceGroup)}
+		schedulerAdapter, err := marathon.New(server.URL, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		bridge = &Bridge{
+			schedulers: []*Scheduler{{Name: "marathon", Adapter: schedulerAdapter}},
+			registries: []*Registry{{Name: "fake", Adapter: registry}},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should sync deployed, scaled and health checked applications", func() {
+		// Arrange.
+		server.Deploy(marathontest.App{ID: "/web", Ports: []int{80}}, 2)
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(registry.registeredGroups()).Should(Equal([]string{"web.00000001", "web.00000002"}))
+
+		// Arrange.
+		server.Scale("/web", 1)
+		tasks := server.Deploy(marathontest.App{ID: "/db", Ports: []int{27017}, HealthChecked: true}, 1)
+
+		// Act.
+		err = bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(registry.registeredGroups()).Should(Equal([]string{"web.00000001"}))
+
+		// Arrange.
+		server.SetHealth(tasks[0].ID, true)
+
+		// Act.
+		err = bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(registry.registeredGroups()).Should(Equal([]string{"db.00000003", "web.00000001"}))
+	})
+
+	It("Should register and deregister services upon Marathon events", func() {
+		// Arrange.
+		server.Deploy(marathontest.App{ID: "/web", Ports: []int{80}}, 1)
+		Ω(bridge.Sync()).Should(Succeed())
+		go bridge.ProcessSchedulerEvents()
+		Eventually(server.Subscribers).Should(Equal(1))
+
+		// Act.
+		tasks := server.Deploy(marathontest.App{ID: "/db", Ports: []int{27017}, HealthChecked: true}, 1)
+		Eventually(func() bool {
+			// Wait for the task to be cached upon TASK_RUNNING event before it becomes healthy.
+			bridge.Lock()
+			defer bridge.Unlock()
+			return bridge.schedulerServiceGroups[tasks[0].ID] != nil
+		}).Should(BeTrue())
+		server.SetHealth(tasks[0].ID, true)
+
+		// Assert.
+		Eventually(registry.registeredGroups).Should(Equal([]string{"db.00000002", "web.00000001"}))
+
+		// Act.
+		server.KillTask("web.00000001")
+
+		// Assert.
+		Eventually(registry.registeredGroups).Should(Equal([]string{"db.00000002"}))
+	})
+})
+
+var _ = Describe("Bridge with fake Kubernetes", func() {
+	var (
+		scheduler *memory.Scheduler
+		client    *fake.Clientset
+		bridge    *Bridge
+	)
+
+	webGroup := func(healthy bool) *types.ServiceGroup {
+		return &types.ServiceGroup{
+			ID: "web_app.1",
+			IP: localIP,
+			Services: []*types.Service{
+				{ID: "web_app.1:31000", Name: "web-app", OriginalPort: 80, ExposedPort: 31000, Healthy: healthy},
+			},
+		}
+	}
+
+	// ready returns readiness of endpoints registered to Kubernetes.
+	ready := func() []bool {
+		list, err := client.DiscoveryV1().EndpointSlices("marathon").List(context.Background(), metav1.ListOptions{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		result := []bool{}
+		for _, slice := range list.Items {
+			for _, endpoint := range slice.Endpoints {
+				result = append(result, endpoint.Conditions.Ready != nil && *endpoint.Conditions.Ready)
+			}
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		scheduler = memory.NewScheduler()
+		client = fake.NewSimpleClientset()
+		bridge = NewFromAdapters(
+			&types.Config{},
+			[]*Scheduler{{Name: "marathon", Adapter: scheduler}},
+			[]*Registry{{Name: "kubernetes", Adapter: kubernetes.NewFromClient(client, "marathon", localIP, false)}},
+		)
+	})
+
+	AfterEach(func() {
+		scheduler.Close()
+	})
+
+	It("Should mark endpoint not ready once task goes unhealthy", func() {
+		// Arrange.
+		scheduler.Start(webGroup(true))
+		Ω(bridge.Sync()).Should(Succeed())
+		Ω(ready()).Should(Equal([]bool{true}))
+		events := make(types.EventsChannel, 1)
+		Ω(scheduler.ListenForEvents(events)).Should(Succeed())
+
+		// Act.
+		scheduler.SetHealthy("web_app.1", false)
+		err := bridge.ProcessEvent(<-events)
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ready()).Should(Equal([]bool{false}))
+
+		// Act.
+		err = bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ready()).Should(Equal([]bool{false}))
+
+		// Act.
+		scheduler.SetHealthy("web_app.1", true)
+		err = bridge.ProcessEvent(<-events)
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ready()).Should(Equal([]bool{true}))
+	})
+
+	It("Should sync readiness of endpoints", func() {
+		// Arrange.
+		scheduler.Start(webGroup(false))
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ready()).Should(Equal([]bool{false}))
+
+		// Arrange.
+		scheduler.SetHealthy("web_app.1", true)
+
+		// Act.
+		err = bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ready()).Should(Equal([]bool{true}))
+	})
+})
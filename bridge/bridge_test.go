@@ -1,6 +1,7 @@
 package bridge
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -40,8 +41,8 @@ var _ = Describe("Bridge", func() {
 			// Arrange.
 			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, errors.New("registry-error"))
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -56,8 +57,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
 			registryAdapter.EXPECT().AdvertiseAddr().Return("", errors.New("registry-error"))
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -73,8 +74,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
 			registryAdapter.EXPECT().AdvertiseAddr().Return("", nil)
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -95,8 +96,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -166,8 +167,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -232,8 +233,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -296,8 +297,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Register(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -360,8 +361,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Register(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -418,8 +419,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -472,8 +473,8 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -505,13 +506,752 @@ var _ = Describe("Bridge", func() {
 			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
 
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
 			bridge.Sync()
 		})
+
+		It("Should re-register service with definition changed in scheduler", func() {
+			// Arrange.
+			schedulerServices := []*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:         "db-server",
+							Tags:         []string{"primary"},
+							Healthy:      true,
+							OriginalPort: 27017,
+							ExposedPort:  31045,
+							HealthChecks: []*types.ServiceHealthCheck{
+								{ID: "tcp", TCP: "10.10.10.10:31045", Interval: "1m"},
+							},
+						},
+					},
+				},
+				{
+					ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+							Name:         "app-server",
+							Healthy:      true,
+							OriginalPort: 3000,
+							ExposedPort:  31046,
+							HealthChecks: []*types.ServiceHealthCheck{
+								{ID: "tcp", TCP: "10.10.10.10:31046", Interval: "1m"},
+							},
+						},
+					},
+				},
+			}
+			registryServices := []*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:        "db-server",
+							Tags:        []string{"secondary"},
+							ExposedPort: 31045,
+							HealthChecks: []*types.ServiceHealthCheck{
+								{ID: "tcp", TCP: "10.10.10.10:31045", Interval: "1m0s"},
+							},
+						},
+					},
+				},
+				{
+					ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+							Name:        "app-server",
+							ExposedPort: 31046,
+							Weights: &types.ServiceWeights{
+								Passing: 1,
+								Warning: 1,
+							},
+							HealthChecks: []*types.ServiceHealthCheck{
+								{ID: "tcp", TCP: "10.10.10.10:31046", Interval: "60s"},
+							},
+						},
+					},
+				},
+			}
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil)
+			registryAdapter.EXPECT().Services().Return(registryServices, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Register(gomock.Any()).Do(func(group *types.ServiceGroup) {
+				Ω(group.Services).Should(HaveLen(1))
+				service := group.Services[0]
+
+				Ω(service.ID).Should(Equal("db_server_2c033893-7993-11e5-8878-56847afe9799:27017"))
+				Ω(service.Tags).Should(Equal([]string{"primary"}))
+			}).Return(nil).Times(1)
+			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			err := bridge.Sync()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should continue sync and report failures when some services fail to register", func() {
+			// Arrange.
+			schedulerServices := []*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:         "db-server",
+							Healthy:      true,
+							OriginalPort: 27017,
+							ExposedPort:  31045,
+						},
+					},
+				},
+				{
+					ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+							Name:         "app-server",
+							Healthy:      true,
+							OriginalPort: 3000,
+							ExposedPort:  31046,
+						},
+					},
+				},
+			}
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Register(schedulerServices[0]).Return(errors.New("registry-error")).Times(1)
+			registryAdapter.EXPECT().Register(schedulerServices[1]).Return(nil).Times(1)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			summary, err := bridge.SyncWithSummary()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+			Ω(summary.Registered).Should(Equal(1))
+			Ω(summary.Failed).Should(Equal(1))
+		})
+
+		It("Should clean up dangling checks if registry supports it", func() {
+			// Arrange.
+			checksCleaner := types.NewMockRegistryChecksCleaner(mockCtrl)
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			checksCleaner.EXPECT().CleanupDanglingChecks(gomock.Any()).Return(nil).Times(1)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{
+					Adapter: &struct {
+						*types.MockRegistryAdapter
+						*types.MockRegistryChecksCleaner
+					}{registryAdapter, checksCleaner},
+				}},
+			}
+
+			// Act.
+			err := bridge.Sync()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should pass the same correlation ID to registry for all changes of a sync", func() {
+			// Arrange.
+			contextAdapter := types.NewMockContextRegistryAdapter(mockCtrl)
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{
+				{
+					ID: "web_app.1",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{ID: "web_app.1:80", Name: "web-app", Healthy: true, ExposedPort: 31000},
+					},
+				},
+			}, nil)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{
+				{
+					ID: "web_app.0",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{ID: "web_app.0:80", Name: "web-app", ExposedPort: 31001},
+					},
+				},
+			}, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			var registerID, deregisterID string
+			contextAdapter.EXPECT().RegisterContext(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, group *types.ServiceGroup) {
+				registerID = types.CorrelationID(ctx)
+			}).Return(nil)
+			contextAdapter.EXPECT().DeregisterContext(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, group *types.ServiceGroup) {
+				deregisterID = types.CorrelationID(ctx)
+			}).Return(nil)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{
+					Adapter: &struct {
+						*types.MockRegistryAdapter
+						*types.MockContextRegistryAdapter
+					}{registryAdapter, contextAdapter},
+				}},
+			}
+
+			// Act.
+			err := bridge.Sync()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(registerID).Should(HaveLen(16))
+			Ω(deregisterID).Should(Equal(registerID))
+		})
+
+		It("Should pass sync context to scheduler and registry listing services", func() {
+			// Arrange.
+			schedulerLister := types.NewMockContextServicesLister(mockCtrl)
+			registryLister := types.NewMockContextServicesLister(mockCtrl)
+			var schedulerID, registryID string
+			schedulerLister.EXPECT().ServicesContext(gomock.Any()).Do(func(ctx context.Context) {
+				schedulerID = types.CorrelationID(ctx)
+			}).Return([]*types.ServiceGroup{}, nil)
+			registryLister.EXPECT().ServicesContext(gomock.Any()).Do(func(ctx context.Context) {
+				registryID = types.CorrelationID(ctx)
+			}).Return([]*types.ServiceGroup{}, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil).AnyTimes()
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{
+					Adapter: &struct {
+						*types.MockSchedulerAdapter
+						*types.MockContextServicesLister
+					}{schedulerAdapter, schedulerLister},
+				}},
+				registries: []*Registry{{
+					Adapter: &struct {
+						*types.MockRegistryAdapter
+						*types.MockContextServicesLister
+					}{registryAdapter, registryLister},
+				}},
+			}
+
+			// Act.
+			err := bridge.Sync()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(registryID).Should(HaveLen(16))
+			Ω(schedulerID).Should(Equal(registryID))
+		})
+
+		It("Should merge services of multiple schedulers and tag them with scheduler name", func() {
+			// Arrange.
+			dockerAdapter := types.NewMockSchedulerAdapter(mockCtrl)
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:         "db-server",
+							Healthy:      true,
+							OriginalPort: 27017,
+							ExposedPort:  31045,
+						},
+					},
+				},
+			}, nil)
+			dockerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{
+				{
+					ID: "8dfafdbc3a40",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "8dfafdbc3a40:6379",
+							Name:         "redis",
+							Meta:         map[string]string{"owner": "cache-team"},
+							Healthy:      true,
+							OriginalPort: 6379,
+							ExposedPort:  32768,
+						},
+					},
+				},
+			}, nil)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+
+			var registered []*types.ServiceGroup
+			registryAdapter.EXPECT().Register(gomock.Any()).Do(func(group *types.ServiceGroup) {
+				registered = append(registered, group)
+			}).Return(nil).Times(2)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{
+					{Name: "marathon", Adapter: schedulerAdapter},
+					{Name: "docker", Adapter: dockerAdapter},
+				},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			err := bridge.Sync()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(registered).Should(HaveLen(2))
+			sources := map[string]map[string]string{}
+			for _, group := range registered {
+				sources[group.ID] = group.Services[0].Meta
+			}
+			Ω(sources).Should(Equal(map[string]map[string]string{
+				"db_server_2c033893-7993-11e5-8878-56847afe9799": {types.SourceMetaKey: "marathon"},
+				"8dfafdbc3a40": {types.SourceMetaKey: "docker", "owner": "cache-team"},
+			}))
+		})
+
+		It("Should not tag services of the single scheduler to keep registrations made before sources were tracked", func() {
+			// Arrange.
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:         "db-server",
+							Meta:         map[string]string{"owner": "db-team"},
+							Healthy:      true,
+							OriginalPort: 27017,
+							ExposedPort:  31045,
+						},
+					},
+				},
+			}, nil)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:        "db-server",
+							Meta:        map[string]string{"owner": "db-team"},
+							ExposedPort: 31045,
+						},
+					},
+				},
+			}, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Register(gomock.Any()).Times(0)
+			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Name: "marathon", Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			summary, err := bridge.SyncWithSummary()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.Registered + summary.Updated + summary.Deregistered).Should(Equal(0))
+		})
+
+		It("Should only deregister dangling services owned by its schedulers", func() {
+			// Arrange.
+			dockerAdapter := types.NewMockSchedulerAdapter(mockCtrl)
+			registryServices := []*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:        "db-server",
+							Meta:        map[string]string{types.SourceMetaKey: "marathon"},
+							ExposedPort: 31045,
+						},
+					},
+				},
+				{
+					ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+							Name:        "app-server",
+							Meta:        map[string]string{types.SourceMetaKey: "other-marathon"},
+							ExposedPort: 31046,
+						},
+					},
+				},
+				{
+					ID: "web_server_6a2f0a1c-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "web_server_6a2f0a1c-7b4b-11e5-b945-56847afe9799:80",
+							Name:        "web-server",
+							ExposedPort: 31047,
+						},
+					},
+				},
+			}
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			dockerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			registryAdapter.EXPECT().Services().Return(registryServices, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Deregister(registryServices[0]).Return(nil).Times(1)
+			registryAdapter.EXPECT().Deregister(registryServices[1]).Times(0)
+			registryAdapter.EXPECT().Deregister(registryServices[2]).Times(0)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{
+					{Name: "marathon", Adapter: schedulerAdapter},
+					{Name: "docker", Adapter: dockerAdapter},
+				},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			err := bridge.Sync()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Describe("Sync() with multiple registries", func() {
+		var (
+			otherRegistryAdapter *types.MockRegistryAdapter
+			schedulerServices    []*types.ServiceGroup
+		)
+
+		BeforeEach(func() {
+			registryRetryInterval = 0
+			otherRegistryAdapter = types.NewMockRegistryAdapter(mockCtrl)
+			schedulerServices = []*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:         "db-server",
+							Healthy:      true,
+							OriginalPort: 27017,
+							ExposedPort:  31045,
+						},
+					},
+				},
+			}
+		})
+
+		It("Should sync registries independently of each other's failures", func() {
+			// Arrange.
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil).Times(1)
+			registryAdapter.EXPECT().Services().Return(nil, errors.New("registry-error"))
+			otherRegistryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			otherRegistryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			otherRegistryAdapter.EXPECT().Register(schedulerServices[0]).Return(nil).Times(1)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{
+					{Name: "consul://old:8500", Adapter: registryAdapter},
+					{Name: "consul://new:8500", Adapter: otherRegistryAdapter},
+				},
+			}
+
+			// Act.
+			summary, err := bridge.SyncWithSummary()
+
+			// Assert.
+			Ω(err).Should(MatchError("consul://old:8500: registry-error"))
+			Ω(summary.Registered).Should(Equal(1))
+
+			stats := bridge.Stats()
+			Ω(stats).Should(HaveLen(2))
+			Ω(stats[0].FailedSyncs).Should(Equal(1))
+			Ω(stats[0].LastError).Should(Equal("registry-error"))
+			Ω(stats[1].FailedSyncs).Should(Equal(0))
+			Ω(stats[1].Registered).Should(Equal(1))
+			Ω(stats[1].AdvertiseAddr).Should(Equal("10.10.10.10"))
+		})
+
+		It("Should retry failed registry sync", func() {
+			// Arrange.
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil).Times(1)
+			gomock.InOrder(
+				registryAdapter.EXPECT().Services().Return(nil, errors.New("registry-error")),
+				registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil),
+			)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Register(schedulerServices[0]).Return(nil).Times(1)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter, retries: 2}},
+			}
+
+			// Act.
+			summary, err := bridge.SyncWithSummary()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.Registered).Should(Equal(1))
+			Ω(bridge.Stats()[0].Retries).Should(Equal(1))
+		})
+
+		It("Should refresh scheduler services again when retrying after scheduler failure", func() {
+			// Arrange.
+			gomock.InOrder(
+				schedulerAdapter.EXPECT().Services().Return(nil, errors.New("scheduler-error")),
+				schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil),
+			)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil).Times(2)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil).Times(2)
+			registryAdapter.EXPECT().Register(schedulerServices[0]).Return(nil).Times(1)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter, retries: 1}},
+			}
+
+			// Act.
+			summary, err := bridge.SyncWithSummary()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.Registered).Should(Equal(1))
+		})
+
+		It("Should process events of other registries while one of them is syncing", func() {
+			// Arrange.
+			release := make(chan bool)
+			registered := make(chan bool, 2)
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil).Times(1)
+			registryAdapter.EXPECT().Services().Do(func() { <-release }).Return(nil, errors.New("registry-error"))
+			otherRegistryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil)
+			otherRegistryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			otherRegistryAdapter.EXPECT().Register(gomock.Any()).Do(func(group *types.ServiceGroup) {
+				registered <- true
+			}).Return(nil).Times(2)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{
+					{Name: "consul://old:8500", Adapter: registryAdapter},
+					{Name: "consul://new:8500", Adapter: otherRegistryAdapter},
+				},
+			}
+			synced := make(chan error, 1)
+			go func() {
+				synced <- bridge.Sync()
+			}()
+			Eventually(registered).Should(Receive())
+
+			// Act.
+			processed := make(chan error, 1)
+			go func() {
+				processed <- bridge.ProcessEvent(&types.ServiceEvent{
+					ServiceID: schedulerServices[0].ID,
+					IP:        "10.10.10.10",
+					Action:    types.ServiceWentUp,
+				})
+			}()
+
+			// Assert.
+			Eventually(registered).Should(Receive())
+			close(release)
+			Eventually(synced).Should(Receive(MatchError("consul://old:8500: registry-error")))
+			Eventually(processed).Should(Receive(BeNil()))
+		})
+
+		It("Should keep failures of the last applied attempt when retry fails to plan", func() {
+			// Arrange.
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil).Times(1)
+			gomock.InOrder(
+				registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil),
+				registryAdapter.EXPECT().Services().Return(nil, errors.New("registry-error")),
+			)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Register(schedulerServices[0]).Return(errors.New("register-error"))
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter, retries: 1}},
+			}
+
+			// Act.
+			summary, err := bridge.SyncWithSummary()
+
+			// Assert.
+			Ω(err).Should(MatchError("registry-error"))
+			Ω(summary.Failed).Should(Equal(1))
+		})
+	})
+
+	Describe("Ping()", func() {
+		It("Should tolerate unavailable registries while some of them are available", func() {
+			// Arrange.
+			otherRegistryAdapter := types.NewMockRegistryAdapter(mockCtrl)
+			registryAdapter.EXPECT().Ping().Return(errors.New("registry-error"))
+			otherRegistryAdapter.EXPECT().Ping().Return(nil)
+			bridge := &Bridge{
+				registries: []*Registry{{Adapter: registryAdapter}, {Adapter: otherRegistryAdapter}},
+			}
+
+			// Act.
+			err := bridge.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should fail when none of registries are available", func() {
+			// Arrange.
+			registryAdapter.EXPECT().Ping().Return(errors.New("registry-error"))
+			bridge := &Bridge{
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			err := bridge.Ping()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Plan()", func() {
+		It("Should describe required actions without performing them", func() {
+			// Arrange.
+			schedulerServices := []*types.ServiceGroup{
+				{
+					ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+							Name:         "db-server",
+							Healthy:      true,
+							OriginalPort: 27017,
+							ExposedPort:  31045,
+						},
+					},
+				},
+				{
+					ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+							Name:         "app-server",
+							Tags:         []string{"v2"},
+							Healthy:      true,
+							OriginalPort: 3000,
+							ExposedPort:  31046,
+						},
+					},
+				},
+				{
+					ID: "web_server_6a2f0a1c-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:           "web_server_6a2f0a1c-7b4b-11e5-b945-56847afe9799:80",
+							Name:         "web-server",
+							Healthy:      false,
+							OriginalPort: 80,
+							ExposedPort:  31047,
+						},
+					},
+				},
+			}
+			registryServices := []*types.ServiceGroup{
+				{
+					ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+							Name:        "app-server",
+							Tags:        []string{"v1"},
+							ExposedPort: 31046,
+						},
+					},
+				},
+				{
+					ID: "cache_server_9a1b2c3d-7b4b-11e5-b945-56847afe9799",
+					IP: "10.10.10.10",
+					Services: []*types.Service{
+						{
+							ID:          "cache_server_9a1b2c3d-7b4b-11e5-b945-56847afe9799:6379",
+							Name:        "cache-server",
+							ExposedPort: 31048,
+						},
+					},
+				},
+			}
+			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil)
+			registryAdapter.EXPECT().Services().Return(registryServices, nil)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil)
+			registryAdapter.EXPECT().Register(gomock.Any()).Times(0)
+			registryAdapter.EXPECT().Deregister(gomock.Any()).Times(0)
+
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			plans, err := bridge.Plan()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(plans).Should(HaveLen(1))
+			plan := plans[0]
+			Ω(plan.HasDrift()).Should(BeTrue())
+			Ω(plan.Register).Should(HaveLen(1))
+			Ω(plan.Register[0].ServiceID).Should(Equal("db_server_2c033893-7993-11e5-8878-56847afe9799:27017"))
+			Ω(plan.Update).Should(HaveLen(1))
+			Ω(plan.Update[0].ServiceID).Should(Equal("app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000"))
+			Ω(plan.Update[0].Diff).Should(Equal([]string{"tags: [v1] -> [v2]"}))
+			Ω(plan.Deregister).Should(HaveLen(1))
+			Ω(plan.Deregister[0].ServiceID).Should(Equal("cache_server_9a1b2c3d-7b4b-11e5-b945-56847afe9799:6379"))
+			Ω(plan.Skipped).Should(HaveLen(1))
+			Ω(plan.Skipped[0].Reason).Should(Equal("service is not healthy"))
+		})
 	})
 
 	Describe("ProcessSchedulerEvents()", func() {
@@ -519,8 +1259,8 @@ var _ = Describe("Bridge", func() {
 			// Arrange.
 			schedulerAdapter.EXPECT().ListenForEvents(gomock.Any()).Return(errors.New("scheduler-error"))
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -537,8 +1277,37 @@ var _ = Describe("Bridge", func() {
 				close(channel)
 			}).Return(nil)
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			err := bridge.ProcessSchedulerEvents()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should multiplex events of all schedulers until all of them are closed", func() {
+			// Arrange.
+			dockerAdapter := types.NewMockSchedulerAdapter(mockCtrl)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil).Times(2)
+			schedulerAdapter.EXPECT().ListenForEvents(gomock.Any()).Do(func(channel types.EventsChannel) {
+				channel <- &types.ServiceEvent{Action: types.ServiceStarted}
+				close(channel)
+			}).Return(nil)
+			dockerAdapter.EXPECT().ListenForEvents(gomock.Any()).Do(func(channel types.EventsChannel) {
+				channel <- &types.ServiceEvent{Action: types.ServiceStarted}
+				close(channel)
+			}).Return(nil)
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil).Times(2)
+			dockerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil).Times(2)
+			bridge := &Bridge{
+				schedulers: []*Scheduler{
+					{Name: "marathon", Adapter: schedulerAdapter},
+					{Name: "docker", Adapter: dockerAdapter},
+				},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -562,8 +1331,60 @@ var _ = Describe("Bridge", func() {
 			schedulerServices := []*types.ServiceGroup{}
 			schedulerAdapter.EXPECT().Services().Return(schedulerServices, nil).Times(1)
 			bridge := &Bridge{
-				scheduler: schedulerAdapter,
-				registry:  registryAdapter,
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
+			}
+
+			// Act.
+			err := bridge.ProcessSchedulerEvents()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should pass event correlation ID to registry on ServiceWentUp event", func() {
+			// Arrange.
+			contextAdapter := types.NewMockContextRegistryAdapter(mockCtrl)
+			group := &types.ServiceGroup{ID: "web_app.1", IP: "10.10.10.10"}
+			var ids []string
+			contextAdapter.EXPECT().RegisterContext(gomock.Any(), group).Do(func(ctx context.Context, group *types.ServiceGroup) {
+				ids = append(ids, types.CorrelationID(ctx))
+			}).Return(nil).Times(2)
+			bridge := &Bridge{
+				schedulers:             []*Scheduler{{Adapter: schedulerAdapter}},
+				schedulerServiceGroups: map[string]*types.ServiceGroup{group.ID: group},
+				registries: []*Registry{{
+					Adapter: &struct {
+						*types.MockRegistryAdapter
+						*types.MockContextRegistryAdapter
+					}{registryAdapter, contextAdapter},
+					advertiseAddr: "10.10.10.10",
+				}},
+			}
+			event := &types.ServiceEvent{ServiceID: group.ID, IP: group.IP, Action: types.ServiceWentUp}
+
+			// Act.
+			bridge.ProcessEvent(event)
+			bridge.ProcessEvent(event)
+
+			// Assert.
+			Ω(ids).Should(HaveLen(2))
+			Ω(ids[0]).Should(HaveLen(16))
+			Ω(ids[1]).ShouldNot(Equal(ids[0]))
+		})
+
+		It("Should perform full sync on ServiceResync event", func() {
+			// Arrange.
+			schedulerAdapter.EXPECT().ListenForEvents(gomock.Any()).Do(func(channel types.EventsChannel) {
+				channel <- &types.ServiceEvent{Action: types.ServiceResync}
+				close(channel)
+			}).Return(nil)
+			registryAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil).Times(1)
+			registryAdapter.EXPECT().AdvertiseAddr().Return("10.10.10.10", nil).Times(1)
+			schedulerAdapter.EXPECT().Services().Return([]*types.ServiceGroup{}, nil).Times(1)
+			bridge := &Bridge{
+				schedulers: []*Scheduler{{Adapter: schedulerAdapter}},
+				registries: []*Registry{{Adapter: registryAdapter}},
 			}
 
 			// Act.
@@ -571,6 +1392,7 @@ var _ = Describe("Bridge", func() {
 
 			// Assert.
 			Ω(err).ShouldNot(HaveOccurred())
+			Ω(bridge.Stats()[0].Syncs).Should(Equal(1))
 		})
 	})
 })
@@ -0,0 +1,268 @@
+package bridge
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing/quick"
+
+	"github.com/x-cray/marathon-registrator/chaos"
+	"github.com/x-cray/marathon-registrator/memory"
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	localIP  = "10.10.10.10"
+	remoteIP = "10.10.10.20"
+)
+
+type stepKind int
+
+const (
+	stepStart stepKind = iota
+	stepStop
+	stepSetHealthy
+	stepSync
+	stepRegisterStale
+	stepDeregister
+	stepCount
+)
+
+var stepKindNames = map[stepKind]string{
+	stepStart:         "start",
+	stepStop:          "stop",
+	stepSetHealthy:    "set-healthy",
+	stepSync:          "sync",
+	stepRegisterStale: "register-stale",
+	stepDeregister:    "deregister",
+}
+
+// step is a single change of scheduler or registry state.
+type step struct {
+	kind    stepKind
+	target  int
+	local   bool
+	healthy bool
+	ports   int
+}
+
+func (s step) String() string {
+	return fmt.Sprintf("%s(target=%d local=%t healthy=%t ports=%d)", stepKindNames[s.kind], s.target, s.local, s.healthy, s.ports)
+}
+
+// scenario is a random sequence of steps generated by testing/quick.
+type scenario []step
+
+func (scenario) Generate(rand *rand.Rand, size int) reflect.Value {
+	result := make(scenario, rand.Intn(size+1))
+	for i := range result {
+		result[i] = step{
+			kind:    stepKind(rand.Intn(int(stepCount))),
+			target:  rand.Intn(size + 1),
+			local:   rand.Intn(4) > 0,
+			healthy: rand.Intn(3) > 0,
+			ports:   rand.Intn(3) + 1,
+		}
+	}
+	return reflect.ValueOf(result)
+}
+
+// play applies scenario to scheduler and registry returning error of intermediate syncs if any.
+func (s scenario) play(bridge *Bridge, scheduler *memory.Scheduler, registry *memory.Registry) error {
+	var started []string
+	pick := func(target int) string {
+		return started[target%len(started)]
+	}
+
+	for i, step := range s {
+		switch step.kind {
+		case stepStart:
+			group := &types.ServiceGroup{ID: fmt.Sprintf("app.%d", i), IP: remoteIP}
+			if step.local {
+				group.IP = localIP
+			}
+			for port := 0; port < step.ports; port++ {
+				group.Services = append(group.Services, &types.Service{
+					ID:          fmt.Sprintf("%s:%d", group.ID, port),
+					Name:        fmt.Sprintf("app-%d", step.target),
+					Healthy:     step.healthy,
+					ExposedPort: 31000 + i*10 + port,
+				})
+			}
+			scheduler.Start(group)
+			started = append(started, group.ID)
+		case stepStop:
+			if len(started) > 0 {
+				scheduler.Stop(pick(step.target))
+			}
+		case stepSetHealthy:
+			if len(started) > 0 {
+				scheduler.SetHealthy(pick(step.target), step.healthy)
+			}
+		case stepSync:
+			if err := bridge.Sync(); err != nil {
+				return err
+			}
+		case stepRegisterStale:
+			registry.Register(&types.ServiceGroup{
+				ID: fmt.Sprintf("stale.%d", i),
+				IP: localIP,
+				Services: []*types.Service{
+					{ID: fmt.Sprintf("stale.%d:0", i), Name: "stale", ExposedPort: 40000 + i},
+				},
+			})
+		case stepDeregister:
+			groups, _ := registry.Services()
+			if len(groups) > 0 {
+				registry.Deregister(groups[step.target%len(groups)])
+			}
+		}
+	}
+
+	return nil
+}
+
+func serviceIDs(groups []*types.ServiceGroup, include func(*types.ServiceGroup, *types.Service) bool) []string {
+	result := []string{}
+	for _, group := range groups {
+		for _, service := range group.Services {
+			if include(group, service) {
+				result = append(result, service.ID)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// isSubset tells whether every ID of sorted subset is present in sorted set.
+func isSubset(subset, set []string) bool {
+	for _, id := range subset {
+		i := sort.SearchStrings(set, id)
+		if i == len(set) || set[i] != id {
+			return false
+		}
+	}
+	return true
+}
+
+var _ = Describe("Bridge sync convergence", func() {
+	// Services which went unhealthy after being registered are not deregistered by bridge, so
+	// registry is expected to hold all healthy local services and nothing but local services.
+	converges := func(s scenario) bool {
+		scheduler := memory.NewScheduler()
+		registry := memory.NewRegistry(localIP)
+		bridge := NewFromAdapters(
+			&types.Config{},
+			[]*Scheduler{{Adapter: scheduler}},
+			[]*Registry{{Adapter: registry}},
+		)
+
+		if err := s.play(bridge, scheduler, registry); err != nil {
+			return false
+		}
+		if err := bridge.Sync(); err != nil {
+			return false
+		}
+
+		schedulerGroups, _ := scheduler.Services()
+		registryGroups, _ := registry.Services()
+		healthyLocal := serviceIDs(schedulerGroups, func(group *types.ServiceGroup, service *types.Service) bool {
+			return group.IP == localIP && service.Healthy
+		})
+		local := serviceIDs(schedulerGroups, func(group *types.ServiceGroup, service *types.Service) bool {
+			return group.IP == localIP
+		})
+		registered := serviceIDs(registryGroups, func(*types.ServiceGroup, *types.Service) bool {
+			return true
+		})
+
+		return isSubset(healthyLocal, registered) && isSubset(registered, local)
+	}
+
+	It("Should register healthy local scheduler services after any sequence of changes", func() {
+		// Act.
+		err := quick.Check(converges, &quick.Config{MaxCount: 200})
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("Should converge to healthy local scheduler services", func() {
+		// Arrange.
+		scheduler := memory.NewScheduler()
+		registry := memory.NewRegistry(localIP)
+		bridge := NewFromAdapters(
+			&types.Config{},
+			[]*Scheduler{{Adapter: scheduler}},
+			[]*Registry{{Adapter: registry}},
+		)
+		s := scenario{
+			{kind: stepStart, local: true, healthy: true, ports: 2},
+			{kind: stepStart, local: true, healthy: false, ports: 1},
+			{kind: stepStart, local: false, healthy: true, ports: 1},
+			{kind: stepRegisterStale},
+			{kind: stepSync},
+			{kind: stepSetHealthy, target: 1, healthy: true},
+			{kind: stepStop, target: 0},
+			{kind: stepDeregister},
+		}
+
+		// Act.
+		playErr := s.play(bridge, scheduler, registry)
+		syncErr := bridge.Sync()
+
+		// Assert.
+		Ω(playErr).ShouldNot(HaveOccurred())
+		Ω(syncErr).ShouldNot(HaveOccurred())
+		registryGroups, _ := registry.Services()
+		Ω(serviceIDs(registryGroups, func(*types.ServiceGroup, *types.Service) bool {
+			return true
+		})).Should(Equal([]string{"app.1:0"}))
+	})
+
+	It("Should converge once flaky registry recovers", func() {
+		// Arrange.
+		scheduler := memory.NewScheduler()
+		registry := memory.NewRegistry(localIP)
+		options := &types.ChaosOptions{ErrorRate: 0.5, PartialServices: 1, Seed: 42}
+		bridge := NewFromAdapters(
+			&types.Config{},
+			[]*Scheduler{{Adapter: scheduler}},
+			[]*Registry{{Adapter: chaos.WrapRegistry(registry, options)}},
+		)
+		for i := 0; i < 10; i++ {
+			scheduler.Start(&types.ServiceGroup{
+				ID: fmt.Sprintf("app.%d", i),
+				IP: localIP,
+				Services: []*types.Service{
+					{ID: fmt.Sprintf("app.%d:0", i), Name: "app", Healthy: true, ExposedPort: 31000 + i*10},
+					{ID: fmt.Sprintf("app.%d:1", i), Name: "app", Healthy: true, ExposedPort: 31001 + i*10},
+				},
+			})
+		}
+		var flakyErr error
+		for i := 0; i < 3 && flakyErr == nil; i++ {
+			flakyErr = bridge.Sync()
+		}
+		scheduler.Stop("app.0")
+		options.ErrorRate = 0
+
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(flakyErr).Should(HaveOccurred())
+		Ω(err).ShouldNot(HaveOccurred())
+		schedulerGroups, _ := scheduler.Services()
+		registryGroups, _ := registry.Services()
+		all := func(*types.ServiceGroup, *types.Service) bool {
+			return true
+		}
+		Ω(serviceIDs(registryGroups, all)).Should(Equal(serviceIDs(schedulerGroups, all)))
+	})
+})
@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// Weights registry assumes for services registered without explicit weights.
+var defaultWeights = types.ServiceWeights{Passing: 1, Warning: 1}
+
+// serviceDiff returns human-readable differences between scheduler and registry definitions of the same service.
+// Empty result means that registry definition is up to date. Health is only compared for registries
+// tracking readiness, since the others have health checks of their own.
+func serviceDiff(scheduler, registry *serviceGroupPair, compareHealth bool) []string {
+	var diff []string
+	add := func(field string, from, to interface{}) {
+		diff = append(diff, fmt.Sprintf("%s: %v -> %v", field, from, to))
+	}
+
+	if scheduler.group.IP != registry.group.IP {
+		add("address", registry.group.IP, scheduler.group.IP)
+	}
+	if compareHealth && scheduler.service.Healthy != registry.service.Healthy {
+		add("healthy", registry.service.Healthy, scheduler.service.Healthy)
+	}
+	if scheduler.service.ExposedPort != registry.service.ExposedPort {
+		add("port", registry.service.ExposedPort, scheduler.service.ExposedPort)
+	}
+	if !equalStrings(scheduler.service.Tags, registry.service.Tags) {
+		add("tags", registry.service.Tags, scheduler.service.Tags)
+	}
+	if !equalStringMaps(scheduler.service.Meta, registry.service.Meta) {
+		add("meta", registry.service.Meta, scheduler.service.Meta)
+	}
+	if scheduler.service.EnableTagOverride != registry.service.EnableTagOverride {
+		add("enableTagOverride", registry.service.EnableTagOverride, scheduler.service.EnableTagOverride)
+	}
+	if schedulerWeights, registryWeights := weights(scheduler.service), weights(registry.service); schedulerWeights != registryWeights {
+		add("weights", registryWeights, schedulerWeights)
+	}
+
+	return append(diff, checksDiff(scheduler.service.HealthChecks, registry.service.HealthChecks)...)
+}
+
+func checksDiff(scheduler, registry []*types.ServiceHealthCheck) []string {
+	var diff []string
+	schedulerChecks := checksMap(scheduler)
+	registryChecks := checksMap(registry)
+
+	for _, id := range sortedCheckIDs(schedulerChecks) {
+		schedulerCheck := schedulerChecks[id]
+		registryCheck, ok := registryChecks[id]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("check %s: added %+v", id, *schedulerCheck))
+		} else if !equalChecks(schedulerCheck, registryCheck) {
+			diff = append(diff, fmt.Sprintf("check %s: %+v -> %+v", id, *registryCheck, *schedulerCheck))
+		}
+	}
+
+	for _, id := range sortedCheckIDs(registryChecks) {
+		if _, ok := schedulerChecks[id]; !ok {
+			diff = append(diff, fmt.Sprintf("check %s: removed", id))
+		}
+	}
+
+	return diff
+}
+
+func checksMap(checks []*types.ServiceHealthCheck) map[string]*types.ServiceHealthCheck {
+	result := make(map[string]*types.ServiceHealthCheck)
+	for _, check := range checks {
+		result[check.ID] = check
+	}
+	return result
+}
+
+func sortedCheckIDs(checks map[string]*types.ServiceHealthCheck) []string {
+	var ids []string
+	for id := range checks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func equalChecks(a, b *types.ServiceHealthCheck) bool {
+	return a.HTTP == b.HTTP &&
+		a.TCP == b.TCP &&
+		a.Script == b.Script &&
+		equalDurations(a.TTL, b.TTL) &&
+		equalDurations(a.Interval, b.Interval) &&
+		equalDurations(a.Timeout, b.Timeout)
+}
+
+// equalDurations compares durations regardless of their formatting, i.e. "1m" equals "60s".
+func equalDurations(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	durationA, errA := time.ParseDuration(a)
+	durationB, errB := time.ParseDuration(b)
+	return errA == nil && errB == nil && durationA == durationB
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func weights(service *types.Service) types.ServiceWeights {
+	if service.Weights == nil {
+		return defaultWeights
+	}
+	return *service.Weights
+}
@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"sort"
+
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// PlanAction is the kind of change described by a plan entry.
+type PlanAction string
+
+const (
+	// PlanRegister denotes service which should be registered
+	PlanRegister PlanAction = "register"
+
+	// PlanDeregister denotes service which should be deregistered
+	PlanDeregister PlanAction = "deregister"
+
+	// PlanUpdate denotes service which should be registered again to update its definition
+	PlanUpdate PlanAction = "update"
+
+	// PlanSkip denotes scheduler service which is intentionally left out of registry
+	PlanSkip PlanAction = "skip"
+)
+
+// PlanEntry describes the action to be performed on a single service.
+type PlanEntry struct {
+	Action    PlanAction `json:"action"`
+	GroupID   string     `json:"groupId"`
+	ServiceID string     `json:"serviceId"`
+	Name      string     `json:"name"`
+	IP        string     `json:"ip"`
+	Port      int        `json:"port"`
+	Reason    string     `json:"reason"`
+	Diff      []string   `json:"diff,omitempty"`
+
+	group *types.ServiceGroup
+}
+
+// Plan is the set of actions required to bring service registry in sync with scheduler.
+type Plan struct {
+	Registry   string       `json:"registry,omitempty"`
+	Register   []*PlanEntry `json:"register"`
+	Deregister []*PlanEntry `json:"deregister"`
+	Update     []*PlanEntry `json:"update"`
+	Skipped    []*PlanEntry `json:"skipped"`
+}
+
+func newPlanEntry(action PlanAction, pair *serviceGroupPair, reason string) *PlanEntry {
+	return &PlanEntry{
+		Action:    action,
+		GroupID:   pair.group.ID,
+		ServiceID: pair.service.ID,
+		Name:      pair.service.Name,
+		IP:        pair.group.IP,
+		Port:      pair.service.ExposedPort,
+		Reason:    reason,
+		group:     pair.group,
+	}
+}
+
+// HasDrift tells whether registry differs from scheduler.
+func (p *Plan) HasDrift() bool {
+	return len(p.Register)+len(p.Deregister)+len(p.Update) > 0
+}
+
+type planEntriesByService []*PlanEntry
+
+func (e planEntriesByService) Len() int           { return len(e) }
+func (e planEntriesByService) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e planEntriesByService) Less(i, j int) bool { return e[i].ServiceID < e[j].ServiceID }
+
+// sort orders entries to make plan output stable.
+func (p *Plan) sort() {
+	for _, entries := range [][]*PlanEntry{p.Register, p.Deregister, p.Update, p.Skipped} {
+		sort.Sort(planEntriesByService(entries))
+	}
+}
@@ -0,0 +1,222 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/consul"
+	"github.com/x-cray/marathon-registrator/kubernetes"
+	"github.com/x-cray/marathon-registrator/types"
+	"github.com/x-cray/marathon-registrator/zonefile"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Registry is the registry adapter along with its name and sync state.
+// Each registry is synchronized independently, so failure of one does not affect the others.
+type Registry struct {
+	Name    string
+	Adapter types.RegistryAdapter
+
+	// Number of times to retry failed sync.
+	retries       int
+	advertiseAddr string
+
+	// Serializes syncs and event processing of the registry, so that registries are not blocked by each other.
+	syncLock sync.Mutex
+
+	statsLock sync.Mutex
+	stats     RegistryStats
+}
+
+// RegistryStats holds sync metrics of a single registry.
+type RegistryStats struct {
+	Registry      string    `json:"registry"`
+	AdvertiseAddr string    `json:"advertiseAddr"`
+	Syncs         int       `json:"syncs"`
+	FailedSyncs   int       `json:"failedSyncs"`
+	Retries       int       `json:"retries"`
+	Registered    int       `json:"registered"`
+	Deregistered  int       `json:"deregistered"`
+	Updated       int       `json:"updated"`
+	Failed        int       `json:"failed"`
+	LastSync      time.Time `json:"lastSync"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// Default transports of registry types.
+var registryTransports = map[string]string{
+	"consul":     "http",
+	"kubernetes": "https",
+	"file":       "file",
+}
+
+// ParseRegistryConfig parses registry URL in TYPE[+TRANSPORT]://ADDRESS format, i.e. consul://127.0.0.1:8500 or
+// consul+https://127.0.0.1:8501. Registry is named after its type and address. Number of times to retry failed
+// sync of the registry may be given with retries parameter, i.e. consul://127.0.0.1:8500?retries=5.
+func ParseRegistryConfig(spec string) (*types.RegistryConfig, error) {
+	uri, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Registry %q has invalid URL: %v", spec, err)
+	}
+
+	typeAndTransport := strings.SplitN(uri.Scheme, "+", 2)
+	registryType := typeAndTransport[0]
+	transport, ok := registryTransports[registryType]
+	if !ok {
+		return nil, fmt.Errorf("Registry %q has unsupported type %s", spec, registryType)
+	}
+	if len(typeAndTransport) > 1 {
+		transport = typeAndTransport[1]
+	}
+
+	var retries *int
+	params := uri.Query()
+	if value := params.Get("retries"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("Registry %q has invalid retries parameter %q", spec, value)
+		}
+		retries = &count
+		params.Del("retries")
+		uri.RawQuery = params.Encode()
+	}
+
+	name := registryType + "://" + uri.Host + uri.Path
+	uri.Scheme = transport
+
+	return &types.RegistryConfig{
+		Name:    name,
+		Type:    registryType,
+		URL:     uri,
+		Retries: retries,
+	}, nil
+}
+
+// NewRegistry creates registry adapter described by registryConfig.
+func NewRegistry(registryConfig *types.RegistryConfig, c *types.Config) (*Registry, error) {
+	var adapter types.RegistryAdapter
+	var err error
+	switch registryConfig.Type {
+	case "consul":
+		adapter, err = consul.New(registryConfig.URL, c.ConsulOptions, c.DryRun)
+	case "kubernetes":
+		adapter, err = kubernetes.New(registryConfig.URL, c.DryRun)
+	case "file":
+		adapter, err = zonefile.New(registryConfig.URL, c.DryRun)
+	default:
+		err = fmt.Errorf("Unsupported registry type: %s", registryConfig.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	retries := c.RegistryRetries
+	if registryConfig.Retries != nil {
+		retries = *registryConfig.Retries
+	}
+
+	return &Registry{
+		Name:    registryConfig.Name,
+		Adapter: adapter,
+		retries: retries,
+	}, nil
+}
+
+// Stats returns sync metrics of the registry.
+func (r *Registry) Stats() RegistryStats {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+
+	stats := r.stats
+	stats.Registry = r.Name
+	return stats
+}
+
+func (r *Registry) setAdvertiseAddr(addr string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+
+	r.advertiseAddr = addr
+	r.stats.AdvertiseAddr = addr
+}
+
+func (r *Registry) recordSync(summary *SyncSummary, retries int, err error) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+
+	r.stats.Syncs++
+	r.stats.Retries += retries
+	r.stats.LastSync = time.Now()
+	r.stats.LastError = ""
+	if summary != nil {
+		r.stats.Registered += summary.Registered
+		r.stats.Deregistered += summary.Deregistered
+		r.stats.Updated += summary.Updated
+		r.stats.Failed += summary.Failed
+	}
+	if err != nil {
+		r.stats.FailedSyncs++
+		r.stats.LastError = err.Error()
+	}
+}
+
+// refreshAdvertiseAddr updates the address of scheduler services to register.
+func (r *Registry) refreshAdvertiseAddr() error {
+	addr, err := r.Adapter.AdvertiseAddr()
+	if err != nil {
+		return err
+	}
+
+	if addr != r.advertiseAddr {
+		log.WithFields(log.Fields{
+			"prefix":   "bridge",
+			"registry": r.Name,
+		}).Infof("Registry advertise address is %s", addr)
+	}
+	r.setAdvertiseAddr(addr)
+
+	return nil
+}
+
+// wrap prefixes error with registry name to tell which registry failed.
+func (r *Registry) wrap(err error) error {
+	if r.Name == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %v", r.Name, err)
+}
+
+// tracksReadiness tells whether registry registers unhealthy services as not ready.
+func (r *Registry) tracksReadiness() bool {
+	return types.TracksReadiness(r.Adapter)
+}
+
+// register registers group passing ctx to adapter if it takes context into account.
+func (r *Registry) register(ctx context.Context, group *types.ServiceGroup) error {
+	if adapter, ok := r.Adapter.(types.ContextRegistryAdapter); ok {
+		return adapter.RegisterContext(ctx, group)
+	}
+	return r.Adapter.Register(group)
+}
+
+// deregister deregisters group passing ctx to adapter if it takes context into account.
+func (r *Registry) deregister(ctx context.Context, group *types.ServiceGroup) error {
+	if adapter, ok := r.Adapter.(types.ContextRegistryAdapter); ok {
+		return adapter.DeregisterContext(ctx, group)
+	}
+	return r.Adapter.Deregister(group)
+}
+
+func (r *Registry) logError(ctx context.Context, err error, message string) {
+	log.WithFields(log.Fields{
+		"prefix":   "bridge",
+		"registry": r.Name,
+		"err":      err,
+	}).WithFields(types.ContextFields(ctx)).Error(message)
+}
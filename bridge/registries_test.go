@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseRegistryConfig()", func() {
+	It("Should parse Consul registry URL", func() {
+		// Act.
+		config, err := ParseRegistryConfig("consul+https://10.10.10.10:8501")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Name).Should(Equal("consul://10.10.10.10:8501"))
+		Ω(config.Type).Should(Equal("consul"))
+		Ω(config.URL.String()).Should(Equal("https://10.10.10.10:8501"))
+	})
+
+	It("Should parse in-cluster Kubernetes registry URL", func() {
+		// Act.
+		config, err := ParseRegistryConfig("kubernetes://?namespace=marathon&advertise_addr=10.10.10.10")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Name).Should(Equal("kubernetes://"))
+		Ω(config.Type).Should(Equal("kubernetes"))
+		Ω(config.URL.Scheme).Should(Equal("https"))
+		Ω(config.URL.Query().Get("namespace")).Should(Equal("marathon"))
+	})
+
+	It("Should parse zone file registry URL", func() {
+		// Act.
+		config, err := ParseRegistryConfig("file:///etc/coredns/marathon.zone?origin=marathon.local")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Name).Should(Equal("file:///etc/coredns/marathon.zone"))
+		Ω(config.Type).Should(Equal("file"))
+		Ω(config.URL.Path).Should(Equal("/etc/coredns/marathon.zone"))
+	})
+
+	It("Should parse registry retries", func() {
+		// Act.
+		config, err := ParseRegistryConfig("consul://10.10.10.10:8500?retries=5&token=secret")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(*config.Retries).Should(Equal(5))
+		Ω(config.URL.String()).Should(Equal("http://10.10.10.10:8500?token=secret"))
+	})
+
+	It("Should reject invalid registry retries", func() {
+		// Act.
+		_, err := ParseRegistryConfig("consul://10.10.10.10:8500?retries=-1")
+
+		// Assert.
+		Ω(err).Should(MatchError(ContainSubstring("invalid retries parameter")))
+	})
+
+	It("Should reject unsupported registries", func() {
+		// Act.
+		_, err := ParseRegistryConfig("etcd://10.10.10.10:2379")
+
+		// Assert.
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("NewRegistry()", func() {
+	It("Should prefer registry retries over the global ones", func() {
+		// Arrange.
+		c := &types.Config{RegistryRetries: 2}
+		own, err := ParseRegistryConfig("file:///tmp/own.zone?origin=marathon.local&advertise_addr=10.10.10.10&retries=5")
+		Ω(err).ShouldNot(HaveOccurred())
+		global, err := ParseRegistryConfig("file:///tmp/global.zone?origin=marathon.local&advertise_addr=10.10.10.10")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		// Act.
+		ownRegistry, ownErr := NewRegistry(own, c)
+		globalRegistry, globalErr := NewRegistry(global, c)
+
+		// Assert.
+		Ω(ownErr).ShouldNot(HaveOccurred())
+		Ω(globalErr).ShouldNot(HaveOccurred())
+		Ω(ownRegistry.retries).Should(Equal(5))
+		Ω(globalRegistry.retries).Should(Equal(2))
+	})
+})
@@ -0,0 +1,128 @@
+package bridge
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/x-cray/marathon-registrator/docker"
+	"github.com/x-cray/marathon-registrator/marathon"
+	"github.com/x-cray/marathon-registrator/mesos"
+	"github.com/x-cray/marathon-registrator/nomad"
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// Scheduler is the scheduler adapter along with its name. Services registered from named scheduler
+// are tagged with its name to tell which scheduler owns them.
+type Scheduler struct {
+	Name    string
+	Adapter types.SchedulerAdapter
+}
+
+// SchedulerStatus describes the state of a single scheduler.
+type SchedulerStatus struct {
+	Scheduler      string `json:"scheduler"`
+	ActiveEndpoint string `json:"activeEndpoint,omitempty"`
+}
+
+// Status returns the state of the scheduler.
+func (s *Scheduler) Status() SchedulerStatus {
+	status := SchedulerStatus{Scheduler: s.Name}
+	if reporter, ok := s.Adapter.(types.SchedulerEndpointReporter); ok {
+		status.ActiveEndpoint = reporter.ActiveEndpoint()
+	}
+	return status
+}
+
+// Default transports of scheduler types.
+var schedulerTransports = map[string]string{
+	"marathon": "http",
+	"mesos":    "http",
+	"docker":   "unix",
+	"nomad":    "http",
+}
+
+// ParseSchedulerConfig parses scheduler specification in NAME=TYPE[+TRANSPORT]://ADDRESS[?PARAMS] format,
+// i.e. roles=marathon://addr1:8080,addr2:8080?events=callback&callback_listen=:4000,
+// local=docker:///var/run/docker.sock or aurora=mesos+https://master:5050?framework=aurora.
+func ParseSchedulerConfig(spec string) (*types.SchedulerConfig, error) {
+	nameAndURL := strings.SplitN(spec, "=", 2)
+	if len(nameAndURL) != 2 || nameAndURL[0] == "" {
+		return nil, fmt.Errorf("Scheduler %q must be specified as NAME=URL", spec)
+	}
+
+	schemeAndAddress := strings.SplitN(nameAndURL[1], "://", 2)
+	if len(schemeAndAddress) != 2 {
+		return nil, fmt.Errorf("Scheduler %q URL must include scheme", spec)
+	}
+
+	typeAndTransport := strings.SplitN(schemeAndAddress[0], "+", 2)
+	schedulerType := typeAndTransport[0]
+	transport, ok := schedulerTransports[schedulerType]
+	if !ok {
+		return nil, fmt.Errorf("Scheduler %q has unsupported type %s", spec, schedulerType)
+	}
+	if len(typeAndTransport) > 1 {
+		transport = typeAndTransport[1]
+	}
+
+	address := schemeAndAddress[1]
+	params := make(url.Values)
+	if i := strings.Index(address, "?"); i >= 0 {
+		var err error
+		params, err = url.ParseQuery(address[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("Scheduler %q has invalid parameters: %v", spec, err)
+		}
+		address = address[:i]
+	}
+
+	return &types.SchedulerConfig{
+		Name:   nameAndURL[0],
+		Type:   schedulerType,
+		URL:    transport + "://" + address,
+		Params: params,
+	}, nil
+}
+
+// NewScheduler creates scheduler adapter described by schedulerConfig. Registry is asked for the address of
+// Docker host on every sync when it is not specified explicitly, so that unreachable registry does not fail startup.
+func NewScheduler(schedulerConfig *types.SchedulerConfig, c *types.Config, registry types.RegistryAdapter) (*Scheduler, error) {
+	var adapter types.SchedulerAdapter
+	var err error
+	switch schedulerConfig.Type {
+	case "marathon":
+		adapter, err = marathon.New(schedulerConfig.URL, &marathon.Options{
+			EventsTransport: paramOrDefault(schedulerConfig.Params, "events", marathon.EventsTransportSSE),
+			CallbackListen:  schedulerConfig.Params.Get("callback_listen"),
+			CallbackURL:     schedulerConfig.Params.Get("callback_url"),
+		})
+	case "mesos":
+		adapter, err = mesos.New(schedulerConfig.URL, schedulerConfig.Params["framework"])
+	case "docker":
+		if hostIP := schedulerConfig.Params.Get("ip"); hostIP != "" {
+			adapter, err = docker.New(schedulerConfig.URL, hostIP)
+		} else {
+			adapter, err = docker.NewWithHostIPResolver(schedulerConfig.URL, registry.AdvertiseAddr)
+		}
+	case "nomad":
+		adapter, err = nomad.New(schedulerConfig.URL, c.NomadToken)
+	default:
+		err = fmt.Errorf("Unsupported scheduler type: %s", schedulerConfig.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{
+		Name:    schedulerConfig.Name,
+		Adapter: adapter,
+	}, nil
+}
+
+func paramOrDefault(params url.Values, key, defaultValue string) string {
+	if value := params.Get(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
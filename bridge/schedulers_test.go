@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"io"
+	"net/url"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseSchedulerConfig()", func() {
+	It("Should parse Marathon HA setup", func() {
+		// Act.
+		config, err := ParseSchedulerConfig("roles=marathon://addr1:8080,addr2:8080")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config).Should(Equal(&types.SchedulerConfig{
+			Name:   "roles",
+			Type:   "marathon",
+			URL:    "http://addr1:8080,addr2:8080",
+			Params: url.Values{},
+		}))
+	})
+
+	It("Should parse transport and parameters", func() {
+		// Act.
+		config, err := ParseSchedulerConfig("aurora=mesos+https://master:5050?framework=aurora&framework=singularity")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config).Should(Equal(&types.SchedulerConfig{
+			Name:   "aurora",
+			Type:   "mesos",
+			URL:    "https://master:5050",
+			Params: url.Values{"framework": {"aurora", "singularity"}},
+		}))
+	})
+
+	It("Should use unix socket transport for Docker by default", func() {
+		// Act.
+		config, err := ParseSchedulerConfig("local=docker:///var/run/docker.sock?ip=10.10.10.10")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.URL).Should(Equal("unix:///var/run/docker.sock"))
+		Ω(config.Params.Get("ip")).Should(Equal("10.10.10.10"))
+	})
+
+	It("Should reject invalid specifications", func() {
+		for _, spec := range []string{
+			"marathon://addr1:8080",
+			"=marathon://addr1:8080",
+			"local=addr1:8080",
+			"local=kubernetes://addr1:8080",
+		} {
+			// Act.
+			_, err := ParseSchedulerConfig(spec)
+
+			// Assert.
+			Ω(err).Should(HaveOccurred(), spec)
+		}
+	})
+})
+
+var _ = Describe("NewScheduler()", func() {
+	var (
+		mockCtrl        *gomock.Controller
+		registryAdapter *types.MockRegistryAdapter
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		registryAdapter = types.NewMockRegistryAdapter(mockCtrl)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("Should not ask registry for Docker host address on creation", func() {
+		// Arrange.
+		config, _ := ParseSchedulerConfig("local=docker:///var/run/docker.sock")
+		registryAdapter.EXPECT().AdvertiseAddr().Times(0)
+
+		// Act.
+		scheduler, err := NewScheduler(config, &types.Config{}, registryAdapter)
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(scheduler.Name).Should(Equal("local"))
+		scheduler.Adapter.(io.Closer).Close()
+	})
+})
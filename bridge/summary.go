@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// SyncSummary reports actions performed during sync.
+type SyncSummary struct {
+	Registered   int
+	Deregistered int
+	Updated      int
+	Failed       int
+	Errors       []error
+}
+
+func (s *SyncSummary) fail(entry *PlanEntry, err error) {
+	log.WithFields(log.Fields{
+		"prefix":  "bridge",
+		"service": entry.ServiceID,
+		"action":  entry.Action,
+		"err":     err,
+	}).Error("Failed to sync service")
+
+	s.Failed++
+	s.Errors = append(s.Errors, err)
+}
+
+// add sums up summary of the registry sync.
+func (s *SyncSummary) add(other *SyncSummary, registry *Registry) {
+	s.Registered += other.Registered
+	s.Deregistered += other.Deregistered
+	s.Updated += other.Updated
+	s.Failed += other.Failed
+	for _, err := range other.Errors {
+		s.Errors = append(s.Errors, registry.wrap(err))
+	}
+}
+
+// err returns the error describing all failures occurred during sync.
+func (s *SyncSummary) err() error {
+	switch len(s.Errors) {
+	case 0:
+		return nil
+	case 1:
+		return s.Errors[0]
+	default:
+		return fmt.Errorf("%d errors occurred during sync, first one: %v", len(s.Errors), s.Errors[0])
+	}
+}
+
+func (s *SyncSummary) String() string {
+	return fmt.Sprintf(
+		"%d registered, %d deregistered, %d updated, %d failed",
+		s.Registered,
+		s.Deregistered,
+		s.Updated,
+		s.Failed,
+	)
+}
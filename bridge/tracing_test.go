@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"github.com/x-cray/marathon-registrator/memory"
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// spansByName indexes exported spans by their names.
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	result := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		result[span.Name] = span
+	}
+	return result
+}
+
+var _ = Describe("Bridge tracing", func() {
+	var (
+		exporter  *tracetest.InMemoryExporter
+		scheduler *memory.Scheduler
+		bridge    *Bridge
+	)
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		scheduler = memory.NewScheduler()
+		bridge = NewFromAdapters(
+			&types.Config{},
+			[]*Scheduler{{Name: "marathon", Adapter: scheduler}},
+			[]*Registry{{Name: "consul", Adapter: memory.NewRegistry("10.10.10.10")}},
+		)
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	It("Should trace sync along with scheduler and registry parts of it", func() {
+		// Act.
+		err := bridge.Sync()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		spans := spansByName(exporter)
+		Ω(spans).Should(HaveKey("bridge.Sync"))
+		sync := spans["bridge.Sync"]
+		Ω(spans["bridge.syncRegistry"].Parent.SpanID()).Should(Equal(sync.SpanContext.SpanID()))
+		Ω(spans["bridge.syncRegistry"].Attributes).Should(ContainElement(attribute.String("registry", "consul")))
+		Ω(spans["bridge.refreshSchedulerServices"].Parent.SpanID()).Should(Equal(sync.SpanContext.SpanID()))
+		Ω(spans["scheduler.Services"].Parent.SpanID()).Should(Equal(spans["bridge.refreshSchedulerServices"].SpanContext.SpanID()))
+		Ω(spans["scheduler.Services"].Attributes).Should(ContainElement(attribute.String("scheduler", "marathon")))
+	})
+
+	It("Should trace scheduler event handling with its correlation ID", func() {
+		// Act.
+		err := bridge.ProcessEvent(&types.ServiceEvent{
+			ServiceID: "web_app.1",
+			IP:        "10.10.10.10",
+			Action:    types.ServiceStarted,
+		})
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		spans := spansByName(exporter)
+		Ω(spans).Should(HaveKey("bridge.ProcessEvent"))
+		event := spans["bridge.ProcessEvent"]
+		Ω(event.Attributes).Should(ContainElement(attribute.String("service.id", "web_app.1")))
+		Ω(event.Attributes).Should(ContainElement(attribute.String("event.action", "started")))
+		Ω(spans["bridge.refreshSchedulerServices"].Parent.SpanID()).Should(Equal(event.SpanContext.SpanID()))
+	})
+})
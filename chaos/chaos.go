@@ -0,0 +1,137 @@
+// Package chaos provides registry and scheduler adapter decorators injecting faults, i.e. errors,
+// latency, partial failures and dropped events, to check how bridge copes with flaky dependencies.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ErrInjected is returned by adapter calls failed on purpose.
+var ErrInjected = errors.New("Injected failure")
+
+// ParseOptions parses comma-separated fault specification,
+// i.e. error-rate=0.1,latency=200ms,jitter=100ms,partial=1,drop-rate=0.05,seed=42.
+func ParseOptions(spec string) (*types.ChaosOptions, error) {
+	options := &types.ChaosOptions{}
+	for _, option := range strings.Split(spec, ",") {
+		if option == "" {
+			continue
+		}
+
+		keyValue := strings.SplitN(option, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("Chaos option %q must be in KEY=VALUE format", option)
+		}
+
+		var err error
+		key, value := keyValue[0], keyValue[1]
+		switch key {
+		case "error-rate":
+			options.ErrorRate, err = parseRate(value)
+		case "latency":
+			options.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			options.Jitter, err = time.ParseDuration(value)
+		case "partial":
+			options.PartialServices, err = strconv.Atoi(value)
+		case "drop-rate":
+			options.DropRate, err = parseRate(value)
+		case "seed":
+			options.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid chaos option %q: %v", option, err)
+		}
+	}
+
+	if options.Latency < 0 || options.Jitter < 0 || options.PartialServices < 0 {
+		return nil, fmt.Errorf("Chaos options %q must not be negative", spec)
+	}
+
+	return options, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, errors.New("rate must be between 0 and 1")
+	}
+	return rate, nil
+}
+
+// injector decides which calls to delay and fail.
+type injector struct {
+	options *types.ChaosOptions
+	target  string
+
+	// Guards random which is not safe for concurrent use.
+	lock   sync.Mutex
+	random *rand.Rand
+}
+
+func newInjector(options *types.ChaosOptions, target string) *injector {
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &injector{
+		options: options,
+		target:  target,
+		random:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// chance returns true with the probability of rate.
+func (i *injector) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.random.Float64() < rate
+}
+
+func (i *injector) delay() {
+	delay := i.options.Latency
+	if i.options.Jitter > 0 {
+		i.lock.Lock()
+		delay += time.Duration(i.random.Int63n(int64(i.options.Jitter)))
+		i.lock.Unlock()
+	}
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// call delays operation and decides whether it should fail.
+func (i *injector) call(operation string) error {
+	i.delay()
+	if !i.chance(i.options.ErrorRate) {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":    "chaos",
+		"target":    i.target,
+		"operation": operation,
+	}).Warn("Injecting failure")
+	return ErrInjected
+}
@@ -0,0 +1,192 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/memory"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestChaos(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Chaos Suite")
+}
+
+var group = &types.ServiceGroup{
+	ID: "web_app.1",
+	IP: "10.10.10.10",
+	Services: []*types.Service{
+		{ID: "web_app.1:80", Name: "web-app-80", ExposedPort: 31000},
+		{ID: "web_app.1:8080", Name: "web-app-8080", ExposedPort: 31001},
+	},
+}
+
+var _ = Describe("ParseOptions", func() {
+	It("Should parse all options", func() {
+		// Act.
+		options, err := ParseOptions("error-rate=0.1,latency=200ms,jitter=100ms,partial=1,drop-rate=0.05,seed=42")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(options).Should(Equal(&types.ChaosOptions{
+			ErrorRate:       0.1,
+			Latency:         200 * time.Millisecond,
+			Jitter:          100 * time.Millisecond,
+			PartialServices: 1,
+			DropRate:        0.05,
+			Seed:            42,
+		}))
+	})
+
+	It("Should fail to parse malformed options", func() {
+		// Act.
+		_, formatErr := ParseOptions("error-rate")
+		_, rateErr := ParseOptions("error-rate=2")
+		_, unknownErr := ParseOptions("timeout=1s")
+		_, negativeErr := ParseOptions("latency=-1s")
+
+		// Assert.
+		Ω(formatErr).Should(MatchError(`Chaos option "error-rate" must be in KEY=VALUE format`))
+		Ω(rateErr).Should(MatchError(`Invalid chaos option "error-rate=2": rate must be between 0 and 1`))
+		Ω(unknownErr).Should(MatchError(`Invalid chaos option "timeout=1s": unknown option`))
+		Ω(negativeErr).Should(MatchError(`Chaos options "latency=-1s" must not be negative`))
+	})
+})
+
+var _ = Describe("Registry", func() {
+	var registry *memory.Registry
+
+	BeforeEach(func() {
+		registry = memory.NewRegistry("10.10.10.10")
+	})
+
+	It("Should pass calls through without faults", func() {
+		// Arrange.
+		adapter := WrapRegistry(registry, &types.ChaosOptions{})
+
+		// Act.
+		err := adapter.Register(group)
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(adapter.Services()).Should(HaveLen(2))
+		Ω(adapter.AdvertiseAddr()).Should(Equal("10.10.10.10"))
+	})
+
+	It("Should fail calls", func() {
+		// Arrange.
+		adapter := WrapRegistry(registry, &types.ChaosOptions{ErrorRate: 1})
+
+		// Act.
+		err := adapter.Register(group)
+
+		// Assert.
+		Ω(err).Should(Equal(ErrInjected))
+		Ω(adapter.Ping()).Should(Equal(ErrInjected))
+		_, servicesErr := adapter.Services()
+		Ω(servicesErr).Should(Equal(ErrInjected))
+		Ω(registry.Services()).Should(BeEmpty())
+	})
+
+	It("Should apply the first services of the group before failure", func() {
+		// Arrange.
+		adapter := WrapRegistry(registry, &types.ChaosOptions{ErrorRate: 1, PartialServices: 1})
+
+		// Act.
+		err := adapter.Register(group)
+
+		// Assert.
+		Ω(err).Should(Equal(ErrInjected))
+		services, _ := registry.Services()
+		Ω(services).Should(HaveLen(1))
+		Ω(services[0].Services[0].ID).Should(Equal("web_app.1:80"))
+	})
+
+	It("Should delay calls", func() {
+		// Arrange.
+		adapter := WrapRegistry(registry, &types.ChaosOptions{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond})
+		started := time.Now()
+
+		// Act.
+		adapter.Ping()
+
+		// Assert.
+		Ω(time.Since(started)).Should(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("Should fail the same calls with the same seed", func() {
+		// Arrange.
+		options := &types.ChaosOptions{ErrorRate: 0.5, Seed: 42}
+		first := WrapRegistry(registry, options)
+		second := WrapRegistry(registry, options)
+		var firstErrs, secondErrs []error
+
+		// Act.
+		for i := 0; i < 20; i++ {
+			firstErrs = append(firstErrs, first.Ping())
+			secondErrs = append(secondErrs, second.Ping())
+		}
+
+		// Assert.
+		Ω(firstErrs).Should(Equal(secondErrs))
+		Ω(firstErrs).Should(ContainElement(ErrInjected))
+		Ω(firstErrs).Should(ContainElement(BeNil()))
+	})
+})
+
+var _ = Describe("Scheduler", func() {
+	var scheduler *memory.Scheduler
+
+	BeforeEach(func() {
+		scheduler = memory.NewScheduler()
+	})
+
+	It("Should forward events", func() {
+		// Arrange.
+		adapter := WrapScheduler(scheduler, &types.ChaosOptions{})
+		channel := make(types.EventsChannel, 1)
+		adapter.ListenForEvents(channel)
+
+		// Act.
+		scheduler.Start(group)
+
+		// Assert.
+		Eventually(channel).Should(Receive(Equal(&types.ServiceEvent{
+			ServiceID: "web_app.1",
+			IP:        "10.10.10.10",
+			Action:    types.ServiceStarted,
+		})))
+	})
+
+	It("Should drop events and close channel when wrapped adapter is closed", func() {
+		// Arrange.
+		adapter := WrapScheduler(scheduler, &types.ChaosOptions{DropRate: 1})
+		channel := make(types.EventsChannel, 1)
+		adapter.ListenForEvents(channel)
+
+		// Act.
+		scheduler.Start(group)
+		adapter.(*chaosScheduler).Close()
+
+		// Assert.
+		Eventually(channel).Should(BeClosed())
+	})
+
+	It("Should fail calls", func() {
+		// Arrange.
+		adapter := WrapScheduler(scheduler, &types.ChaosOptions{ErrorRate: 1})
+
+		// Act.
+		_, err := adapter.Services()
+
+		// Assert.
+		Ω(err).Should(Equal(ErrInjected))
+		Ω(adapter.ListenForEvents(make(types.EventsChannel))).Should(Equal(ErrInjected))
+	})
+})
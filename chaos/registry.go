@@ -0,0 +1,142 @@
+package chaos
+
+import (
+	"context"
+	"io"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WrapRegistry returns registry adapter injecting faults described by options into adapter calls.
+// Failed Register and Deregister calls pass the first options.PartialServices services of the group
+// to adapter before failing.
+func WrapRegistry(adapter types.RegistryAdapter, options *types.ChaosOptions) types.RegistryAdapter {
+	return &chaosRegistry{
+		adapter:  adapter,
+		injector: newInjector(options, "registry"),
+	}
+}
+
+type chaosRegistry struct {
+	adapter  types.RegistryAdapter
+	injector *injector
+}
+
+func (r *chaosRegistry) Ping() error {
+	return r.PingContext(context.Background())
+}
+
+// PingContext checks wrapped adapter passing ctx to it if it takes context into account.
+func (r *chaosRegistry) PingContext(ctx context.Context) error {
+	if err := r.injector.call("ping"); err != nil {
+		return err
+	}
+	return types.PingContext(ctx, r.adapter)
+}
+
+func (r *chaosRegistry) Services() ([]*types.ServiceGroup, error) {
+	return r.ServicesContext(context.Background())
+}
+
+// ServicesContext lists services of wrapped adapter passing ctx to it if it takes context into account.
+func (r *chaosRegistry) ServicesContext(ctx context.Context) ([]*types.ServiceGroup, error) {
+	if err := r.injector.call("services"); err != nil {
+		return nil, err
+	}
+	return types.ServicesContext(ctx, r.adapter)
+}
+
+func (r *chaosRegistry) Register(group *types.ServiceGroup) error {
+	return r.RegisterContext(context.Background(), group)
+}
+
+// RegisterContext registers group passing ctx to wrapped adapter if it takes context into account.
+func (r *chaosRegistry) RegisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	register := r.adapter.Register
+	if adapter, ok := r.adapter.(types.ContextRegistryAdapter); ok {
+		register = func(group *types.ServiceGroup) error {
+			return adapter.RegisterContext(ctx, group)
+		}
+	}
+
+	if err := r.injector.call("register"); err != nil {
+		r.partially(group, register)
+		return err
+	}
+	return register(group)
+}
+
+func (r *chaosRegistry) Deregister(group *types.ServiceGroup) error {
+	return r.DeregisterContext(context.Background(), group)
+}
+
+// DeregisterContext deregisters group passing ctx to wrapped adapter if it takes context into account.
+func (r *chaosRegistry) DeregisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	deregister := r.adapter.Deregister
+	if adapter, ok := r.adapter.(types.ContextRegistryAdapter); ok {
+		deregister = func(group *types.ServiceGroup) error {
+			return adapter.DeregisterContext(ctx, group)
+		}
+	}
+
+	if err := r.injector.call("deregister"); err != nil {
+		r.partially(group, deregister)
+		return err
+	}
+	return deregister(group)
+}
+
+func (r *chaosRegistry) AdvertiseAddr() (string, error) {
+	if err := r.injector.call("advertise-addr"); err != nil {
+		return "", err
+	}
+	return r.adapter.AdvertiseAddr()
+}
+
+// CleanupDanglingChecks cleans up checks of wrapped adapter if it registers them separately.
+func (r *chaosRegistry) CleanupDanglingChecks(ctx context.Context) error {
+	cleaner, ok := r.adapter.(types.RegistryChecksCleaner)
+	if !ok {
+		return nil
+	}
+	if err := r.injector.call("cleanup-checks"); err != nil {
+		return err
+	}
+	return cleaner.CleanupDanglingChecks(ctx)
+}
+
+// TracksReadiness tells whether wrapped adapter registers unhealthy services as not ready.
+func (r *chaosRegistry) TracksReadiness() bool {
+	return types.TracksReadiness(r.adapter)
+}
+
+// Close closes wrapped adapter if it holds any resources.
+func (r *chaosRegistry) Close() error {
+	if closer, ok := r.adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// partially applies action to the first services of the group before injected failure.
+func (r *chaosRegistry) partially(group *types.ServiceGroup, action func(*types.ServiceGroup) error) {
+	count := r.injector.options.PartialServices
+	if count == 0 {
+		return
+	}
+	if count > len(group.Services) {
+		count = len(group.Services)
+	}
+
+	log.WithFields(log.Fields{
+		"prefix": "chaos",
+		"group":  group.ID,
+	}).Warnf("Applying %d of %d services before failure", count, len(group.Services))
+	action(&types.ServiceGroup{
+		ID:       group.ID,
+		IP:       group.IP,
+		Services: group.Services[:count],
+	})
+}
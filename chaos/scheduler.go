@@ -0,0 +1,81 @@
+package chaos
+
+import (
+	"context"
+	"io"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WrapScheduler returns scheduler adapter injecting faults described by options into adapter calls.
+// Events are delayed the same way calls are and dropped with options.DropRate probability.
+func WrapScheduler(adapter types.SchedulerAdapter, options *types.ChaosOptions) types.SchedulerAdapter {
+	return &chaosScheduler{
+		adapter:  adapter,
+		injector: newInjector(options, "scheduler"),
+	}
+}
+
+type chaosScheduler struct {
+	adapter  types.SchedulerAdapter
+	injector *injector
+}
+
+func (s *chaosScheduler) Services() ([]*types.ServiceGroup, error) {
+	return s.ServicesContext(context.Background())
+}
+
+// ServicesContext lists services of wrapped adapter passing ctx to it if it takes context into account.
+func (s *chaosScheduler) ServicesContext(ctx context.Context) ([]*types.ServiceGroup, error) {
+	if err := s.injector.call("services"); err != nil {
+		return nil, err
+	}
+	return types.ServicesContext(ctx, s.adapter)
+}
+
+func (s *chaosScheduler) ListenForEvents(channel types.EventsChannel) error {
+	if err := s.injector.call("listen-for-events"); err != nil {
+		return err
+	}
+
+	events := make(types.EventsChannel, 5)
+	if err := s.adapter.ListenForEvents(events); err != nil {
+		return err
+	}
+
+	go func() {
+		for event := range events {
+			s.injector.delay()
+			if s.injector.chance(s.injector.options.DropRate) {
+				log.WithFields(log.Fields{
+					"prefix":  "chaos",
+					"service": event.ServiceID,
+					"action":  event.Action,
+				}).Warn("Dropping scheduler event")
+				continue
+			}
+			channel <- event
+		}
+		close(channel)
+	}()
+
+	return nil
+}
+
+// Close closes wrapped adapter if it holds any resources.
+func (s *chaosScheduler) Close() error {
+	if closer, ok := s.adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ActiveEndpoint reports active endpoint of wrapped adapter if it has any.
+func (s *chaosScheduler) ActiveEndpoint() string {
+	if reporter, ok := s.adapter.(types.SchedulerEndpointReporter); ok {
+		return reporter.ActiveEndpoint()
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/x-cray/marathon-registrator/audit"
+
+	consulAPI "github.com/hashicorp/consul/api"
+)
+
+// Layout of entry time in KV keys, sortable lexicographically.
+const auditKeyTimeLayout = "20060102T150405.000000000Z"
+
+// AuditSink stores audit entries in Consul KV, one key per entry under the prefix.
+type AuditSink struct {
+	adapter *Adapter
+	prefix  string
+}
+
+// AuditSink returns sink storing audit entries in KV of the agent under prefix.
+func (r *Adapter) AuditSink(prefix string) *AuditSink {
+	return &AuditSink{
+		adapter: r,
+		prefix:  strings.Trim(prefix, "/"),
+	}
+}
+
+func (s *AuditSink) kv() *consulAPI.KV {
+	s.adapter.RLock()
+	defer s.adapter.RUnlock()
+
+	return s.adapter.client.KV()
+}
+
+// Write stores entry under the key made of entry time, action and service ID.
+func (s *AuditSink) Write(entry *audit.Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf(
+		"%s/%s-%s-%s",
+		s.prefix,
+		entry.Time.UTC().Format(auditKeyTimeLayout),
+		entry.Action,
+		url.PathEscape(entry.ServiceID),
+	)
+	_, err = s.kv().Put(&consulAPI.KVPair{Key: key, Value: value}, nil)
+	return err
+}
+
+// Entries returns all entries stored under the prefix.
+func (s *AuditSink) Entries() ([]*audit.Entry, error) {
+	pairs, _, err := s.kv().List(s.prefix+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*audit.Entry
+	for _, pair := range pairs {
+		entry := &audit.Entry{}
+		if err := json.Unmarshal(pair.Value, entry); err != nil {
+			return nil, fmt.Errorf("%s: %v", pair.Key, err)
+		}
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
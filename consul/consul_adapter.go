@@ -1,51 +1,280 @@
 package consul
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/x-cray/marathon-registrator/tracing"
 	"github.com/x-cray/marathon-registrator/types"
 
 	log "github.com/Sirupsen/logrus"
 	consulAPI "github.com/hashicorp/consul/api"
 )
 
+var (
+	// Interval between checks of ACL token file modification.
+	tokenFileCheckInterval = 10 * time.Second
+)
+
 type Adapter struct {
-	client *consulAPI.Client
-	dryRun bool
+	sync.RWMutex
+
+	client        *consulAPI.Client
+	config        *consulAPI.Config
+	tokenFile     string
+	tokenModified time.Time
+	dryRun        bool
+
+	// Token file watch is stopped once done is closed by Close.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Health checks registered for each service ID.
+	checksLock sync.Mutex
+	checks     map[string][]*types.ServiceHealthCheck
+}
+
+// checkNotes holds check settings which agent does not report back in check definition. They are kept
+// in check notes, so that checks registered before restart are not considered changed.
+type checkNotes struct {
+	Script string `json:",omitempty"`
+	TTL    string `json:",omitempty"`
 }
 
-func New(uri *url.URL, dryRun bool) (*Adapter, error) {
+// globalManagementPolicyID is the ID of builtin Consul policy granting every permission.
+const globalManagementPolicyID = "00000000-0000-0000-0000-000000000001"
+
+func New(uri *url.URL, options *types.ConsulOptions, dryRun bool) (*Adapter, error) {
 	config := consulAPI.DefaultConfig()
 	config.Address = uri.Host
 	config.Scheme = uri.Scheme
 
-	log.WithField("prefix", "consul").Infof("Connecting to Consul at %v", uri)
+	if options == nil {
+		options = &types.ConsulOptions{}
+	}
+
+	config.Token = options.Token
+	config.Datacenter = options.Datacenter
+	config.Namespace = options.Namespace
+	config.Partition = options.Partition
+	config.TLSConfig = consulAPI.TLSConfig{
+		Address:            uri.Hostname(),
+		CAFile:             options.CAFile,
+		CertFile:           options.CertFile,
+		KeyFile:            options.KeyFile,
+		InsecureSkipVerify: options.TLSSkipVerify,
+	}
+
+	adapter := &Adapter{
+		config:    config,
+		tokenFile: options.TokenFile,
+		dryRun:    dryRun,
+		done:      make(chan struct{}),
+	}
+
+	if adapter.tokenFile != "" {
+		if _, err := adapter.reloadToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":     "consul",
+		"datacenter": config.Datacenter,
+		"namespace":  config.Namespace,
+		"partition":  config.Partition,
+	}).Infof("Connecting to Consul at %v", uri)
+	httpClient, err := consulAPI.NewHttpClient(config.Transport, config.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = tracing.Transport(httpClient.Transport)
+	config.HttpClient = httpClient
+
 	client, err := consulAPI.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Adapter{
-		client: client,
-		dryRun: dryRun,
-	}, nil
+	adapter.client = client
+	if adapter.tokenFile != "" {
+		go adapter.watchTokenFile(tokenFileCheckInterval)
+	}
+
+	return adapter, nil
+}
+
+// reloadToken reads ACL token from token file if it was modified since the last read.
+func (r *Adapter) reloadToken() (bool, error) {
+	info, err := os.Stat(r.tokenFile)
+	if err != nil {
+		return false, err
+	}
+
+	if !info.ModTime().After(r.tokenModified) {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(r.tokenFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.config.Token = strings.TrimSpace(string(data))
+	r.tokenModified = info.ModTime()
+
+	return true, nil
+}
+
+// watchTokenFile periodically checks the token file and recreates Consul client once the token changes.
+// It returns once the adapter is closed.
+func (r *Adapter) watchTokenFile(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		r.Lock()
+		changed, err := r.reloadToken()
+		if err == nil && changed {
+			var client *consulAPI.Client
+			client, err = consulAPI.NewClient(r.config)
+			if err == nil {
+				r.client = client
+				log.WithFields(log.Fields{
+					"prefix": "consul",
+					"file":   r.tokenFile,
+				}).Info("Reloaded ACL token")
+			}
+		}
+		r.Unlock()
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"prefix": "consul",
+				"file":   r.tokenFile,
+				"err":    err,
+			}).Warn("Unable to reload ACL token")
+		}
+	}
+}
+
+// Close stops watching ACL token file.
+func (r *Adapter) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+func (r *Adapter) agent() *consulAPI.Agent {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.client.Agent()
 }
 
 // Ping will try to connect to consul by attempting to retrieve the current leader.
+// When ACL token is configured, it also verifies that the token is valid.
 func (r *Adapter) Ping() error {
-	status := r.client.Status()
-	leader, err := status.Leader()
+	return r.PingContext(context.Background())
+}
+
+// PingContext checks Consul agent passing ctx to its requests.
+func (r *Adapter) PingContext(ctx context.Context) error {
+	r.RLock()
+	client := r.client
+	token := r.config.Token
+	r.RUnlock()
+
+	options := (&consulAPI.QueryOptions{}).WithContext(ctx)
+	leader, err := client.Status().LeaderWithQueryOptions(options)
 	if err != nil {
 		return err
 	}
 	log.WithField("prefix", "consul").Debugf("Current leader %s", leader)
 
+	if token == "" {
+		return nil
+	}
+
+	self, _, err := client.ACL().TokenReadSelf(options)
+	if err != nil {
+		return fmt.Errorf("Consul ACL token is not valid: %v", err)
+	}
+
+	// Policy rules could only be evaluated by Consul itself, which has no public API for that,
+	// so service:write permission is only confirmed for management tokens.
+	if isManagementToken(self) {
+		log.WithField("prefix", "consul").Debug("Consul ACL token is a management one, service:write permission is granted")
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"prefix":   "consul",
+		"accessor": self.AccessorID,
+	}).Warn("Skipping Consul ACL token service:write permission check, registration failures are reported on sync")
+
 	return nil
 }
 
+// isManagementToken tells whether the token is granted every permission.
+func isManagementToken(token *consulAPI.ACLToken) bool {
+	if token.Type == "management" {
+		return true
+	}
+	for _, policy := range token.Policies {
+		if policy.ID == globalManagementPolicyID {
+			return true
+		}
+	}
+	return false
+}
+
+func checkID(service *types.Service, check *types.ServiceHealthCheck) string {
+	return fmt.Sprintf("%s:%s", service.ID, check.ID)
+}
+
+func checkRegistration(service *types.Service, check *types.ServiceHealthCheck) *consulAPI.AgentCheckRegistration {
+	registration := new(consulAPI.AgentCheckRegistration)
+	registration.ID = checkID(service, check)
+	registration.Name = fmt.Sprintf("Service '%s' check (%s)", service.Name, check.ID)
+	registration.ServiceID = service.ID
+	registration.HTTP = check.HTTP
+	registration.TCP = check.TCP
+	registration.TTL = check.TTL
+	registration.Interval = check.Interval
+	registration.Timeout = check.Timeout
+	if check.Script != "" {
+		registration.Args = []string{"sh", "-c", check.Script}
+	}
+	if check.Script != "" || check.TTL != "" {
+		notes, _ := json.Marshal(&checkNotes{Script: check.Script, TTL: check.TTL})
+		registration.Notes = string(notes)
+	}
+
+	return registration
+}
+
 func (r *Adapter) Register(group *types.ServiceGroup) error {
+	return r.RegisterContext(context.Background(), group)
+}
+
+// RegisterContext registers services of the group logging correlation ID carried by ctx.
+func (r *Adapter) RegisterContext(ctx context.Context, group *types.ServiceGroup) error {
 	for _, service := range group.Services {
 		if r.dryRun {
 			log.WithFields(log.Fields{
@@ -54,7 +283,7 @@ func (r *Adapter) Register(group *types.ServiceGroup) error {
 				"id":     service.ID,
 				"name":   service.Name,
 				"port":   service.ExposedPort,
-			}).Info("[dry-run] Would register service")
+			}).WithFields(types.ContextFields(ctx)).Info("[dry-run] Would register service")
 			continue
 		}
 
@@ -64,16 +293,29 @@ func (r *Adapter) Register(group *types.ServiceGroup) error {
 			"id":     service.ID,
 			"name":   service.Name,
 			"port":   service.ExposedPort,
-		}).Info("Registering service")
+		}).WithFields(types.ContextFields(ctx)).Info("Registering service")
 
 		registration := new(consulAPI.AgentServiceRegistration)
 		registration.Address = group.IP
 		registration.ID = service.ID
 		registration.Name = service.Name
 		registration.Tags = service.Tags
+		registration.Meta = service.Meta
+		registration.EnableTagOverride = service.EnableTagOverride
 		registration.Port = service.ExposedPort
+		if service.Weights != nil {
+			registration.Weights = &consulAPI.AgentWeights{
+				Passing: service.Weights.Passing,
+				Warning: service.Weights.Warning,
+			}
+		}
+
+		err := r.agent().ServiceRegisterOpts(registration, consulAPI.ServiceRegisterOpts{}.WithContext(ctx))
+		if err != nil {
+			return err
+		}
 
-		err := r.client.Agent().ServiceRegister(registration)
+		err = r.registerChecks(ctx, service)
 		if err != nil {
 			return err
 		}
@@ -82,7 +324,149 @@ func (r *Adapter) Register(group *types.ServiceGroup) error {
 	return nil
 }
 
+// registerChecks registers service health checks and removes the ones previously registered but no longer defined.
+func (r *Adapter) registerChecks(ctx context.Context, service *types.Service) error {
+	r.checksLock.Lock()
+	defer r.checksLock.Unlock()
+
+	options := (&consulAPI.QueryOptions{}).WithContext(ctx)
+
+	for _, check := range service.HealthChecks {
+		log.WithFields(log.Fields{
+			"prefix":  "consul",
+			"id":      service.ID,
+			"checkId": checkID(service, check),
+		}).Debug("Registering service check")
+
+		err := r.agent().CheckRegisterOpts(checkRegistration(service, check), options)
+		if err != nil {
+			return err
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, check := range service.HealthChecks {
+		current[check.ID] = true
+	}
+	for _, check := range r.checks[service.ID] {
+		if current[check.ID] {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"prefix":  "consul",
+			"id":      service.ID,
+			"checkId": checkID(service, check),
+		}).Debug("Deregistering stale service check")
+
+		err := r.agent().CheckDeregisterOpts(checkID(service, check), options)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.checks == nil {
+		r.checks = make(map[string][]*types.ServiceHealthCheck)
+	}
+	if len(service.HealthChecks) > 0 {
+		r.checks[service.ID] = service.HealthChecks
+	} else {
+		delete(r.checks, service.ID)
+	}
+
+	return nil
+}
+
+// deregisterChecks removes all health checks registered for the service, including ones registered before restart.
+func (r *Adapter) deregisterChecks(ctx context.Context, service *types.Service) error {
+	r.checksLock.Lock()
+	defer r.checksLock.Unlock()
+
+	options := (&consulAPI.QueryOptions{}).WithContext(ctx)
+	checks, err := r.agent().ChecksWithFilterOpts("", options)
+	if err != nil {
+		return err
+	}
+
+	for id, check := range checks {
+		if check.ServiceID != service.ID {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"prefix":  "consul",
+			"id":      service.ID,
+			"checkId": id,
+		}).Debug("Deregistering service check")
+
+		err := r.agent().CheckDeregisterOpts(id, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(r.checks, service.ID)
+
+	return nil
+}
+
+// CleanupDanglingChecks removes checks bound to services which no longer exist on the agent.
+func (r *Adapter) CleanupDanglingChecks(ctx context.Context) error {
+	r.checksLock.Lock()
+	defer r.checksLock.Unlock()
+
+	options := (&consulAPI.QueryOptions{}).WithContext(ctx)
+	services, err := r.agent().ServicesWithFilterOpts("", options)
+	if err != nil {
+		return err
+	}
+
+	checks, err := r.agent().ChecksWithFilterOpts("", options)
+	if err != nil {
+		return err
+	}
+
+	for id, check := range checks {
+		if check.ServiceID == "" || services[check.ServiceID] != nil {
+			continue
+		}
+
+		if r.dryRun {
+			log.WithFields(log.Fields{
+				"prefix":    "consul",
+				"serviceId": check.ServiceID,
+				"checkId":   id,
+			}).Info("[dry-run] Would deregister dangling check")
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"prefix":    "consul",
+			"serviceId": check.ServiceID,
+			"checkId":   id,
+		}).Info("Deregistering dangling check")
+
+		err := r.agent().CheckDeregisterOpts(id, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for serviceID := range r.checks {
+		if services[serviceID] == nil {
+			delete(r.checks, serviceID)
+		}
+	}
+
+	return nil
+}
+
 func (r *Adapter) Deregister(group *types.ServiceGroup) error {
+	return r.DeregisterContext(context.Background(), group)
+}
+
+// DeregisterContext deregisters services of the group logging correlation ID carried by ctx.
+func (r *Adapter) DeregisterContext(ctx context.Context, group *types.ServiceGroup) error {
 	for _, service := range group.Services {
 		if r.dryRun {
 			log.WithFields(log.Fields{
@@ -91,7 +475,7 @@ func (r *Adapter) Deregister(group *types.ServiceGroup) error {
 				"id":     service.ID,
 				"name":   service.Name,
 				"port":   service.ExposedPort,
-			}).Info("[dry-run] Would deregister service")
+			}).WithFields(types.ContextFields(ctx)).Info("[dry-run] Would deregister service")
 			continue
 		}
 
@@ -101,9 +485,14 @@ func (r *Adapter) Deregister(group *types.ServiceGroup) error {
 			"id":     service.ID,
 			"name":   service.Name,
 			"port":   service.ExposedPort,
-		}).Info("Deregistering service")
+		}).WithFields(types.ContextFields(ctx)).Info("Deregistering service")
+
+		err := r.deregisterChecks(ctx, service)
+		if err != nil {
+			return err
+		}
 
-		err := r.client.Agent().ServiceDeregister(service.ID)
+		err = r.agent().ServiceDeregisterOpts(service.ID, (&consulAPI.QueryOptions{}).WithContext(ctx))
 		if err != nil {
 			return err
 		}
@@ -113,7 +502,7 @@ func (r *Adapter) Deregister(group *types.ServiceGroup) error {
 }
 
 func (r *Adapter) AdvertiseAddr() (string, error) {
-	info, err := r.client.Agent().Self()
+	info, err := r.agent().Self()
 	if err != nil {
 		return "", err
 	}
@@ -138,8 +527,78 @@ func groupID(serviceID string) string {
 	return serviceID
 }
 
+// serviceWeights converts Consul weights omitting the defaults Consul assigns to services registered without weights.
+func serviceWeights(weights consulAPI.AgentWeights) *types.ServiceWeights {
+	if (weights.Passing == 0 || weights.Passing == 1) && (weights.Warning == 0 || weights.Warning == 1) {
+		return nil
+	}
+
+	return &types.ServiceWeights{
+		Passing: weights.Passing,
+		Warning: weights.Warning,
+	}
+}
+
+// serviceChecks returns health checks of the service. Definitions of checks registered by this adapter instance
+// are returned as is, others are restored from agent check definitions (script and TTL ones only partially).
+func (r *Adapter) serviceChecks(serviceID string, checks map[string]*consulAPI.AgentCheck) []*types.ServiceHealthCheck {
+	r.checksLock.Lock()
+	tracked, ok := r.checks[serviceID]
+	r.checksLock.Unlock()
+	if ok {
+		return tracked
+	}
+
+	var result []*types.ServiceHealthCheck
+	prefix := serviceID + ":"
+	for id, check := range checks {
+		if check.ServiceID != serviceID || !strings.HasPrefix(id, prefix) {
+			continue
+		}
+
+		serviceCheck := &types.ServiceHealthCheck{
+			ID:   strings.TrimPrefix(id, prefix),
+			HTTP: check.Definition.HTTP,
+			TCP:  check.Definition.TCP,
+		}
+		if check.Type != "ttl" && check.Definition.IntervalDuration > 0 {
+			serviceCheck.Interval = check.Definition.IntervalDuration.String()
+		}
+		if check.Definition.TimeoutDuration > 0 {
+			serviceCheck.Timeout = check.Definition.TimeoutDuration.String()
+		}
+		notes := &checkNotes{}
+		if json.Unmarshal([]byte(check.Notes), notes) == nil {
+			serviceCheck.Script = notes.Script
+			serviceCheck.TTL = notes.TTL
+		}
+		result = append(result, serviceCheck)
+	}
+
+	sort.Sort(checksByID(result))
+
+	return result
+}
+
+type checksByID []*types.ServiceHealthCheck
+
+func (c checksByID) Len() int           { return len(c) }
+func (c checksByID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c checksByID) Less(i, j int) bool { return c[i].ID < c[j].ID }
+
 func (r *Adapter) Services() ([]*types.ServiceGroup, error) {
-	services, err := r.client.Agent().Services()
+	return r.ServicesContext(context.Background())
+}
+
+// ServicesContext lists services registered on the agent passing ctx to its requests.
+func (r *Adapter) ServicesContext(ctx context.Context) ([]*types.ServiceGroup, error) {
+	options := (&consulAPI.QueryOptions{}).WithContext(ctx)
+	services, err := r.agent().ServicesWithFilterOpts("", options)
+	if err != nil {
+		return nil, err
+	}
+
+	checks, err := r.agent().ChecksWithFilterOpts("", options)
 	if err != nil {
 		return nil, err
 	}
@@ -152,10 +611,14 @@ func (r *Adapter) Services() ([]*types.ServiceGroup, error) {
 			IP: v.Address,
 			Services: []*types.Service{
 				&types.Service{
-					ID:          v.ID,
-					Name:        v.Service,
-					Tags:        v.Tags,
-					ExposedPort: v.Port,
+					ID:                v.ID,
+					Name:              v.Service,
+					Tags:              v.Tags,
+					Meta:              v.Meta,
+					EnableTagOverride: v.EnableTagOverride,
+					Weights:           serviceWeights(v.Weights),
+					HealthChecks:      r.serviceChecks(v.ID, checks),
+					ExposedPort:       v.Port,
 				},
 			},
 		}
@@ -0,0 +1,621 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/audit"
+	"github.com/x-cray/marathon-registrator/consul/consultest"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestConsulAdapter(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Consul Adapter Suite")
+}
+
+func newAdapter(server *consultest.Server, options *types.ConsulOptions, dryRun bool) *Adapter {
+	uri, err := url.Parse(server.URL)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	adapter, err := New(uri, options, dryRun)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return adapter
+}
+
+var _ = Describe("ConsulAdapter", func() {
+	var (
+		server        *consultest.Server
+		consulAdapter *Adapter
+	)
+
+	dbGroup := func() *types.ServiceGroup {
+		return &types.ServiceGroup{
+			ID: "db_server_2c033893-7993-11e5-8878-56847afe9799",
+			IP: "10.10.10.10",
+			Services: []*types.Service{
+				{
+					ID:          "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+					Name:        "db-server",
+					Tags:        []string{"primary"},
+					Meta:        map[string]string{types.SourceMetaKey: "marathon"},
+					Weights:     &types.ServiceWeights{Passing: 10, Warning: 1},
+					ExposedPort: 31045,
+					HealthChecks: []*types.ServiceHealthCheck{
+						{ID: "tcp", TCP: "10.10.10.10:31045", Interval: "10s", Timeout: "2s"},
+						{ID: "ttl", TTL: "30s"},
+					},
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		server = consultest.NewServer("10.10.10.10")
+		consulAdapter = newAdapter(server, nil, false)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Ping()", func() {
+		It("Should succeed when agent has leader", func() {
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should forward leader status errors", func() {
+			// Arrange.
+			server.Fail("/v1/status/leader", http.StatusInternalServerError)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should accept management ACL token", func() {
+			// Arrange.
+			server.RequireToken("secret", true)
+			consulAdapter = newAdapter(server, &types.ConsulOptions{Token: "secret"}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should fail with invalid ACL token", func() {
+			// Arrange.
+			server.RequireToken("secret", true)
+			consulAdapter = newAdapter(server, &types.ConsulOptions{Token: "wrong"}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should skip permissions check of ACL token which is not a management one", func() {
+			// Arrange.
+			server.RequireToken("secret", false)
+			consulAdapter = newAdapter(server, &types.ConsulOptions{Token: "secret"}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should forward ACL token errors", func() {
+			// Arrange.
+			server.RequireToken("secret", true)
+			server.Fail("/v1/acl/token/self", http.StatusInternalServerError)
+			consulAdapter = newAdapter(server, &types.ConsulOptions{Token: "secret"}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("not valid")))
+		})
+	})
+
+	Describe("ACL token file", func() {
+		var (
+			dir       string
+			tokenFile string
+		)
+
+		writeToken := func(token string, modified time.Time) {
+			Ω(ioutil.WriteFile(tokenFile, []byte(token+"\n"), 0600)).Should(Succeed())
+			Ω(os.Chtimes(tokenFile, modified, modified)).Should(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "consul")
+			Ω(err).ShouldNot(HaveOccurred())
+			tokenFile = filepath.Join(dir, "token")
+			tokenFileCheckInterval = 10 * time.Millisecond
+			server.RequireToken("secret", true)
+		})
+
+		AfterEach(func() {
+			consulAdapter.Close()
+			tokenFileCheckInterval = 10 * time.Second
+			os.RemoveAll(dir)
+		})
+
+		It("Should read ACL token from file", func() {
+			// Arrange.
+			writeToken("secret", time.Now())
+			consulAdapter = newAdapter(server, &types.ConsulOptions{TokenFile: tokenFile}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should fail when token file is missing", func() {
+			// Arrange.
+			uri, _ := url.Parse(server.URL)
+
+			// Act.
+			_, err := New(uri, &types.ConsulOptions{TokenFile: tokenFile}, false)
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should reload ACL token once file changes", func() {
+			// Arrange.
+			writeToken("expired", time.Now().Add(-time.Hour))
+			consulAdapter = newAdapter(server, &types.ConsulOptions{TokenFile: tokenFile}, false)
+			Ω(consulAdapter.Ping()).ShouldNot(Succeed())
+
+			// Act.
+			writeToken("secret", time.Now())
+
+			// Assert.
+			Eventually(consulAdapter.Ping).Should(Succeed())
+		})
+
+		It("Should stop watching token file once closed", func() {
+			// Arrange.
+			writeToken("expired", time.Now().Add(-time.Hour))
+			consulAdapter = newAdapter(server, &types.ConsulOptions{TokenFile: tokenFile}, false)
+
+			// Act.
+			consulAdapter.Close()
+			writeToken("secret", time.Now())
+
+			// Assert.
+			Consistently(consulAdapter.Ping, "100ms").ShouldNot(Succeed())
+		})
+	})
+
+	Describe("TLS", func() {
+		var (
+			tlsServer *consultest.Server
+			dir       string
+		)
+
+		BeforeEach(func() {
+			tlsServer = consultest.NewTLSServer("10.10.10.10")
+			var err error
+			dir, err = ioutil.TempDir("", "consul")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+			os.RemoveAll(dir)
+		})
+
+		It("Should verify agent certificate with CA file", func() {
+			// Arrange.
+			caFile := filepath.Join(dir, "ca.pem")
+			certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+			Ω(ioutil.WriteFile(caFile, certificate, 0644)).Should(Succeed())
+			consulAdapter = newAdapter(tlsServer, &types.ConsulOptions{CAFile: caFile}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should reject agent certificate signed by unknown authority", func() {
+			// Arrange.
+			consulAdapter = newAdapter(tlsServer, nil, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("certificate")))
+		})
+
+		It("Should skip certificate verification when requested", func() {
+			// Arrange.
+			consulAdapter = newAdapter(tlsServer, &types.ConsulOptions{TLSSkipVerify: true}, false)
+
+			// Act.
+			err := consulAdapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should fail with missing CA file", func() {
+			// Arrange.
+			uri, _ := url.Parse(tlsServer.URL)
+
+			// Act.
+			_, err := New(uri, &types.ConsulOptions{CAFile: filepath.Join(dir, "missing.pem")}, false)
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("AdvertiseAddr()", func() {
+		It("Should return agent advertise address", func() {
+			// Act.
+			addr, err := consulAdapter.AdvertiseAddr()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(addr).Should(Equal("10.10.10.10"))
+		})
+
+		It("Should forward agent errors", func() {
+			// Arrange.
+			server.FailOnce("/v1/agent/self", http.StatusServiceUnavailable)
+
+			// Act.
+			_, err := consulAdapter.AdvertiseAddr()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Register()", func() {
+		It("Should register services with their checks", func() {
+			// Act.
+			err := consulAdapter.Register(dbGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			services := server.Services()
+			Ω(services).Should(HaveLen(1))
+			service := services["db_server_2c033893-7993-11e5-8878-56847afe9799:27017"]
+			Ω(service.Service).Should(Equal("db-server"))
+			Ω(service.Address).Should(Equal("10.10.10.10"))
+			Ω(service.Port).Should(Equal(31045))
+			Ω(service.Tags).Should(Equal([]string{"primary"}))
+			Ω(service.Meta).Should(HaveKeyWithValue(types.SourceMetaKey, "marathon"))
+			Ω(service.Weights).Should(Equal(consultest.Weights{Passing: 10, Warning: 1}))
+
+			checks := server.Checks()
+			Ω(checks).Should(HaveLen(2))
+			Ω(checks["db_server_2c033893-7993-11e5-8878-56847afe9799:27017:tcp"].Definition.TCP).Should(Equal("10.10.10.10:31045"))
+			Ω(checks["db_server_2c033893-7993-11e5-8878-56847afe9799:27017:ttl"].Type).Should(Equal("ttl"))
+		})
+
+		It("Should remove checks no longer defined upon re-registration", func() {
+			// Arrange.
+			group := dbGroup()
+			Ω(consulAdapter.Register(group)).Should(Succeed())
+			group.Services[0].HealthChecks = group.Services[0].HealthChecks[:1]
+
+			// Act.
+			err := consulAdapter.Register(group)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.Checks()).Should(HaveLen(1))
+			Ω(server.Checks()).Should(HaveKey("db_server_2c033893-7993-11e5-8878-56847afe9799:27017:tcp"))
+		})
+
+		It("Should forward registration errors", func() {
+			// Arrange.
+			server.Fail("/v1/agent/service/register", http.StatusInternalServerError)
+
+			// Act.
+			err := consulAdapter.Register(dbGroup())
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+			Ω(server.Services()).Should(BeEmpty())
+		})
+
+		It("Should tolerate agent latency", func() {
+			// Arrange.
+			server.SetLatency(50 * time.Millisecond)
+			started := time.Now()
+
+			// Act.
+			err := consulAdapter.Register(dbGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(time.Since(started)).Should(BeNumerically(">=", 150*time.Millisecond))
+			Ω(server.Services()).Should(HaveLen(1))
+		})
+
+		It("Should log correlation ID of the operation", func() {
+			// Arrange.
+			var output bytes.Buffer
+			log.SetOutput(&output)
+			log.SetFormatter(&log.JSONFormatter{})
+			log.SetLevel(log.InfoLevel)
+			defer func() {
+				log.SetOutput(os.Stderr)
+				log.SetFormatter(&log.TextFormatter{})
+				log.SetLevel(log.FatalLevel)
+			}()
+			ctx := types.WithCorrelationID(context.Background(), "0123456789abcdef")
+
+			// Act.
+			err := consulAdapter.RegisterContext(ctx, dbGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(output.String()).Should(ContainSubstring(`"correlation_id":"0123456789abcdef"`))
+			Ω(output.String()).Should(ContainSubstring(`"msg":"Registering service"`))
+		})
+	})
+
+	Describe("Deregister()", func() {
+		It("Should deregister services along with their checks", func() {
+			// Arrange.
+			Ω(consulAdapter.Register(dbGroup())).Should(Succeed())
+
+			// Act.
+			err := consulAdapter.Deregister(dbGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.Services()).Should(BeEmpty())
+			Ω(server.Checks()).Should(BeEmpty())
+		})
+
+		It("Should remove checks registered before restart", func() {
+			// Arrange.
+			Ω(consulAdapter.Register(dbGroup())).Should(Succeed())
+			consulAdapter = newAdapter(server, nil, false)
+
+			// Act.
+			err := consulAdapter.Deregister(dbGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.Requests()).Should(ContainElement("PUT /v1/agent/check/deregister/db_server_2c033893-7993-11e5-8878-56847afe9799:27017:tcp"))
+			Ω(server.Services()).Should(BeEmpty())
+		})
+
+		It("Should forward deregistration errors", func() {
+			// Act.
+			err := consulAdapter.Deregister(dbGroup())
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Services()", func() {
+		It("Should convert agent services to service groups", func() {
+			// Arrange.
+			server.AddService(consultest.Service{
+				ID:      "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+				Service: "app-server",
+				Address: "10.10.10.10",
+				Port:    31046,
+				Weights: consultest.Weights{Passing: 1, Warning: 1},
+			})
+			server.AddCheck(consultest.Check{
+				CheckID:   "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000:marathon-0",
+				ServiceID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000",
+				Type:      "http",
+				Definition: consultest.CheckDefinition{
+					HTTP:     "http://10.10.10.10:31046/health",
+					Interval: "10s",
+					Timeout:  "5s",
+				},
+			})
+
+			// Act.
+			groups, err := consulAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(HaveLen(1))
+			Ω(groups[0].ID).Should(Equal("app_server_5877d4d2-7b4b-11e5-b945-56847afe9799"))
+			Ω(groups[0].IP).Should(Equal("10.10.10.10"))
+			service := groups[0].Services[0]
+			Ω(service.Name).Should(Equal("app-server"))
+			Ω(service.ExposedPort).Should(Equal(31046))
+			Ω(service.Weights).Should(BeNil())
+			Ω(service.HealthChecks).Should(Equal([]*types.ServiceHealthCheck{
+				{ID: "marathon-0", HTTP: "http://10.10.10.10:31046/health", Interval: "10s", Timeout: "5s"},
+			}))
+		})
+
+		It("Should return registered check definitions as is", func() {
+			// Arrange.
+			group := dbGroup()
+			Ω(consulAdapter.Register(group)).Should(Succeed())
+
+			// Act.
+			groups, err := consulAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(HaveLen(1))
+			Ω(groups[0].Services[0].Weights).Should(Equal(group.Services[0].Weights))
+			Ω(groups[0].Services[0].HealthChecks).Should(Equal(group.Services[0].HealthChecks))
+		})
+
+		It("Should restore script and TTL checks registered before restart", func() {
+			// Arrange.
+			group := dbGroup()
+			group.Services[0].HealthChecks = append(group.Services[0].HealthChecks, &types.ServiceHealthCheck{
+				ID:       "script",
+				Script:   "check-db 10.10.10.10 31045",
+				Interval: "30s",
+			})
+			Ω(consulAdapter.Register(group)).Should(Succeed())
+
+			// Act.
+			groups, err := newAdapter(server, nil, false).Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(HaveLen(1))
+			Ω(groups[0].Services[0].HealthChecks).Should(Equal([]*types.ServiceHealthCheck{
+				{ID: "script", Script: "check-db 10.10.10.10 31045", Interval: "30s"},
+				{ID: "tcp", TCP: "10.10.10.10:31045", Interval: "10s", Timeout: "2s"},
+				{ID: "ttl", TTL: "30s"},
+			}))
+		})
+
+		It("Should forward agent errors", func() {
+			// Arrange.
+			server.Fail("/v1/agent/checks", http.StatusInternalServerError)
+
+			// Act.
+			_, err := consulAdapter.Services()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("CleanupDanglingChecks()", func() {
+		It("Should deregister checks of absent services", func() {
+			// Arrange.
+			Ω(consulAdapter.Register(dbGroup())).Should(Succeed())
+			server.AddCheck(consultest.Check{CheckID: "gone:3000:tcp", ServiceID: "gone:3000", Type: "tcp"})
+			server.AddCheck(consultest.Check{CheckID: "serfHealth", Type: "serf"})
+
+			// Act.
+			err := consulAdapter.CleanupDanglingChecks(context.Background())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			checks := server.Checks()
+			Ω(checks).Should(HaveLen(3))
+			Ω(checks).ShouldNot(HaveKey("gone:3000:tcp"))
+		})
+	})
+
+	Describe("AuditSink()", func() {
+		It("Should store entries under the prefix and read them back", func() {
+			// Arrange.
+			sink := consulAdapter.AuditSink("/registrator/audit/")
+			first := &audit.Entry{
+				Time:      time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC),
+				Action:    "register",
+				ServiceID: "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+				Outcome:   audit.OutcomeSuccess,
+			}
+			second := &audit.Entry{
+				Time:      time.Date(2016, 3, 1, 10, 5, 0, 0, time.UTC),
+				Action:    "deregister",
+				ServiceID: "db_server_2c033893-7993-11e5-8878-56847afe9799:27017",
+				Outcome:   audit.OutcomeFailure,
+			}
+
+			// Act.
+			firstErr := sink.Write(first)
+			secondErr := sink.Write(second)
+			entries, err := sink.Entries()
+
+			// Assert.
+			Ω(firstErr).ShouldNot(HaveOccurred())
+			Ω(secondErr).ShouldNot(HaveOccurred())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.KV()).Should(HaveKey("registrator/audit/20160301T100000.000000000Z-register-db_server_2c033893-7993-11e5-8878-56847afe9799:27017"))
+			Ω(entries).Should(Equal([]*audit.Entry{first, second}))
+		})
+
+		It("Should return no entries when nothing is stored", func() {
+			// Act.
+			entries, err := consulAdapter.AuditSink("registrator/audit").Entries()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(BeEmpty())
+		})
+
+		It("Should forward KV errors", func() {
+			// Arrange.
+			server.Fail("/v1/kv/", http.StatusInternalServerError)
+
+			// Act.
+			err := consulAdapter.AuditSink("registrator/audit").Write(&audit.Entry{Action: "register"})
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Dry run", func() {
+		BeforeEach(func() {
+			consulAdapter = newAdapter(server, nil, true)
+		})
+
+		It("Should not change agent state", func() {
+			// Arrange.
+			server.AddService(consultest.Service{ID: "db_server_2c033893-7993-11e5-8878-56847afe9799:27017", Service: "db-server"})
+			server.AddCheck(consultest.Check{CheckID: "gone:3000:tcp", ServiceID: "gone:3000", Type: "tcp"})
+
+			// Act.
+			registerErr := consulAdapter.Register(&types.ServiceGroup{
+				ID:       "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799",
+				IP:       "10.10.10.10",
+				Services: []*types.Service{{ID: "app_server_5877d4d2-7b4b-11e5-b945-56847afe9799:3000", Name: "app-server"}},
+			})
+			deregisterErr := consulAdapter.Deregister(dbGroup())
+			cleanupErr := consulAdapter.CleanupDanglingChecks(context.Background())
+
+			// Assert.
+			Ω(registerErr).ShouldNot(HaveOccurred())
+			Ω(deregisterErr).ShouldNot(HaveOccurred())
+			Ω(cleanupErr).ShouldNot(HaveOccurred())
+			Ω(server.Services()).Should(HaveLen(1))
+			Ω(server.Checks()).Should(HaveLen(1))
+			for _, request := range server.Requests() {
+				Ω(request).Should(HavePrefix("GET "))
+			}
+		})
+	})
+})
@@ -0,0 +1,528 @@
+// Package consultest provides in-memory Consul agent for integration tests.
+// It serves the excerpt of Consul agent API used by registrator: agent info, services and checks
+// registration, leader status, ACL token checks and KV store, with injectable failures and latency.
+package consultest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service is the service registered on the agent.
+type Service struct {
+	ID                string
+	Service           string
+	Tags              []string
+	Meta              map[string]string
+	Port              int
+	Address           string
+	EnableTagOverride bool
+	Weights           Weights
+}
+
+// Weights are service instance weights in DNS SRV responses.
+type Weights struct {
+	Passing int
+	Warning int
+}
+
+// Check is the health check registered on the agent.
+type Check struct {
+	Node        string
+	CheckID     string
+	Name        string
+	Status      string
+	ServiceID   string
+	ServiceName string
+	Type        string
+	Notes       string
+	Definition  CheckDefinition
+}
+
+// CheckDefinition is the probe performed by health check.
+type CheckDefinition struct {
+	HTTP     string `json:",omitempty"`
+	TCP      string `json:",omitempty"`
+	Interval string `json:",omitempty"`
+	Timeout  string `json:",omitempty"`
+}
+
+type failure struct {
+	status int
+	once   bool
+}
+
+// Server is the fake Consul agent.
+type Server struct {
+	*httptest.Server
+
+	lock          sync.Mutex
+	advertiseAddr string
+	token         string
+	denyWrite     bool
+	services      map[string]*Service
+	checks        map[string]*Check
+	kv            map[string][]byte
+	failures      map[string]*failure
+	latency       time.Duration
+	requests      []string
+}
+
+// NewServer starts fake Consul agent advertising advertiseAddr without services.
+func NewServer(advertiseAddr string) *Server {
+	s := newServer(advertiseAddr)
+	s.Server = httptest.NewServer(s.intercept(s.mux()))
+	return s
+}
+
+// NewTLSServer starts fake Consul agent serving HTTPS with self-signed certificate of 127.0.0.1,
+// available with Certificate method.
+func NewTLSServer(advertiseAddr string) *Server {
+	s := newServer(advertiseAddr)
+	s.Server = httptest.NewTLSServer(s.intercept(s.mux()))
+	return s
+}
+
+func newServer(advertiseAddr string) *Server {
+	return &Server{
+		advertiseAddr: advertiseAddr,
+		services:      make(map[string]*Service),
+		checks:        make(map[string]*Check),
+		kv:            make(map[string][]byte),
+		failures:      make(map[string]*failure),
+	}
+}
+
+func (s *Server) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/agent/self", s.handleSelf)
+	mux.HandleFunc("/v1/agent/services", s.handleServices)
+	mux.HandleFunc("/v1/agent/service/register", s.handleServiceRegister)
+	mux.HandleFunc("/v1/agent/service/deregister/", s.handleServiceDeregister)
+	mux.HandleFunc("/v1/agent/checks", s.handleChecks)
+	mux.HandleFunc("/v1/agent/check/register", s.handleCheckRegister)
+	mux.HandleFunc("/v1/agent/check/deregister/", s.handleCheckDeregister)
+	mux.HandleFunc("/v1/status/leader", s.handleLeader)
+	mux.HandleFunc("/v1/acl/token/self", s.handleTokenSelf)
+	mux.HandleFunc("/v1/kv/", s.handleKV)
+	return mux
+}
+
+// RequireToken enables ACLs, so that requests are only accepted with the token.
+// Token is a management one unless it is denied service:write permission.
+func (s *Server) RequireToken(token string, allowServiceWrite bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.token = token
+	s.denyWrite = !allowServiceWrite
+}
+
+// Fail makes requests to endpoints with the path prefix respond with status code. Status 0 removes the failure.
+func (s *Server) Fail(pathPrefix string, status int) {
+	s.setFailure(pathPrefix, status, false)
+}
+
+// FailOnce makes the next request to endpoint with the path prefix respond with status code.
+func (s *Server) FailOnce(pathPrefix string, status int) {
+	s.setFailure(pathPrefix, status, true)
+}
+
+func (s *Server) setFailure(pathPrefix string, status int, once bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if status == 0 {
+		delete(s.failures, pathPrefix)
+		return
+	}
+	s.failures[pathPrefix] = &failure{status: status, once: once}
+}
+
+// SetLatency delays responses to all requests.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latency = latency
+}
+
+// AddService registers service bypassing the API, i.e. as if it was registered by someone else.
+func (s *Server) AddService(service Service) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.services[service.ID] = &service
+}
+
+// AddCheck registers check bypassing the API.
+func (s *Server) AddCheck(check Check) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.checks[check.CheckID] = &check
+}
+
+// Services returns copies of registered services by ID.
+func (s *Server) Services() map[string]Service {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make(map[string]Service)
+	for id, service := range s.services {
+		result[id] = *service
+	}
+	return result
+}
+
+// Checks returns copies of registered checks by ID.
+func (s *Server) Checks() map[string]Check {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make(map[string]Check)
+	for id, check := range s.checks {
+		result[id] = *check
+	}
+	return result
+}
+
+// KV returns copy of KV store.
+func (s *Server) KV() map[string][]byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make(map[string][]byte)
+	for key, value := range s.kv {
+		result[key] = value
+	}
+	return result
+}
+
+// Requests returns method and path of every request served, i.e. "PUT /v1/agent/service/register".
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// intercept applies latency, failures and ACL token checks before passing request to handler.
+func (s *Server) intercept(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		latency := s.latency
+		var status int
+		for prefix, f := range s.failures {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				status = f.status
+				if f.once {
+					delete(s.failures, prefix)
+				}
+				break
+			}
+		}
+		token := s.token
+		s.lock.Unlock()
+
+		time.Sleep(latency)
+
+		if status != 0 {
+			http.Error(w, "Injected failure", status)
+			return
+		}
+		if token != "" && requestToken(r) != token {
+			http.Error(w, "ACL not found", http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("X-Consul-Token"); token != "" {
+		return token
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+func (s *Server) handleSelf(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]map[string]interface{}{
+		"Config": {
+			"AdvertiseAddr": s.advertiseAddr,
+			"Datacenter":    "dc1",
+			"NodeName":      "node1",
+		},
+		"Member": {
+			"Addr": s.advertiseAddr,
+			"Name": "node1",
+		},
+	})
+}
+
+func (s *Server) handleLeader(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.advertiseAddr+":8300")
+}
+
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writeJSON(w, s.services)
+}
+
+func (s *Server) handleServiceRegister(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, "PUT") {
+		return
+	}
+
+	registration := struct {
+		ID                string
+		Name              string
+		Tags              []string
+		Port              int
+		Address           string
+		EnableTagOverride bool
+		Meta              map[string]string
+		Weights           *Weights
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if registration.Name == "" {
+		http.Error(w, "Missing service name", http.StatusBadRequest)
+		return
+	}
+	if registration.ID == "" {
+		registration.ID = registration.Name
+	}
+
+	// Consul assigns default weights to services registered without them.
+	weights := Weights{Passing: 1, Warning: 1}
+	if registration.Weights != nil {
+		weights = *registration.Weights
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.writable() {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	s.services[registration.ID] = &Service{
+		ID:                registration.ID,
+		Service:           registration.Name,
+		Tags:              registration.Tags,
+		Meta:              registration.Meta,
+		Port:              registration.Port,
+		Address:           registration.Address,
+		EnableTagOverride: registration.EnableTagOverride,
+		Weights:           weights,
+	}
+}
+
+func (s *Server) handleServiceDeregister(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, "PUT") {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.writable() {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	if _, ok := s.services[id]; !ok {
+		http.Error(w, fmt.Sprintf("Unknown service ID %q", id), http.StatusNotFound)
+		return
+	}
+
+	// Agent removes service checks along with the service.
+	delete(s.services, id)
+	for checkID, check := range s.checks {
+		if check.ServiceID == id {
+			delete(s.checks, checkID)
+		}
+	}
+}
+
+func (s *Server) handleChecks(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writeJSON(w, s.checks)
+}
+
+func (s *Server) handleCheckRegister(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, "PUT") {
+		return
+	}
+
+	registration := struct {
+		ID        string
+		Name      string
+		ServiceID string
+		HTTP      string
+		TCP       string
+		TTL       string
+		Interval  string
+		Timeout   string
+		Args      []string
+		Notes     string
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	check := &Check{
+		Node:      "node1",
+		CheckID:   registration.ID,
+		Name:      registration.Name,
+		Status:    "critical",
+		ServiceID: registration.ServiceID,
+		Notes:     registration.Notes,
+		Definition: CheckDefinition{
+			HTTP:    registration.HTTP,
+			TCP:     registration.TCP,
+			Timeout: registration.Timeout,
+		},
+	}
+	switch {
+	case registration.HTTP != "":
+		check.Type = "http"
+	case registration.TCP != "":
+		check.Type = "tcp"
+	case registration.TTL != "":
+		check.Type = "ttl"
+	case len(registration.Args) > 0:
+		check.Type = "script"
+	default:
+		http.Error(w, "Invalid check: one of HTTP, TCP, TTL or Args must be specified", http.StatusBadRequest)
+		return
+	}
+	if check.Type != "ttl" {
+		check.Definition.Interval = registration.Interval
+	}
+	if check.CheckID == "" {
+		check.CheckID = check.Name
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.writable() {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	if check.ServiceID != "" {
+		service, ok := s.services[check.ServiceID]
+		if !ok {
+			http.Error(w, fmt.Sprintf("ServiceID %q does not exist", check.ServiceID), http.StatusInternalServerError)
+			return
+		}
+		check.ServiceName = service.Service
+	}
+	s.checks[check.CheckID] = check
+}
+
+func (s *Server) handleCheckDeregister(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, "PUT") {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/deregister/")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.checks[id]; !ok {
+		http.Error(w, fmt.Sprintf("Unknown check ID %q", id), http.StatusNotFound)
+		return
+	}
+	delete(s.checks, id)
+}
+
+func (s *Server) handleTokenSelf(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	token := s.token
+	denyWrite := s.denyWrite
+	s.lock.Unlock()
+
+	if token == "" {
+		http.Error(w, "ACL support disabled", http.StatusUnauthorized)
+		return
+	}
+	policy := map[string]interface{}{"ID": "00000000-0000-0000-0000-000000000001", "Name": "global-management"}
+	if denyWrite {
+		policy = map[string]interface{}{"ID": "b5b6d4f8-8c2c-0f3e-1f6b-2e2d3f4a5b6c", "Name": "registrator"}
+	}
+	writeJSON(w, map[string]interface{}{
+		"AccessorID":  "6a1253d2-1785-24fd-91c2-f8e78c745511",
+		"SecretID":    token,
+		"Description": "registrator",
+		"Policies":    []interface{}{policy},
+	})
+}
+
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	switch r.Method {
+	case "PUT":
+		value, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.lock.Lock()
+		s.kv[key] = value
+		s.lock.Unlock()
+		writeJSON(w, true)
+	case "GET":
+		_, recurse := r.URL.Query()["recurse"]
+
+		s.lock.Lock()
+		var pairs []map[string]interface{}
+		for pairKey, value := range s.kv {
+			if pairKey == key || recurse && strings.HasPrefix(pairKey, key) {
+				pairs = append(pairs, map[string]interface{}{"Key": pairKey, "Value": value})
+			}
+		}
+		s.lock.Unlock()
+
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i]["Key"].(string) < pairs[j]["Key"].(string) })
+		writeJSON(w, pairs)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writable tells whether write requests are allowed. Must be called with lock held.
+func (s *Server) writable() bool {
+	return s.token == "" || !s.denyWrite
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
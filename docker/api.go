@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"strings"
+)
+
+// Excerpt of Docker Engine API /containers/json response item.
+type container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []*containerPort  `json:"Ports"`
+}
+
+type containerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+// Excerpt of Docker Engine API /containers/{id}/json response.
+type containerDetails struct {
+	ID     string `json:"Id"`
+	Config *struct {
+		Env []string `json:"Env"`
+	} `json:"Config"`
+	State *struct {
+		Running bool `json:"Running"`
+		Health  *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+// Excerpt of Docker Engine API /events response item.
+type event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID string `json:"ID"`
+	} `json:"Actor"`
+}
+
+// envMap converts container environment variables list to map.
+func envMap(env []string) map[string]string {
+	result := make(map[string]string)
+	for _, variable := range env {
+		kv := strings.SplitN(variable, "=", 2)
+		if len(kv) == 2 {
+			result[kv[0]] = kv[1]
+		}
+	}
+	return result
+}
+
+// imageName extracts the image name without registry, repository and tag, i.e. redis from docker.io/library/redis:3.
+func imageName(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, "/"); i >= 0 {
+		image = image[i+1:]
+	}
+	if i := strings.Index(image, ":"); i >= 0 {
+		image = image[:i]
+	}
+	return image
+}
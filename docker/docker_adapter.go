@@ -0,0 +1,383 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/metadata"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	eventsFilter = `{"type":["container"],"event":["start","die","health_status"]}`
+)
+
+var (
+	// Delay between event stream reconnection attempts.
+	reconnectInterval = 5 * time.Second
+)
+
+// Adapter is the implementation of SchedulerAdapter for Docker Engine.
+// It exposes published ports of running containers on the host with hostIP address.
+type Adapter struct {
+	baseURL string
+	client  *http.Client
+
+	// Resolves host address on every Services() call, the last resolved one is used for events.
+	resolveHostIP func() (string, error)
+	hostIPLock    sync.Mutex
+	hostIP        string
+
+	// Event stream is interrupted and no longer reconnected once ctx is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a new Adapter for Docker Engine listening on endpoint, i.e. unix:///var/run/docker.sock
+// or tcp://127.0.0.1:2375. Services are advertised with hostIP address.
+func New(endpoint, hostIP string) (*Adapter, error) {
+	if hostIP == "" {
+		return nil, errors.New("Docker host IP address is not specified")
+	}
+
+	return NewWithHostIPResolver(endpoint, func() (string, error) {
+		return hostIP, nil
+	})
+}
+
+// NewWithHostIPResolver creates a new Adapter advertising services with the address returned by resolveHostIP,
+// i.e. registry advertise address, so that the address need not be known when adapter is created.
+func NewWithHostIPResolver(endpoint string, resolveHostIP func() (string, error)) (*Adapter, error) {
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("prefix", "docker").Infof("Connecting to Docker at %v", endpoint)
+	ctx, cancel := context.WithCancel(context.Background())
+	adapter := &Adapter{
+		client:        &http.Client{},
+		resolveHostIP: resolveHostIP,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	switch uri.Scheme {
+	case "unix":
+		socket := uri.Path
+		adapter.baseURL = "http://docker"
+		adapter.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+	case "tcp", "http":
+		adapter.baseURL = "http://" + uri.Host
+	default:
+		return nil, fmt.Errorf("Unsupported Docker endpoint scheme: %s", uri.Scheme)
+	}
+
+	return adapter, nil
+}
+
+func (d *Adapter) request(path string) (*http.Response, error) {
+	request, err := http.NewRequest("GET", d.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := d.client.Do(request.WithContext(d.ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("Unexpected Docker response: %s", response.Status)
+	}
+
+	return response, nil
+}
+
+func (d *Adapter) get(path string, result interface{}) error {
+	response, err := d.request(path)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// refreshHostIP resolves host address and remembers it for events.
+func (d *Adapter) refreshHostIP() (string, error) {
+	hostIP, err := d.resolveHostIP()
+	if err != nil {
+		return "", err
+	}
+
+	d.hostIPLock.Lock()
+	defer d.hostIPLock.Unlock()
+	d.hostIP = hostIP
+	return hostIP, nil
+}
+
+// eventHostIP returns host address events are attributed to, resolving it unless it is known yet.
+func (d *Adapter) eventHostIP() string {
+	d.hostIPLock.Lock()
+	hostIP := d.hostIP
+	d.hostIPLock.Unlock()
+	if hostIP != "" {
+		return hostIP
+	}
+
+	hostIP, err := d.refreshHostIP()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix": "docker",
+			"err":    err,
+		}).Warn("Unable to resolve host IP address")
+	}
+	return hostIP
+}
+
+// Services returns the list of running containers publishing ports.
+func (d *Adapter) Services() ([]*types.ServiceGroup, error) {
+	hostIP, err := d.refreshHostIP()
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []*container
+	if err := d.get("/containers/json", &containers); err != nil {
+		return nil, err
+	}
+
+	var result []*types.ServiceGroup
+	for _, c := range containers {
+		ports := publishedPorts(c)
+		if len(ports) == 0 {
+			continue
+		}
+
+		details := &containerDetails{}
+		if err := d.get("/containers/"+c.ID+"/json", details); err != nil {
+			return nil, err
+		}
+
+		group := toServiceGroup(c, details, ports, hostIP)
+		result = append(result, group)
+		for _, service := range group.Services {
+			log.WithFields(log.Fields{
+				"prefix": "docker",
+				"ip":     group.IP,
+				"id":     service.ID,
+				"name":   service.Name,
+				"port":   service.ExposedPort,
+			}).Debug("Service")
+		}
+	}
+
+	return result, nil
+}
+
+// publishedPorts returns TCP ports published on host. Ports published on both IPv4 and IPv6 are returned once.
+func publishedPorts(c *container) []*containerPort {
+	var result []*containerPort
+	seen := make(map[int]bool)
+	for _, port := range c.Ports {
+		if port.PublicPort == 0 || port.Type != "tcp" || seen[port.PrivatePort] {
+			continue
+		}
+		seen[port.PrivatePort] = true
+		result = append(result, port)
+	}
+	return result
+}
+
+func isHealthy(details *containerDetails) bool {
+	if details.State == nil {
+		return false
+	}
+
+	// Container has no health check. Assume healthy.
+	if details.State.Health == nil {
+		return details.State.Running
+	}
+
+	return details.State.Health.Status == "healthy"
+}
+
+func toServiceGroup(c *container, details *containerDetails, ports []*containerPort, hostIP string) *types.ServiceGroup {
+	group := &types.ServiceGroup{
+		ID: c.ID,
+		IP: hostIP,
+	}
+
+	containerName := c.ID
+	if len(c.Names) > 0 {
+		containerName = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	var env map[string]string
+	if details.Config != nil {
+		env = envMap(details.Config.Env)
+	} else {
+		env = map[string]string{}
+	}
+	labels := c.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	defaultName := imageName(c.Image)
+	isGroup := len(ports) > 1
+	for _, port := range ports {
+		name := defaultName
+		if isGroup {
+			name += fmt.Sprintf("-%d", port.PrivatePort)
+		}
+
+		md, _ := metadata.Extract(
+			port.PrivatePort,
+			metadata.Source{Name: "env", Values: env},
+			metadata.Source{Name: "label", Values: labels},
+		)
+		templateContext := &metadata.TemplateContext{
+			AppID:        containerName,
+			TaskID:       c.ID,
+			IP:           hostIP,
+			OriginalPort: port.PrivatePort,
+			ExposedPort:  port.PublicPort,
+			Labels:       labels,
+			Env:          env,
+		}
+
+		service := md.Service(fmt.Sprintf("%s:%d", c.ID, port.PrivatePort), name, templateContext)
+		service.Healthy = isHealthy(details)
+		group.Services = append(group.Services, service)
+	}
+
+	return group
+}
+
+// ListenForEvents subscribes to Docker container events and publishes them to channel.
+// Broken event stream is reconnected automatically until the adapter is closed.
+func (d *Adapter) ListenForEvents(channel types.EventsChannel) error {
+	body, err := d.events()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			err := d.readEvents(body, channel)
+			body.Close()
+			if d.ctx.Err() != nil {
+				return
+			}
+			log.WithFields(log.Fields{
+				"prefix": "docker",
+				"err":    err,
+			}).Warnf("Event stream closed, reconnecting in %v", reconnectInterval)
+
+			for {
+				select {
+				case <-d.ctx.Done():
+					return
+				case <-time.After(reconnectInterval):
+				}
+				body, err = d.events()
+				if err == nil {
+					break
+				}
+				log.WithFields(log.Fields{
+					"prefix": "docker",
+					"err":    err,
+				}).Warnf("Unable to connect to event stream, retrying in %v", reconnectInterval)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close interrupts event stream and stops reconnecting to it.
+func (d *Adapter) Close() error {
+	d.cancel()
+	return nil
+}
+
+func (d *Adapter) events() (io.ReadCloser, error) {
+	params := make(url.Values)
+	params.Add("filters", eventsFilter)
+	response, err := d.request("/events?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("prefix", "docker").Info("Connected to Docker event stream")
+
+	return response.Body, nil
+}
+
+// readEvents reads JSON events until the stream is closed.
+func (d *Adapter) readEvents(body io.Reader, channel types.EventsChannel) error {
+	decoder := json.NewDecoder(bufio.NewReader(body))
+	for {
+		e := &event{}
+		if err := decoder.Decode(e); err != nil {
+			return err
+		}
+
+		if serviceEvent := d.toServiceEvent(e); serviceEvent != nil {
+			select {
+			case channel <- serviceEvent:
+			case <-d.ctx.Done():
+				return d.ctx.Err()
+			}
+		}
+	}
+}
+
+func (d *Adapter) toServiceEvent(e *event) *types.ServiceEvent {
+	if e.Type != "container" {
+		return nil
+	}
+
+	result := &types.ServiceEvent{
+		ServiceID:     e.Actor.ID,
+		IP:            d.eventHostIP(),
+		Action:        types.ServiceUnchanged,
+		OriginalEvent: e,
+		EventType:     e.Action,
+	}
+
+	switch e.Action {
+	case "start":
+		result.Action = types.ServiceStarted
+	case "die":
+		result.Action = types.ServiceStopped
+	case "health_status: healthy":
+		result.Action = types.ServiceWentUp
+	case "health_status: unhealthy":
+		result.Action = types.ServiceWentDown
+	default:
+		return nil
+	}
+
+	return result
+}
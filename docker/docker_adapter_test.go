@@ -0,0 +1,282 @@
+package docker
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDockerAdapter(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Docker Adapter Suite")
+}
+
+// fakeDocker serves recorded Docker Engine API responses over unix socket.
+type fakeDocker struct {
+	dir      string
+	listener net.Listener
+
+	// Number of event stream requests served.
+	eventRequests int32
+}
+
+func newFakeDocker() *fakeDocker {
+	dir, err := ioutil.TempDir("", "registrator-docker")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	Ω(err).ShouldNot(HaveOccurred())
+
+	f := &fakeDocker{
+		dir:      dir,
+		listener: listener,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/containers.json")
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		id := filepath.Base(filepath.Dir(r.URL.Path))
+		http.ServeFile(w, r, "testdata/container_"+id+".json")
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filters") != eventsFilter {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&f.eventRequests, 1)
+		http.ServeFile(w, r, "testdata/events.jsonl")
+	})
+	go http.Serve(listener, mux)
+
+	return f
+}
+
+func (f *fakeDocker) EventRequests() int32 {
+	return atomic.LoadInt32(&f.eventRequests)
+}
+
+func (f *fakeDocker) Endpoint() string {
+	return "unix://" + f.listener.Addr().String()
+}
+
+func (f *fakeDocker) Close() {
+	f.listener.Close()
+	os.RemoveAll(f.dir)
+}
+
+var _ = Describe("DockerAdapter", func() {
+	var docker *fakeDocker
+
+	BeforeEach(func() {
+		docker = newFakeDocker()
+	})
+
+	AfterEach(func() {
+		docker.Close()
+	})
+
+	Describe("New()", func() {
+		It("Should require host IP address", func() {
+			// Act.
+			_, err := New(docker.Endpoint(), "")
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should reject unsupported endpoints", func() {
+			// Act.
+			_, err := New("ftp://127.0.0.1", "10.10.10.10")
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("NewWithHostIPResolver()", func() {
+		It("Should not resolve host IP address until services are requested", func() {
+			// Arrange.
+			resolved := 0
+			resolve := func() (string, error) {
+				resolved++
+				return "", errors.New("registry is unreachable")
+			}
+
+			// Act.
+			dockerAdapter, err := NewWithHostIPResolver(docker.Endpoint(), resolve)
+			defer dockerAdapter.Close()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resolved).Should(Equal(0))
+		})
+	})
+
+	Describe("Services()", func() {
+		It("Should forward host IP address resolution errors", func() {
+			// Arrange.
+			dockerAdapter, _ := NewWithHostIPResolver(docker.Endpoint(), func() (string, error) {
+				return "", errors.New("registry is unreachable")
+			})
+			defer dockerAdapter.Close()
+
+			// Act.
+			_, err := dockerAdapter.Services()
+
+			// Assert.
+			Ω(err).Should(MatchError("registry is unreachable"))
+		})
+
+		It("Should advertise services with the last resolved host IP address", func() {
+			// Arrange.
+			hostIP := "10.10.10.10"
+			dockerAdapter, _ := NewWithHostIPResolver(docker.Endpoint(), func() (string, error) {
+				return hostIP, nil
+			})
+			defer dockerAdapter.Close()
+			dockerAdapter.Services()
+			hostIP = "10.10.10.11"
+
+			// Act.
+			services, err := dockerAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services[0].IP).Should(Equal("10.10.10.11"))
+		})
+
+		It("Should forward Docker errors", func() {
+			// Arrange.
+			dockerAdapter, _ := New("unix://"+filepath.Join(docker.dir, "missing.sock"), "10.10.10.10")
+
+			// Act.
+			_, err := dockerAdapter.Services()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert running containers with published ports to service groups", func() {
+			// Arrange.
+			dockerAdapter, _ := New(docker.Endpoint(), "10.10.10.10")
+
+			// Act.
+			services, err := dockerAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(2))
+			Ω(services[0]).Should(Equal(&types.ServiceGroup{
+				ID: "8dfafdbc3a40",
+				IP: "10.10.10.10",
+				Services: []*types.Service{
+					{
+						ID:           "8dfafdbc3a40:80",
+						Name:         "web-80",
+						Tags:         []string{"production", "version=1.2.3"},
+						Healthy:      true,
+						OriginalPort: 80,
+						ExposedPort:  32768,
+					},
+					{
+						ID:           "8dfafdbc3a40:8081",
+						Name:         "web-admin",
+						Tags:         []string{"production", "version=1.2.3"},
+						Healthy:      true,
+						OriginalPort: 8081,
+						ExposedPort:  32769,
+					},
+				},
+			}))
+			Ω(services[1]).Should(Equal(&types.ServiceGroup{
+				ID: "9cd87474be90",
+				IP: "10.10.10.10",
+				Services: []*types.Service{
+					{
+						ID:   "9cd87474be90:6379",
+						Name: "redis",
+						HealthChecks: []*types.ServiceHealthCheck{
+							{ID: "tcp", TCP: "10.10.10.10:32770", Interval: "10s"},
+						},
+						Healthy:      false,
+						OriginalPort: 6379,
+						ExposedPort:  32770,
+					},
+				},
+			}))
+		})
+	})
+
+	Describe("ListenForEvents()", func() {
+		It("Should forward event stream errors", func() {
+			// Arrange.
+			dockerAdapter, _ := New("unix://"+filepath.Join(docker.dir, "missing.sock"), "10.10.10.10")
+
+			// Act.
+			err := dockerAdapter.ListenForEvents(make(types.EventsChannel))
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert container events to service events", func() {
+			// Arrange.
+			dockerAdapter, _ := New(docker.Endpoint(), "10.10.10.10")
+			defer dockerAdapter.Close()
+			channel := make(types.EventsChannel, 10)
+
+			// Act.
+			err := dockerAdapter.ListenForEvents(channel)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var event *types.ServiceEvent
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("8dfafdbc3a40"))
+			Ω(event.IP).Should(Equal("10.10.10.10"))
+			Ω(event.Action).Should(Equal(types.ServiceStarted))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceWentUp))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceWentDown))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceStopped))
+		})
+
+		It("Should stop reconnecting to event stream once closed", func() {
+			// Arrange.
+			defer func(interval time.Duration) { reconnectInterval = interval }(reconnectInterval)
+			reconnectInterval = 10 * time.Millisecond
+			dockerAdapter, _ := New(docker.Endpoint(), "10.10.10.10")
+			channel := make(types.EventsChannel, 100)
+			dockerAdapter.ListenForEvents(channel)
+			Eventually(docker.EventRequests).Should(BeNumerically(">=", 2))
+
+			// Act.
+			dockerAdapter.Close()
+
+			// Assert.
+			requests := docker.EventRequests()
+			Consistently(docker.EventRequests, 100*time.Millisecond).Should(BeNumerically("<=", requests+1))
+		})
+	})
+})
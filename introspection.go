@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/x-cray/marathon-registrator/bridge"
+	"github.com/x-cray/marathon-registrator/marathon"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func printJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	assert(encoder.Encode(v))
+}
+
+// listServices prints service groups returned by the selected adapter.
+func listServices(config *types.Config) {
+	registryConfig := registryConfigBySource(config, *servicesSource)
+
+	var groups []*types.ServiceGroup
+	if registryConfig != nil {
+		registry, err := bridge.NewRegistry(registryConfig, config)
+		assert(err)
+		groups, err = registry.Adapter.Services()
+		assert(err)
+	} else {
+		// Schedulers need registry to resolve addresses, i.e. Docker containers of the registry node.
+		registry, err := bridge.NewRegistry(config.Registries[0], config)
+		assert(err)
+		scheduler, err := bridge.NewScheduler(schedulerConfig(config, *servicesSource), config, registry.Adapter)
+		assert(err)
+		groups, err = scheduler.Adapter.Services()
+		assert(err)
+	}
+
+	if *servicesOutput == "json" {
+		printJSON(os.Stdout, groups)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tSERVICE\tNAME\tIP\tPORT\tHEALTHY\tTAGS")
+	for _, group := range groups {
+		for _, service := range group.Services {
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%d\t%t\t%s\n",
+				group.ID,
+				service.ID,
+				service.Name,
+				group.IP,
+				service.ExposedPort,
+				service.Healthy,
+				strings.Join(service.Tags, ","),
+			)
+		}
+	}
+	w.Flush()
+}
+
+// explain prints how Marathon application tasks are converted to services.
+func explain(config *types.Config) {
+	registry, err := bridge.NewRegistry(config.Registries[0], config)
+	assert(err)
+
+	advertiseAddr, err := registry.Adapter.AdvertiseAddr()
+	assert(err)
+
+	marathonConfig := marathonSchedulerConfig(config)
+	scheduler, err := marathon.New(marathonConfig.URL, nil)
+	assert(err)
+
+	explanation, err := scheduler.Explain(*explainApp, advertiseAddr, types.TracksReadiness(registry.Adapter))
+	assert(err)
+
+	if *explainOutput == "json" {
+		printJSON(os.Stdout, explanation)
+		return
+	}
+
+	printExplanation(os.Stdout, explanation, advertiseAddr)
+}
+
+// printStatus prints the state of configured schedulers.
+func printStatus(config *types.Config) {
+	b, err := bridge.New(config)
+	assert(err)
+
+	status := b.SchedulerStatus()
+	if *statusOutput == "json" {
+		printJSON(os.Stdout, status)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEDULER\tACTIVE ENDPOINT")
+	for _, scheduler := range status {
+		fmt.Fprintf(w, "%s\t%s\n", scheduler.Scheduler, scheduler.ActiveEndpoint)
+	}
+	w.Flush()
+}
+
+// registryConfigBySource returns the configuration of the registry with the name, or of the first registry
+// of the type, i.e. "consul". Nil is returned when source is not a registry.
+func registryConfigBySource(config *types.Config, source string) *types.RegistryConfig {
+	for _, rc := range config.Registries {
+		if rc.Name == source {
+			return rc
+		}
+	}
+	for _, rc := range config.Registries {
+		if rc.Type == source {
+			return rc
+		}
+	}
+	return nil
+}
+
+// schedulerConfig returns the configuration of the scheduler with specified name.
+func schedulerConfig(config *types.Config, name string) *types.SchedulerConfig {
+	for _, sc := range config.Schedulers {
+		if sc.Name == name {
+			return sc
+		}
+	}
+
+	log.Fatalf("Scheduler %s is not configured", name)
+	return nil
+}
+
+// marathonSchedulerConfig returns the configuration of the first Marathon scheduler.
+func marathonSchedulerConfig(config *types.Config) *types.SchedulerConfig {
+	for _, sc := range config.Schedulers {
+		if sc.Type == "marathon" {
+			return sc
+		}
+	}
+
+	log.Fatal("No Marathon scheduler is configured")
+	return nil
+}
+
+func printExplanation(w io.Writer, explanation *marathon.AppExplanation, advertiseAddr string) {
+	fmt.Fprintf(w, "Application %s, registry advertise address %s\n", explanation.AppID, advertiseAddr)
+	if len(explanation.Tasks) == 0 {
+		fmt.Fprintln(w, "No tasks")
+	}
+
+	for _, task := range explanation.Tasks {
+		fmt.Fprintf(w, "\nTask %s on %s (%s)\n", task.TaskID, task.Host, task.IP)
+		if task.Decision != "" {
+			fmt.Fprintf(w, "  %s\n", task.Decision)
+			continue
+		}
+		if task.Error != "" {
+			fmt.Fprintf(w, "  Error: %s\n", task.Error)
+			continue
+		}
+
+		for _, port := range task.Ports {
+			fmt.Fprintf(w, "  Port %d -> %d: %s\n", port.OriginalPort, port.ExposedPort, port.Decision)
+			fmt.Fprintf(w, "    Service ID: %s\n", port.ServiceID)
+			fmt.Fprintf(w, "    Name:       %s\n", port.Name)
+			fmt.Fprintf(w, "    Tags:       %s\n", strings.Join(port.Tags, ","))
+			fmt.Fprintf(w, "    Healthy:    %t\n", port.Healthy)
+			fmt.Fprintf(w, "    Local:      %t\n", port.Local)
+			if len(port.Metadata) > 0 {
+				fmt.Fprintln(w, "    Metadata:")
+			}
+			for _, decision := range port.Metadata {
+				fmt.Fprintf(w, "      %s %s=%q: %s\n", decision.Source, decision.Key, decision.Value, decision.Reason)
+			}
+		}
+	}
+}
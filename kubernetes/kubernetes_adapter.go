@@ -0,0 +1,401 @@
+// Package kubernetes registers services as selector-less Kubernetes Services backed by EndpointSlices,
+// so that Kubernetes workloads may reach scheduler services using cluster DNS names.
+package kubernetes
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/x-cray/marathon-registrator/tracing"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// Value of EndpointSlice managed-by label, so that Kubernetes endpoints controller leaves slices intact.
+	managedBy = "registrator.x-cray.github.io"
+
+	// Label telling which registrator instance owns EndpointSlice.
+	advertiseAddrLabel = "registrator.x-cray.github.io/advertise-addr"
+
+	// Annotation holding service definition which can not be expressed by EndpointSlice itself.
+	serviceAnnotation = "registrator.x-cray.github.io/service"
+
+	// Name of the single port of Service and its EndpointSlices.
+	portName = "service"
+
+	// Maximum length of Kubernetes object name being DNS label.
+	maxNameLength = 63
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// Adapter is the implementation of RegistryAdapter maintaining a selector-less Service for every service
+// name and an EndpointSlice for every registered service in the namespace. EndpointSlices are labeled
+// with advertise address, so that several registrator instances may share the namespace.
+type Adapter struct {
+	client        clientset.Interface
+	namespace     string
+	advertiseAddr string
+	dryRun        bool
+}
+
+// serviceDefinition is the registered service stored in EndpointSlice annotation.
+type serviceDefinition struct {
+	GroupID string
+	Service *types.Service
+}
+
+// New creates adapter talking to API server at uri, i.e. kubernetes+https://10.10.10.1:6443, or to the one
+// the registrator runs within when host is omitted. URL parameters are:
+//   - advertise_addr: address of the node scheduler services are registered from (required)
+//   - namespace: namespace to maintain Services in, "default" unless specified
+//   - kubeconfig: kubeconfig file to take credentials from, in-cluster service account is used unless specified
+func New(uri *url.URL, dryRun bool) (*Adapter, error) {
+	params := uri.Query()
+	advertiseAddr := params.Get("advertise_addr")
+	if advertiseAddr == "" {
+		return nil, errors.New("Kubernetes registry requires advertise_addr parameter")
+	}
+	namespace := params.Get("namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	var config *rest.Config
+	var err error
+	kubeconfig := params.Get("kubeconfig")
+	if uri.Host == "" && kubeconfig == "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		var master string
+		if uri.Host != "" {
+			master = uri.Scheme + "://" + uri.Host
+		}
+		config, err = clientcmd.BuildConfigFromFlags(master, kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.Wrap(tracing.Transport)
+
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":    "kubernetes",
+		"namespace": namespace,
+	}).Infof("Connecting to Kubernetes at %s", config.Host)
+
+	return NewFromClient(client, namespace, advertiseAddr, dryRun), nil
+}
+
+// NewFromClient creates adapter maintaining Services in namespace with already created client.
+func NewFromClient(client clientset.Interface, namespace, advertiseAddr string, dryRun bool) *Adapter {
+	return &Adapter{
+		client:        client,
+		namespace:     namespace,
+		advertiseAddr: advertiseAddr,
+		dryRun:        dryRun,
+	}
+}
+
+// Ping checks that Services of the namespace may be listed.
+func (r *Adapter) Ping() error {
+	_, err := r.client.CoreV1().Services(r.namespace).List(context.Background(), metav1.ListOptions{Limit: 1})
+	return err
+}
+
+func (r *Adapter) Register(group *types.ServiceGroup) error {
+	return r.RegisterContext(context.Background(), group)
+}
+
+// RegisterContext creates or updates Service and EndpointSlice of each group service.
+func (r *Adapter) RegisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	for _, service := range group.Services {
+		entry := log.WithFields(log.Fields{
+			"prefix": "kubernetes",
+			"ip":     group.IP,
+			"id":     service.ID,
+			"name":   service.Name,
+			"port":   service.ExposedPort,
+		}).WithFields(types.ContextFields(ctx))
+		if r.dryRun {
+			entry.Info("[dry-run] Would register service")
+			continue
+		}
+		entry.Info("Registering service")
+
+		name, err := serviceName(service.Name)
+		if err != nil {
+			return err
+		}
+		if err := r.applyService(ctx, name, service); err != nil {
+			return err
+		}
+		if err := r.applyEndpointSlice(ctx, name, group, service); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyService creates selector-less Service or updates its port.
+func (r *Adapter) applyService(ctx context.Context, name string, service *types.Service) error {
+	port := service.OriginalPort
+	if port == 0 {
+		port = service.ExposedPort
+	}
+	ports := []corev1.ServicePort{{Name: portName, Protocol: corev1.ProtocolTCP, Port: int32(port)}}
+
+	services := r.client.CoreV1().Services(r.namespace)
+	existing, err := services.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = services.Create(ctx, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{discoveryv1.LabelManagedBy: managedBy},
+			},
+			Spec: corev1.ServiceSpec{Ports: ports},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Created by another registrator instance meanwhile.
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if existing.Labels[discoveryv1.LabelManagedBy] != managedBy {
+		return fmt.Errorf("Service %s/%s is not managed by registrator", r.namespace, name)
+	}
+	if len(existing.Spec.Ports) == 1 && existing.Spec.Ports[0].Name == portName && existing.Spec.Ports[0].Port == int32(port) {
+		return nil
+	}
+
+	existing.Spec.Ports = ports
+	_, err = services.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// applyEndpointSlice creates or replaces EndpointSlice of the service.
+func (r *Adapter) applyEndpointSlice(ctx context.Context, name string, group *types.ServiceGroup, service *types.Service) error {
+	definition, err := json.Marshal(&serviceDefinition{GroupID: group.ID, Service: service})
+	if err != nil {
+		return err
+	}
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if ip := net.ParseIP(group.IP); ip != nil && ip.To4() == nil {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+	port := int32(service.ExposedPort)
+	protocol := corev1.ProtocolTCP
+	ready := service.Healthy
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: endpointSliceName(name, service.ID),
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: name,
+				discoveryv1.LabelManagedBy:   managedBy,
+				advertiseAddrLabel:           labelValue(r.advertiseAddr),
+			},
+			Annotations: map[string]string{serviceAnnotation: string(definition)},
+		},
+		AddressType: addressType,
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{group.IP},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		}},
+		Ports: []discoveryv1.EndpointPort{{Name: stringPtr(portName), Protocol: &protocol, Port: &port}},
+	}
+
+	slices := r.client.DiscoveryV1().EndpointSlices(r.namespace)
+	existing, err := slices.Get(ctx, slice.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = slices.Create(ctx, slice, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	slice.ResourceVersion = existing.ResourceVersion
+	_, err = slices.Update(ctx, slice, metav1.UpdateOptions{})
+	return err
+}
+
+func (r *Adapter) Deregister(group *types.ServiceGroup) error {
+	return r.DeregisterContext(context.Background(), group)
+}
+
+// DeregisterContext deletes EndpointSlice of each group service along with Service left without slices.
+func (r *Adapter) DeregisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	for _, service := range group.Services {
+		entry := log.WithFields(log.Fields{
+			"prefix": "kubernetes",
+			"ip":     group.IP,
+			"id":     service.ID,
+			"name":   service.Name,
+			"port":   service.ExposedPort,
+		}).WithFields(types.ContextFields(ctx))
+		if r.dryRun {
+			entry.Info("[dry-run] Would deregister service")
+			continue
+		}
+		entry.Info("Deregistering service")
+
+		name, err := serviceName(service.Name)
+		if err != nil {
+			return err
+		}
+
+		err = r.client.DiscoveryV1().EndpointSlices(r.namespace).Delete(ctx, endpointSliceName(name, service.ID), metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		if err := r.deleteUnusedService(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteUnusedService deletes Service no EndpointSlices of any registrator instance refer to.
+func (r *Adapter) deleteUnusedService(ctx context.Context, name string) error {
+	selector := labels.Set{
+		discoveryv1.LabelServiceName: name,
+		discoveryv1.LabelManagedBy:   managedBy,
+	}.String()
+	slices, err := r.client.DiscoveryV1().EndpointSlices(r.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	if len(slices.Items) > 0 {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"prefix": "kubernetes",
+		"name":   name,
+	}).WithFields(types.ContextFields(ctx)).Debug("Deleting Service left without endpoints")
+
+	err = r.client.CoreV1().Services(r.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Services returns services of EndpointSlices owned by this registrator instance, each in its own group.
+// Address, port and readiness are taken from EndpointSlice, the rest of definition from its annotation.
+func (r *Adapter) Services() ([]*types.ServiceGroup, error) {
+	selector := labels.Set{
+		discoveryv1.LabelManagedBy: managedBy,
+		advertiseAddrLabel:         labelValue(r.advertiseAddr),
+	}.String()
+	slices, err := r.client.DiscoveryV1().EndpointSlices(r.namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*types.ServiceGroup
+	for _, slice := range slices.Items {
+		definition := &serviceDefinition{}
+		if err := json.Unmarshal([]byte(slice.Annotations[serviceAnnotation]), definition); err != nil || definition.Service == nil {
+			log.WithFields(log.Fields{
+				"prefix": "kubernetes",
+				"slice":  slice.Name,
+			}).Warn("Skipping EndpointSlice without service definition")
+			continue
+		}
+		if len(slice.Endpoints) == 0 || len(slice.Endpoints[0].Addresses) == 0 || len(slice.Ports) == 0 || slice.Ports[0].Port == nil {
+			log.WithFields(log.Fields{
+				"prefix": "kubernetes",
+				"slice":  slice.Name,
+			}).Warn("Skipping EndpointSlice without endpoint")
+			continue
+		}
+
+		service := definition.Service
+		endpoint := slice.Endpoints[0]
+		service.ExposedPort = int(*slice.Ports[0].Port)
+		service.Healthy = endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+		result = append(result, &types.ServiceGroup{
+			ID:       definition.GroupID,
+			IP:       endpoint.Addresses[0],
+			Services: []*types.Service{service},
+		})
+	}
+
+	return result, nil
+}
+
+// TracksReadiness tells that unhealthy services are registered as not ready endpoints, since Kubernetes
+// has no health checks for selector-less Services.
+func (r *Adapter) TracksReadiness() bool {
+	return true
+}
+
+// AdvertiseAddr returns advertise address registrator instance is configured with, since Kubernetes
+// registry is not bound to any node.
+func (r *Adapter) AdvertiseAddr() (string, error) {
+	return r.advertiseAddr, nil
+}
+
+// serviceName converts service name to valid Kubernetes Service name, i.e. "web_app" to "web-app".
+func serviceName(name string) (string, error) {
+	result := invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	result = strings.TrimLeft(result, "-0123456789")
+	if len(result) > maxNameLength {
+		result = result[:maxNameLength]
+	}
+	result = strings.TrimRight(result, "-")
+	if result == "" {
+		return "", fmt.Errorf("Service name %q can not be converted to Kubernetes Service name", name)
+	}
+	return result, nil
+}
+
+// endpointSliceName returns EndpointSlice name of the service unique within the namespace.
+func endpointSliceName(name, serviceID string) string {
+	hash := sha1.Sum([]byte(serviceID))
+	suffix := hex.EncodeToString(hash[:])[:10]
+	if len(name) > maxNameLength-len(suffix)-1 {
+		name = strings.TrimRight(name[:maxNameLength-len(suffix)-1], "-")
+	}
+	return name + "-" + suffix
+}
+
+// labelValue converts address to valid label value, i.e. IPv6 colons to dashes.
+func labelValue(addr string) string {
+	return strings.Replace(addr, ":", "-", -1)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,294 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestKubernetesAdapter(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Kubernetes Adapter Suite")
+}
+
+var _ = Describe("KubernetesAdapter", func() {
+	var (
+		client  *fake.Clientset
+		adapter *Adapter
+	)
+
+	webGroup := func() *types.ServiceGroup {
+		return &types.ServiceGroup{
+			ID: "web_app.2c033893-7993-11e5-8878-56847afe9799",
+			IP: "10.10.10.10",
+			Services: []*types.Service{
+				{
+					ID:           "web_app.2c033893-7993-11e5-8878-56847afe9799:31045",
+					Name:         "web_app",
+					Tags:         []string{"primary"},
+					Meta:         map[string]string{types.SourceMetaKey: "marathon"},
+					Weights:      &types.ServiceWeights{Passing: 10, Warning: 1},
+					HealthChecks: []*types.ServiceHealthCheck{{ID: "tcp", TCP: "10.10.10.10:31045", Interval: "10s"}},
+					Healthy:      true,
+					OriginalPort: 8080,
+					ExposedPort:  31045,
+				},
+			},
+		}
+	}
+
+	slices := func() []discoveryv1.EndpointSlice {
+		list, err := client.DiscoveryV1().EndpointSlices("marathon").List(context.Background(), metav1.ListOptions{})
+		Ω(err).ShouldNot(HaveOccurred())
+		return list.Items
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		adapter = NewFromClient(client, "marathon", "10.10.10.10", false)
+	})
+
+	Describe("New()", func() {
+		It("Should require advertise address", func() {
+			// Arrange.
+			uri, _ := url.Parse("https://10.10.10.1:6443?namespace=marathon")
+
+			// Act.
+			_, err := New(uri, false)
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("advertise_addr")))
+		})
+	})
+
+	Describe("Ping()", func() {
+		It("Should succeed when Services may be listed", func() {
+			// Act.
+			err := adapter.Ping()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should forward API server errors", func() {
+			// Arrange.
+			client.PrependReactor("list", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("forbidden")
+			})
+
+			// Act.
+			err := adapter.Ping()
+
+			// Assert.
+			Ω(err).Should(MatchError("forbidden"))
+		})
+	})
+
+	Describe("Register()", func() {
+		It("Should create selector-less Service and EndpointSlice", func() {
+			// Act.
+			err := adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			service, err := client.CoreV1().Services("marathon").Get(context.Background(), "web-app", metav1.GetOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(service.Spec.Selector).Should(BeEmpty())
+			Ω(service.Spec.Ports).Should(Equal([]corev1.ServicePort{{Name: "service", Protocol: corev1.ProtocolTCP, Port: 8080}}))
+
+			items := slices()
+			Ω(items).Should(HaveLen(1))
+			slice := items[0]
+			Ω(slice.Labels).Should(HaveKeyWithValue(discoveryv1.LabelServiceName, "web-app"))
+			Ω(slice.Labels).Should(HaveKeyWithValue(discoveryv1.LabelManagedBy, managedBy))
+			Ω(slice.AddressType).Should(Equal(discoveryv1.AddressTypeIPv4))
+			Ω(slice.Endpoints).Should(HaveLen(1))
+			Ω(slice.Endpoints[0].Addresses).Should(Equal([]string{"10.10.10.10"}))
+			Ω(*slice.Endpoints[0].Conditions.Ready).Should(BeTrue())
+			Ω(*slice.Ports[0].Name).Should(Equal("service"))
+			Ω(*slice.Ports[0].Port).Should(Equal(int32(31045)))
+		})
+
+		It("Should update port and readiness of registered service", func() {
+			// Arrange.
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+			group := webGroup()
+			group.Services[0].ExposedPort = 31046
+			group.Services[0].OriginalPort = 9090
+			group.Services[0].Healthy = false
+
+			// Act.
+			err := adapter.Register(group)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			items := slices()
+			Ω(items).Should(HaveLen(1))
+			Ω(*items[0].Ports[0].Port).Should(Equal(int32(31046)))
+			Ω(*items[0].Endpoints[0].Conditions.Ready).Should(BeFalse())
+			service, err := client.CoreV1().Services("marathon").Get(context.Background(), "web-app", metav1.GetOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(service.Spec.Ports[0].Port).Should(Equal(int32(9090)))
+		})
+
+		It("Should not take over Services created by others", func() {
+			// Arrange.
+			client = fake.NewSimpleClientset(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-app", Namespace: "marathon"},
+			})
+			adapter = NewFromClient(client, "marathon", "10.10.10.10", false)
+
+			// Act.
+			err := adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("not managed by registrator")))
+			Ω(slices()).Should(BeEmpty())
+		})
+
+		It("Should reject service names not convertible to Service names", func() {
+			// Arrange.
+			group := webGroup()
+			group.Services[0].Name = "__"
+
+			// Act.
+			err := adapter.Register(group)
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Deregister()", func() {
+		It("Should delete EndpointSlice along with Service left without endpoints", func() {
+			// Arrange.
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+
+			// Act.
+			err := adapter.Deregister(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(slices()).Should(BeEmpty())
+			services, err := client.CoreV1().Services("marathon").List(context.Background(), metav1.ListOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services.Items).Should(BeEmpty())
+		})
+
+		It("Should keep Service with endpoints registered by other instances", func() {
+			// Arrange.
+			other := NewFromClient(client, "marathon", "10.10.10.20", false)
+			otherGroup := webGroup()
+			otherGroup.ID = "web_app.5877d4d2-7b4b-11e5-b945-56847afe9799"
+			otherGroup.IP = "10.10.10.20"
+			otherGroup.Services[0].ID = "web_app.5877d4d2-7b4b-11e5-b945-56847afe9799:31001"
+			Ω(other.Register(otherGroup)).Should(Succeed())
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+
+			// Act.
+			err := adapter.Deregister(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(slices()).Should(HaveLen(1))
+			_, err = client.CoreV1().Services("marathon").Get(context.Background(), "web-app", metav1.GetOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should tolerate already deleted services", func() {
+			// Act.
+			err := adapter.Deregister(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Describe("Services()", func() {
+		It("Should read back owned services as registered", func() {
+			// Arrange.
+			other := NewFromClient(client, "marathon", "10.10.10.20", false)
+			otherGroup := webGroup()
+			otherGroup.IP = "10.10.10.20"
+			otherGroup.Services[0].ID = "web_app.5877d4d2-7b4b-11e5-b945-56847afe9799:31001"
+			Ω(other.Register(otherGroup)).Should(Succeed())
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+
+			// Act.
+			groups, err := adapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(Equal([]*types.ServiceGroup{webGroup()}))
+		})
+
+		It("Should skip foreign EndpointSlices without service definition", func() {
+			// Arrange.
+			_, err := client.DiscoveryV1().EndpointSlices("marathon").Create(context.Background(), &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "web-app-manual",
+					Labels: map[string]string{
+						discoveryv1.LabelManagedBy: managedBy,
+						advertiseAddrLabel:         "10.10.10.10",
+					},
+				},
+			}, metav1.CreateOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// Act.
+			groups, err := adapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(BeEmpty())
+		})
+	})
+
+	Describe("AdvertiseAddr()", func() {
+		It("Should return configured advertise address", func() {
+			// Act.
+			addr, err := adapter.AdvertiseAddr()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(addr).Should(Equal("10.10.10.10"))
+		})
+	})
+
+	Describe("Dry run", func() {
+		It("Should not change cluster state", func() {
+			// Arrange.
+			adapter = NewFromClient(client, "marathon", "10.10.10.10", true)
+
+			// Act.
+			registerErr := adapter.Register(webGroup())
+			deregisterErr := adapter.Deregister(webGroup())
+
+			// Assert.
+			Ω(registerErr).ShouldNot(HaveOccurred())
+			Ω(deregisterErr).ShouldNot(HaveOccurred())
+			Ω(client.Actions()).Should(BeEmpty())
+		})
+	})
+
+	Describe("serviceName()", func() {
+		It("Should convert service names to DNS labels", func() {
+			Ω(serviceName("Web_App.v2")).Should(Equal("web-app-v2"))
+			Ω(serviceName("1-web")).Should(Equal("web"))
+		})
+	})
+})
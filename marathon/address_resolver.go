@@ -1,20 +1,26 @@
 package marathon
 
 import (
+	"context"
 	"net"
 
+	"github.com/x-cray/marathon-registrator/tracing"
+
 	log "github.com/Sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // AddressResolver is the interface for address resolver implementations.
 type AddressResolver interface {
-	Resolve(hostname string) (string, error)
+	Resolve(ctx context.Context, hostname string) (string, error)
 }
 
 type defaultAddressResolver struct{}
 
-func (r defaultAddressResolver) Resolve(hostname string) (string, error) {
+func (r defaultAddressResolver) Resolve(ctx context.Context, hostname string) (string, error) {
+	_, span := tracing.Start(ctx, "marathon.Resolve", attribute.String("hostname", hostname))
 	address, err := net.ResolveIPAddr("ip", hostname)
+	tracing.End(span, err)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"prefix":   "resolver",
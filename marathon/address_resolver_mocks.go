@@ -4,6 +4,8 @@
 package marathon
 
 import (
+	context "context"
+
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -28,13 +30,13 @@ func (_m *MockAddressResolver) EXPECT() *_MockAddressResolverRecorder {
 	return _m.recorder
 }
 
-func (_m *MockAddressResolver) Resolve(hostname string) (string, error) {
-	ret := _m.ctrl.Call(_m, "Resolve", hostname)
+func (_m *MockAddressResolver) Resolve(ctx context.Context, hostname string) (string, error) {
+	ret := _m.ctrl.Call(_m, "Resolve", ctx, hostname)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockAddressResolverRecorder) Resolve(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Resolve", arg0)
+func (_mr *_MockAddressResolverRecorder) Resolve(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Resolve", arg0, arg1)
 }
@@ -0,0 +1,164 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	marathonClient "github.com/gambol99/go-marathon"
+)
+
+const (
+	// EventsTransportSSE receives events from Marathon event stream (/v2/events).
+	EventsTransportSSE = "sse"
+
+	// EventsTransportCallback receives events posted by Marathon to callback listener registered
+	// with /v2/eventSubscriptions.
+	EventsTransportCallback = "callback"
+
+	defaultCallbackPath = "/marathon/events"
+)
+
+// Options holds Marathon events settings.
+type Options struct {
+	EventsTransport string
+
+	// Address to listen for Marathon HTTP callbacks on, i.e. :4000.
+	CallbackListen string
+
+	// URL Marathon posts events to. When empty, it is derived from CallbackListen address.
+	CallbackURL string
+}
+
+// callbackHandler converts events posted by Marathon to abstract events and writes them to channel.
+type callbackHandler struct {
+	adapter *Adapter
+	channel types.EventsChannel
+}
+
+func (h *callbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	header := struct {
+		EventType string `json:"eventType"`
+	}{}
+	if err := json.Unmarshal(body, &header); err != nil {
+		log.WithFields(log.Fields{
+			"prefix": "marathon",
+			"err":    err,
+		}).Warn("Unable to decode Marathon callback event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	event, err := marathonClient.GetEvent(header.EventType)
+	if err != nil {
+		// Event is of type we are not interested in.
+		log.WithFields(log.Fields{
+			"prefix": "marathon",
+			"type":   header.EventType,
+		}).Debug("Skipping unsupported Marathon callback event")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := json.Unmarshal(body, event.Event); err != nil {
+		log.WithFields(log.Fields{
+			"prefix": "marathon",
+			"type":   header.EventType,
+			"err":    err,
+		}).Warn("Unable to decode Marathon callback event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	serviceEvent := h.adapter.toServiceEvent(event)
+	serviceEvent.RawEvent = body
+	h.channel <- serviceEvent
+	w.WriteHeader(http.StatusOK)
+}
+
+// listenForCallbacks starts callback listener and subscribes it to Marathon events.
+func (m *Adapter) listenForCallbacks(channel types.EventsChannel) error {
+	listener, err := net.Listen("tcp", m.options.CallbackListen)
+	if err != nil {
+		return err
+	}
+
+	callbackURL := m.options.CallbackURL
+	if callbackURL == "" {
+		callbackURL, err = defaultCallbackURL(listener.Addr())
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	uri, err := url.Parse(callbackURL)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	path := uri.Path
+	if path == "" {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, &callbackHandler{adapter: m, channel: channel})
+	m.server = &http.Server{Handler: mux}
+	go m.server.Serve(listener)
+
+	if err := m.currentClient().Subscribe(callbackURL); err != nil {
+		m.server.Close()
+		return err
+	}
+
+	m.callbackURL = callbackURL
+	log.WithField("prefix", "marathon").Infof("Subscribed %s to Marathon events", callbackURL)
+
+	return nil
+}
+
+// defaultCallbackURL builds callback URL from the address callback listener is bound to.
+func defaultCallbackURL(addr net.Addr) (string, error) {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.IP.IsUnspecified() {
+		return "", fmt.Errorf("Callback URL must be specified when listening on %s", addr)
+	}
+
+	return fmt.Sprintf("http://%s%s", tcpAddr, defaultCallbackPath), nil
+}
+
+// Close stops event forwarding and leader tracking, removes callback subscription from Marathon
+// and stops callback listener.
+func (m *Adapter) Close() error {
+	m.cancel()
+	if m.server == nil {
+		return nil
+	}
+
+	err := m.currentClient().Unsubscribe(m.callbackURL)
+	if err == nil {
+		log.WithField("prefix", "marathon").Infof("Unsubscribed %s from Marathon events", m.callbackURL)
+	}
+	m.server.Close()
+	m.server = nil
+
+	return err
+}
@@ -0,0 +1,130 @@
+package marathon
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func postFixture(callbackURL, fixture string) int {
+	body, err := os.Open("testdata/" + fixture)
+	Ω(err).ShouldNot(HaveOccurred())
+	defer body.Close()
+
+	response, err := http.Post(callbackURL, "application/json", body)
+	Ω(err).ShouldNot(HaveOccurred())
+	response.Body.Close()
+
+	return response.StatusCode
+}
+
+var _ = Describe("MarathonAdapter callback transport", func() {
+	var (
+		mockCtrl        *gomock.Controller
+		client          *MockClient
+		resolver        *MockAddressResolver
+		marathonAdapter *Adapter
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		client = NewMockClient(mockCtrl)
+		resolver = NewMockAddressResolver(mockCtrl)
+		ctx, cancel := context.WithCancel(context.Background())
+		marathonAdapter = &Adapter{
+			client:   client,
+			resolver: resolver,
+			options: &Options{
+				EventsTransport: EventsTransportCallback,
+				CallbackListen:  "127.0.0.1:0",
+			},
+			ctx:    ctx,
+			cancel: cancel,
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	Describe("ListenForEvents()", func() {
+		It("Should forward subscription errors", func() {
+			// Arrange.
+			client.EXPECT().Subscribe(gomock.Any()).Return(errors.New("marathon-error"))
+
+			// Act.
+			err := marathonAdapter.ListenForEvents(make(types.EventsChannel))
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should require callback URL when listening on all interfaces", func() {
+			// Arrange.
+			marathonAdapter.options.CallbackListen = ":0"
+
+			// Act.
+			err := marathonAdapter.ListenForEvents(make(types.EventsChannel))
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert posted events and unsubscribe on close", func() {
+			// Arrange.
+			var callbackURL string
+			client.EXPECT().Subscribe(gomock.Any()).Do(func(url string) {
+				callbackURL = url
+			}).Return(nil)
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil)
+			channel := make(types.EventsChannel, 5)
+
+			// Act.
+			err := marathonAdapter.ListenForEvents(channel)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(callbackURL).Should(MatchRegexp(`^http://127\.0\.0\.1:\d+/marathon/events$`))
+
+			Ω(postFixture(callbackURL, "status_update_event.json")).Should(Equal(http.StatusOK))
+			var event *types.ServiceEvent
+			Ω(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("web_app_2c033893-7993-11e5-8878-56847afe9799"))
+			Ω(event.IP).Should(Equal("10.10.10.20"))
+			Ω(event.Action).Should(Equal(types.ServiceStarted))
+			fixture, err := ioutil.ReadFile("testdata/status_update_event.json")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(event.RawEvent).Should(Equal(fixture))
+
+			Ω(postFixture(callbackURL, "health_status_changed_event.json")).Should(Equal(http.StatusOK))
+			Ω(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("web_app_2c033893-7993-11e5-8878-56847afe9799"))
+			Ω(event.Action).Should(Equal(types.ServiceWentDown))
+
+			Ω(postFixture(callbackURL, "unknown_event.json")).Should(Equal(http.StatusOK))
+			Ω(channel).ShouldNot(Receive())
+
+			response, err := http.Get(callbackURL)
+			Ω(err).ShouldNot(HaveOccurred())
+			response.Body.Close()
+			Ω(response.StatusCode).Should(Equal(http.StatusMethodNotAllowed))
+
+			// Act.
+			client.EXPECT().Unsubscribe(callbackURL).Return(nil).Times(1)
+			err = marathonAdapter.Close()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = http.Post(callbackURL, "application/json", nil)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
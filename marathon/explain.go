@@ -0,0 +1,118 @@
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/x-cray/marathon-registrator/metadata"
+
+	marathonClient "github.com/gambol99/go-marathon"
+)
+
+// AppExplanation describes how Marathon application tasks are converted to services.
+type AppExplanation struct {
+	AppID string             `json:"appId"`
+	Tasks []*TaskExplanation `json:"tasks"`
+}
+
+// TaskExplanation describes how a single Marathon task is converted to service group.
+type TaskExplanation struct {
+	TaskID   string             `json:"taskId"`
+	Host     string             `json:"host"`
+	State    string             `json:"state,omitempty"`
+	IP       string             `json:"ip,omitempty"`
+	Decision string             `json:"decision,omitempty"`
+	Error    string             `json:"error,omitempty"`
+	Ports    []*PortExplanation `json:"ports,omitempty"`
+}
+
+// PortExplanation describes the service computed for a single task port.
+type PortExplanation struct {
+	ServiceID    string               `json:"serviceId"`
+	Name         string               `json:"name"`
+	Tags         []string             `json:"tags"`
+	Healthy      bool                 `json:"healthy"`
+	Local        bool                 `json:"local"`
+	OriginalPort int                  `json:"originalPort"`
+	ExposedPort  int                  `json:"exposedPort"`
+	Decision     string               `json:"decision"`
+	Metadata     []*metadata.Decision `json:"metadata"`
+}
+
+// Explain describes how tasks of the application are converted to services and which of them
+// are to be registered by registrator running on the node with advertiseAddr address to registry
+// tracking readiness or not.
+func (m *Adapter) Explain(appID, advertiseAddr string, tracksReadiness bool) (*AppExplanation, error) {
+	params := make(url.Values)
+	params.Add("embed", "apps.tasks")
+	params.Add("id", appID)
+	applications, err := m.currentClient().Applications(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var app *marathonClient.Application
+	for i := range applications.Apps {
+		if applications.Apps[i].ID == appID {
+			app = &applications.Apps[i]
+			break
+		}
+	}
+	if app == nil {
+		return nil, fmt.Errorf("Application %s was not found", appID)
+	}
+
+	result := &AppExplanation{AppID: app.ID}
+	for _, task := range app.Tasks {
+		taskExplanation := &TaskExplanation{
+			TaskID: task.ID,
+			Host:   task.Host,
+			State:  task.State,
+		}
+		result.Tasks = append(result.Tasks, taskExplanation)
+		if !isRunning(task) {
+			taskExplanation.Decision = fmt.Sprintf("not running, task is %s", task.State)
+			continue
+		}
+
+		group, err := m.toServiceGroup(context.Background(), task, app)
+		if err != nil {
+			taskExplanation.Error = err.Error()
+			continue
+		}
+
+		taskExplanation.IP = group.IP
+		for _, service := range group.Services {
+			_, decisions := serviceMetadata(app, service.OriginalPort)
+			portExplanation := &PortExplanation{
+				ServiceID:    service.ID,
+				Name:         service.Name,
+				Tags:         service.Tags,
+				Healthy:      service.Healthy,
+				Local:        group.IP == advertiseAddr,
+				OriginalPort: service.OriginalPort,
+				ExposedPort:  service.ExposedPort,
+				Metadata:     decisions,
+			}
+
+			switch reason := group.SkipReason(service, advertiseAddr, tracksReadiness); {
+			case reason != "":
+				portExplanation.Decision = "skipped, " + reason
+			case !service.Healthy:
+				portExplanation.Decision = "registered as not ready"
+			default:
+				portExplanation.Decision = "registered"
+			}
+
+			taskExplanation.Ports = append(taskExplanation.Ports, portExplanation)
+		}
+	}
+
+	return result, nil
+}
+
+// isRunning tells whether the task is running. Tasks are assumed running when Marathon does not report their state.
+func isRunning(task *marathonClient.Task) bool {
+	return task.State == "" || startupTaskStatuses[task.State]
+}
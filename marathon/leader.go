@@ -0,0 +1,349 @@
+package marathon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/tracing"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	marathonClient "github.com/gambol99/go-marathon"
+)
+
+var (
+	// Interval between checks of the current Marathon leader.
+	leaderCheckInterval = 10 * time.Second
+
+	// Marathon events the adapter is interested in.
+	marathonEventTypes = marathonClient.EventIDApplications | marathonClient.EventIDFrameworkMessage
+
+	errClientClosed = errors.New("Marathon client is closed since the leader has changed")
+)
+
+// leaderDiscovery finds the current leader among Marathon instances of HA setup using /v2/leader endpoint.
+type leaderDiscovery struct {
+	scheme     string
+	path       string
+	members    []string
+	httpClient *http.Client
+}
+
+// newLeaderDiscovery creates leaderDiscovery for Marathon URL in http://addr1:8080,addr2:8080[/path] format.
+func newLeaderDiscovery(marathonURL string) (*leaderDiscovery, error) {
+	schemeAndAddress := strings.SplitN(marathonURL, "://", 2)
+	if len(schemeAndAddress) != 2 {
+		return nil, fmt.Errorf("Marathon URL %q must include scheme", marathonURL)
+	}
+
+	hosts, path := schemeAndAddress[1], ""
+	if i := strings.Index(hosts, "/"); i >= 0 {
+		hosts, path = hosts[:i], strings.TrimSuffix(hosts[i:], "/")
+	}
+
+	var members []string
+	for _, member := range strings.Split(hosts, ",") {
+		if member != "" {
+			members = append(members, member)
+		}
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("Marathon URL %q has no addresses", marathonURL)
+	}
+
+	return &leaderDiscovery{
+		scheme:  schemeAndAddress[0],
+		path:    path,
+		members: members,
+		httpClient: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}, nil
+}
+
+func (d *leaderDiscovery) memberURL(member string) string {
+	return d.scheme + "://" + member + d.path
+}
+
+// discover returns URL of the current Marathon leader. Known leader, when specified, is asked first.
+func (d *leaderDiscovery) discover(knownLeaderURL string) (string, error) {
+	candidates := make([]string, 0, len(d.members)+1)
+	if knownLeaderURL != "" {
+		candidates = append(candidates, knownLeaderURL)
+	}
+	for _, member := range d.members {
+		candidates = append(candidates, d.memberURL(member))
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		leader, err := d.leaderOf(candidate)
+		if err == nil {
+			return d.memberURL(leader), nil
+		}
+
+		lastErr = err
+		log.WithFields(log.Fields{
+			"prefix":   "marathon",
+			"endpoint": candidate,
+			"err":      err,
+		}).Debug("Unable to get Marathon leader")
+	}
+
+	return "", fmt.Errorf("Unable to discover Marathon leader: %v", lastErr)
+}
+
+// leaderOf asks Marathon instance at baseURL which instance is the leader.
+func (d *leaderDiscovery) leaderOf(baseURL string) (string, error) {
+	response, err := d.httpClient.Get(baseURL + "/v2/leader")
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s/v2/leader responded with %s", baseURL, response.Status)
+	}
+
+	result := struct {
+		Leader string `json:"leader"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.Leader == "" {
+		return "", errors.New("Marathon has no leader")
+	}
+
+	return result.Leader, nil
+}
+
+// leaderClient is Marathon client talking to a single leader. It is closed once the leader changes.
+type leaderClient struct {
+	marathonClient.Marathon
+	transport *closingTransport
+}
+
+// Close interrupts event stream and requests in progress and refuses further requests, so that
+// reconnection attempts of the client event stream fail without reaching the previous leader.
+func (c *leaderClient) Close() error {
+	c.transport.Close()
+	return nil
+}
+
+// connect creates Marathon client talking to the instance at leaderURL only.
+func (m *Adapter) connect(leaderURL string) (Client, error) {
+	transport := newClosingTransport(tracing.Transport(http.DefaultTransport))
+	config := marathonClient.NewDefaultConfig()
+	config.URL = leaderURL
+	config.EventsTransport = marathonClient.EventsTransportSSE
+	config.HTTPClient = &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: m.checkRedirect,
+		Transport:     transport,
+	}
+	config.HTTPSSEClient = &http.Client{
+		CheckRedirect: m.checkRedirect,
+		Transport:     transport,
+	}
+
+	client, err := marathonClient.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &leaderClient{Marathon: client, transport: transport}, nil
+}
+
+// closingTransport is the transport which may be closed cancelling requests in progress, including
+// long-living event stream requests, and refusing further requests.
+type closingTransport struct {
+	transport http.RoundTripper
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newClosingTransport(transport http.RoundTripper) *closingTransport {
+	return &closingTransport{
+		transport: transport,
+		done:      make(chan struct{}),
+	}
+}
+
+func (t *closingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-t.done:
+		return nil, errClientClosed
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	go func() {
+		select {
+		case <-t.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	response, err := t.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancellingBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// Close cancels requests in progress.
+func (t *closingTransport) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+}
+
+// cancellingBody releases request context once response body is closed.
+type cancellingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancellingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// checkRedirect follows redirects while noting that the leader has probably changed
+// since non-leader Marathon instances redirect requests to the leader.
+func (m *Adapter) checkRedirect(req *http.Request, via []*http.Request) error {
+	log.WithFields(log.Fields{
+		"prefix":   "marathon",
+		"location": req.URL,
+	}).Debug("Marathon request was redirected")
+	m.suspectLeaderChange()
+
+	if len(via) >= 10 {
+		return errors.New("Stopped after 10 redirects")
+	}
+	return nil
+}
+
+// suspectLeaderChange schedules an immediate leader check.
+func (m *Adapter) suspectLeaderChange() {
+	if m.leader == nil {
+		return
+	}
+
+	select {
+	case m.leaderCheck <- true:
+	default:
+	}
+}
+
+// currentClient returns client talking to the current Marathon leader.
+func (m *Adapter) currentClient() Client {
+	m.clientLock.RLock()
+	defer m.clientLock.RUnlock()
+	return m.client
+}
+
+// ActiveEndpoint returns URL of Marathon instance the adapter currently talks to.
+func (m *Adapter) ActiveEndpoint() string {
+	m.clientLock.RLock()
+	defer m.clientLock.RUnlock()
+	return m.activeURL
+}
+
+// watchLeader periodically checks the current Marathon leader and moves event stream to the new
+// leader once it changes. Resync is requested afterwards since events might have been missed meanwhile.
+func (m *Adapter) watchLeader(update marathonClient.EventsChannel, channel types.EventsChannel) {
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.leaderCheck:
+		case <-m.ctx.Done():
+			return
+		}
+		if m.ctx.Err() != nil {
+			return
+		}
+
+		activeURL := m.ActiveEndpoint()
+		leaderURL, err := m.leader.discover(activeURL)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"prefix": "marathon",
+				"err":    err,
+			}).Warn("Unable to check Marathon leader")
+			continue
+		}
+		if leaderURL == activeURL {
+			continue
+		}
+
+		log.WithField("prefix", "marathon").Infof("Marathon leader changed from %s to %s, reconnecting", activeURL, leaderURL)
+		if err := m.switchLeader(leaderURL, update); err != nil {
+			log.WithFields(log.Fields{
+				"prefix": "marathon",
+				"leader": leaderURL,
+				"err":    err,
+			}).Error("Failed to reconnect to Marathon leader")
+			continue
+		}
+
+		select {
+		case channel <- &types.ServiceEvent{
+			Action:        types.ServiceResync,
+			OriginalEvent: fmt.Sprintf("Marathon leader changed to %s", leaderURL),
+		}:
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// switchLeader moves API and event stream traffic to Marathon instance at leaderURL.
+// Events listener is not moved when update is nil.
+func (m *Adapter) switchLeader(leaderURL string, update marathonClient.EventsChannel) error {
+	client, err := m.newClient(leaderURL)
+	if err != nil {
+		return err
+	}
+	if update != nil {
+		if err := client.AddEventsListener(update, marathonEventTypes); err != nil {
+			closeClient(client)
+			return err
+		}
+	}
+
+	m.clientLock.Lock()
+	previous := m.client
+	m.client = client
+	m.activeURL = leaderURL
+	m.clientLock.Unlock()
+
+	if update != nil {
+		previous.RemoveEventsListener(update)
+	}
+	closeClient(previous)
+
+	return nil
+}
+
+// closeClient closes event stream and connections of client no longer in use.
+func closeClient(client Client) {
+	if closer, ok := client.(io.Closer); ok {
+		closer.Close()
+	}
+}
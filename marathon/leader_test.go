@@ -0,0 +1,295 @@
+package marathon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	marathonClient "github.com/gambol99/go-marathon"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeMarathonCluster serves /v2/leader with the same programmable leader on all instances.
+type fakeMarathonCluster struct {
+	sync.Mutex
+	leader  string
+	servers []*httptest.Server
+}
+
+func newFakeMarathonCluster(size int) *fakeMarathonCluster {
+	cluster := &fakeMarathonCluster{}
+	for i := 0; i < size; i++ {
+		cluster.servers = append(cluster.servers, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cluster.Lock()
+			defer cluster.Unlock()
+			if r.URL.Path != "/v2/leader" || cluster.leader == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"leader":%q}`, cluster.leader)
+		})))
+	}
+	return cluster
+}
+
+func (c *fakeMarathonCluster) host(i int) string {
+	return strings.TrimPrefix(c.servers[i].URL, "http://")
+}
+
+func (c *fakeMarathonCluster) setLeader(i int) {
+	c.Lock()
+	defer c.Unlock()
+	c.leader = c.host(i)
+}
+
+func (c *fakeMarathonCluster) url() string {
+	var hosts []string
+	for i := range c.servers {
+		hosts = append(hosts, c.host(i))
+	}
+	return "http://" + strings.Join(hosts, ",")
+}
+
+func (c *fakeMarathonCluster) close() {
+	for _, server := range c.servers {
+		server.Close()
+	}
+}
+
+// closableClient is Marathon client noting that it was closed.
+type closableClient struct {
+	*MockClient
+	closed chan bool
+}
+
+func (c *closableClient) Close() error {
+	c.closed <- true
+	return nil
+}
+
+var _ = Describe("Marathon leader discovery", func() {
+	var cluster *fakeMarathonCluster
+
+	BeforeEach(func() {
+		cluster = newFakeMarathonCluster(3)
+	})
+
+	AfterEach(func() {
+		cluster.close()
+	})
+
+	It("Should parse Marathon HA URL", func() {
+		// Act.
+		discovery, err := newLeaderDiscovery("https://addr1:8080,addr2:8080/marathon/")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(discovery.members).Should(Equal([]string{"addr1:8080", "addr2:8080"}))
+		Ω(discovery.memberURL("addr2:8080")).Should(Equal("https://addr2:8080/marathon"))
+	})
+
+	It("Should reject URL without scheme", func() {
+		// Act.
+		_, err := newLeaderDiscovery("addr1:8080,addr2:8080")
+
+		// Assert.
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("Should discover leader skipping unavailable instances", func() {
+		// Arrange.
+		cluster.setLeader(2)
+		cluster.servers[0].Close()
+		discovery, _ := newLeaderDiscovery(cluster.url())
+
+		// Act.
+		leaderURL, err := discovery.discover("")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(leaderURL).Should(Equal(cluster.servers[2].URL))
+	})
+
+	It("Should fail when cluster has no leader", func() {
+		// Arrange.
+		discovery, _ := newLeaderDiscovery(cluster.url())
+
+		// Act.
+		_, err := discovery.discover(cluster.servers[1].URL)
+
+		// Assert.
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("Failover", func() {
+		var (
+			mockCtrl        *gomock.Controller
+			oldClient       *MockClient
+			newClient       *MockClient
+			marathonAdapter *Adapter
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			oldClient = NewMockClient(mockCtrl)
+			newClient = NewMockClient(mockCtrl)
+			cluster.setLeader(0)
+			discovery, _ := newLeaderDiscovery(cluster.url())
+			ctx, cancel := context.WithCancel(context.Background())
+			marathonAdapter = &Adapter{
+				client:      oldClient,
+				resolver:    NewMockAddressResolver(mockCtrl),
+				leader:      discovery,
+				activeURL:   cluster.servers[0].URL,
+				leaderCheck: make(chan bool, 1),
+				newClient: func(leaderURL string) (Client, error) {
+					if leaderURL != cluster.servers[1].URL {
+						return nil, errors.New("unexpected leader")
+					}
+					return newClient, nil
+				},
+				ctx:    ctx,
+				cancel: cancel,
+			}
+			leaderCheckInterval = time.Hour
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+			leaderCheckInterval = 10 * time.Second
+		})
+
+		It("Should move event stream to the new leader and request resync", func() {
+			// Arrange.
+			var update marathonClient.EventsChannel
+			oldClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Do(func(channel marathonClient.EventsChannel, filter int) {
+				update = channel
+			}).Return(nil)
+			oldClient.EXPECT().Applications(gomock.Any()).Return(nil, errors.New("marathon-error"))
+			newClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Return(nil)
+			oldClient.EXPECT().RemoveEventsListener(gomock.Any()).Do(func(channel marathonClient.EventsChannel) {
+				Ω(channel).Should(Equal(update))
+			})
+			newClient.EXPECT().Applications(gomock.Any()).Return(&marathonClient.Applications{}, nil)
+			channel := make(types.EventsChannel, 5)
+
+			// Act.
+			err := marathonAdapter.ListenForEvents(channel)
+			Ω(err).ShouldNot(HaveOccurred())
+			cluster.setLeader(1)
+			_, err = marathonAdapter.Services()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+			var event *types.ServiceEvent
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceResync))
+			Ω(marathonAdapter.ActiveEndpoint()).Should(Equal(cluster.servers[1].URL))
+
+			// Act.
+			_, err = marathonAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should close event stream of the previous leader client", func() {
+			// Arrange.
+			previous := &closableClient{MockClient: oldClient, closed: make(chan bool, 1)}
+			marathonAdapter.client = previous
+			oldClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Return(nil)
+			newClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Return(nil)
+			oldClient.EXPECT().RemoveEventsListener(gomock.Any())
+			channel := make(types.EventsChannel, 5)
+
+			// Act.
+			err := marathonAdapter.ListenForEvents(channel)
+			Ω(err).ShouldNot(HaveOccurred())
+			cluster.setLeader(1)
+			marathonAdapter.suspectLeaderChange()
+
+			// Assert.
+			Eventually(channel).Should(Receive())
+			Ω(previous.closed).Should(Receive())
+		})
+
+		It("Should keep current leader when reconnection fails", func() {
+			// Arrange.
+			oldClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Return(nil)
+			newClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Return(errors.New("marathon-error"))
+			channel := make(types.EventsChannel, 5)
+
+			// Act.
+			err := marathonAdapter.ListenForEvents(channel)
+			Ω(err).ShouldNot(HaveOccurred())
+			cluster.setLeader(1)
+			marathonAdapter.suspectLeaderChange()
+
+			// Assert.
+			Consistently(channel, "100ms").ShouldNot(Receive())
+			Ω(marathonAdapter.ActiveEndpoint()).Should(Equal(cluster.servers[0].URL))
+		})
+
+		It("Should stop forwarding events and tracking leader once closed", func() {
+			// Arrange.
+			var update marathonClient.EventsChannel
+			oldClient.EXPECT().AddEventsListener(gomock.Any(), marathonEventTypes).Do(func(channel marathonClient.EventsChannel, filter int) {
+				update = channel
+			}).Return(nil)
+			channel := make(types.EventsChannel)
+			err := marathonAdapter.ListenForEvents(channel)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// Act.
+			err = marathonAdapter.Close()
+			cluster.setLeader(1)
+			marathonAdapter.suspectLeaderChange()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(update).Should(BeSent(&marathonClient.Event{}))
+			Consistently(channel, "100ms").ShouldNot(Receive())
+			Ω(marathonAdapter.ActiveEndpoint()).Should(Equal(cluster.servers[0].URL))
+		})
+	})
+
+	Describe("closingTransport", func() {
+		It("Should interrupt requests in progress and refuse further requests once closed", func() {
+			// Arrange.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			}))
+			defer server.Close()
+			transport := newClosingTransport(http.DefaultTransport)
+			client := &http.Client{Transport: transport}
+			response, err := client.Get(server.URL + "/v2/events")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer response.Body.Close()
+			read := make(chan error, 1)
+			go func() {
+				_, err := ioutil.ReadAll(response.Body)
+				read <- err
+			}()
+
+			// Act.
+			transport.Close()
+
+			// Assert.
+			Eventually(read).Should(Receive(HaveOccurred()))
+			_, err = client.Get(server.URL + "/v2/events")
+			Ω(err).Should(MatchError(ContainSubstring(errClientClosed.Error())))
+		})
+	})
+})
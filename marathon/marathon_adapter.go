@@ -1,16 +1,21 @@
 package marathon
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/x-cray/marathon-registrator/metadata"
+	"github.com/x-cray/marathon-registrator/tracing"
 	"github.com/x-cray/marathon-registrator/types"
 
 	log "github.com/Sirupsen/logrus"
 	marathonClient "github.com/gambol99/go-marathon"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -30,56 +35,175 @@ var (
 type Adapter struct {
 	client   Client
 	resolver AddressResolver
+	options  *Options
+
+	// Callback listener, when events are received with EventsTransportCallback.
+	server      *http.Server
+	callbackURL string
+
+	// Leader tracking. Client talks to the current leader only and is replaced once the leader changes.
+	leader      *leaderDiscovery
+	newClient   func(leaderURL string) (Client, error)
+	clientLock  sync.RWMutex
+	activeURL   string
+	leaderCheck chan bool
+
+	// Event forwarding and leader tracking are stopped once ctx is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// New creates a new Adapter.
-func New(marathonURL string) (*Adapter, error) {
-	config := marathonClient.NewDefaultConfig()
-	config.URL = marathonURL
-	config.EventsTransport = marathonClient.EventsTransportSSE
+// New creates a new Adapter. Events are received from Marathon event stream unless options specify otherwise.
+func New(marathonURL string, options *Options) (*Adapter, error) {
+	if options == nil {
+		options = &Options{EventsTransport: EventsTransportSSE}
+	}
+	switch {
+	case options.EventsTransport != EventsTransportSSE && options.EventsTransport != EventsTransportCallback:
+		return nil, fmt.Errorf("Unsupported Marathon events transport: %s", options.EventsTransport)
+	case options.EventsTransport == EventsTransportCallback && options.CallbackListen == "":
+		return nil, errors.New("Marathon callback listen address is not specified")
+	}
+
+	leader, err := newLeaderDiscovery(marathonURL)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("prefix", "marathon").Infof("Discovering Marathon leader at %v", marathonURL)
+	leaderURL, err := leader.discover("")
+	if err != nil {
+		return nil, err
+	}
 
-	log.WithField("prefix", "marathon").Infof("Connecting to Marathon at %v", marathonURL)
-	client, err := marathonClient.NewClient(config)
+	ctx, cancel := context.WithCancel(context.Background())
+	adapter := &Adapter{
+		resolver:    &defaultAddressResolver{},
+		options:     options,
+		leader:      leader,
+		activeURL:   leaderURL,
+		leaderCheck: make(chan bool, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	adapter.newClient = adapter.connect
+
+	log.WithField("prefix", "marathon").Infof("Connecting to Marathon leader at %v", leaderURL)
+	adapter.client, err = adapter.newClient(leaderURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Adapter{
-		client:   client,
-		resolver: &defaultAddressResolver{},
-	}, nil
+	return adapter, nil
 }
 
 // ListenForEvents subscribes to Marathon events and publishes them to channel.
 func (m *Adapter) ListenForEvents(channel types.EventsChannel) error {
+	if m.options != nil && m.options.EventsTransport == EventsTransportCallback {
+		if err := m.listenForCallbacks(channel); err != nil {
+			return err
+		}
+
+		// Event subscriptions are shared by Marathon instances, so only API traffic follows the leader.
+		if m.leader != nil {
+			go m.watchLeader(nil, channel)
+		}
+		return nil
+	}
+
 	update := make(marathonClient.EventsChannel, 5)
-	eventTypes := marathonClient.EventIDApplications | marathonClient.EventIDFrameworkMessage
-	if err := m.client.AddEventsListener(update, eventTypes); err != nil {
+	if err := m.currentClient().AddEventsListener(update, marathonEventTypes); err != nil {
+		m.suspectLeaderChange()
 		return err
 	}
+	if m.leader != nil {
+		go m.watchLeader(update, channel)
+	}
 
 	// Convert Marathon events to abstract events and write to output channel.
 	go func() {
 		for {
-			event := <-update
-			channel <- m.toServiceEvent(event)
+			select {
+			case event := <-update:
+				select {
+				case channel <- m.toServiceEvent(event):
+				case <-m.ctx.Done():
+					return
+				}
+			case <-m.ctx.Done():
+				return
+			}
 		}
 	}()
 
 	return nil
 }
 
-func (m *Adapter) toServiceHealthCheck(marathonHealthCheck *marathonClient.HealthCheck) (result *types.ServiceHealthCheck) {
-	result = &types.ServiceHealthCheck{}
+// toServiceHealthCheck converts Marathon health check to the registry one performing the same probe.
+// Returns nil for health checks which could not be performed by registry (i.e. COMMAND ones).
+func (m *Adapter) toServiceHealthCheck(marathonHealthCheck *marathonClient.HealthCheck, id, ip string, port int) (result *types.ServiceHealthCheck) {
+	result = &types.ServiceHealthCheck{
+		ID:       id,
+		Interval: metadata.DefaultCheckInterval,
+	}
+	if marathonHealthCheck.IntervalSeconds > 0 {
+		result.Interval = fmt.Sprintf("%ds", marathonHealthCheck.IntervalSeconds)
+	}
+	if marathonHealthCheck.TimeoutSeconds > 0 {
+		result.Timeout = fmt.Sprintf("%ds", marathonHealthCheck.TimeoutSeconds)
+	}
+
+	path := "/"
+	if marathonHealthCheck.Path != nil && *marathonHealthCheck.Path != "" {
+		path = *marathonHealthCheck.Path
+	}
+
+	switch marathonHealthCheck.Protocol {
+	case "HTTP", "MESOS_HTTP":
+		result.HTTP = fmt.Sprintf("http://%s:%d%s", ip, port, path)
+	case "HTTPS", "MESOS_HTTPS":
+		result.HTTP = fmt.Sprintf("https://%s:%d%s", ip, port, path)
+	case "TCP", "MESOS_TCP":
+		result.TCP = fmt.Sprintf("%s:%d", ip, port)
+	default:
+		return nil
+	}
 
 	return
 }
 
+// marathonHealthChecks returns health checks derived from Marathon application health checks
+// for the application port with index portIndex.
+func (m *Adapter) marathonHealthChecks(app *marathonClient.Application, ip string, portIndex, port int) []*types.ServiceHealthCheck {
+	var checks []*types.ServiceHealthCheck
+	if app.HealthChecks == nil {
+		return checks
+	}
+
+	for i, marathonHealthCheck := range *app.HealthChecks {
+		checkPortIndex := 0
+		if marathonHealthCheck.PortIndex != nil {
+			checkPortIndex = *marathonHealthCheck.PortIndex
+		}
+		if checkPortIndex != portIndex {
+			continue
+		}
+
+		check := m.toServiceHealthCheck(&marathonHealthCheck, fmt.Sprintf("marathon-%d", i), ip, port)
+		if check != nil {
+			checks = append(checks, check)
+		}
+	}
+
+	return checks
+}
+
 func (m *Adapter) toServiceEvent(marathonEvent *marathonClient.Event) (result *types.ServiceEvent) {
 	// Instantiate result object.
 	result = &types.ServiceEvent{
 		OriginalEvent: marathonEvent.Event,
 		Action:        types.ServiceUnchanged,
+		EventType:     marathonEvent.Name,
 	}
 
 	// Task status update event suggests that Marathon cached services list
@@ -89,7 +213,8 @@ func (m *Adapter) toServiceEvent(marathonEvent *marathonClient.Event) (result *t
 	statusUpdateEvent, ok := marathonEvent.Event.(*marathonClient.EventStatusUpdate)
 	if ok {
 		result.ServiceID = statusUpdateEvent.TaskID
-		address, err := m.resolver.Resolve(statusUpdateEvent.Host)
+		result.EventID = statusUpdateEvent.Timestamp
+		address, err := m.resolver.Resolve(context.Background(), statusUpdateEvent.Host)
 		if err == nil {
 			result.IP = address
 		}
@@ -106,6 +231,7 @@ func (m *Adapter) toServiceEvent(marathonEvent *marathonClient.Event) (result *t
 	healthStatusChangeEvent, ok := marathonEvent.Event.(*marathonClient.EventHealthCheckChanged)
 	if ok {
 		result.ServiceID = healthStatusChangeEvent.TaskID
+		result.EventID = healthStatusChangeEvent.Timestamp
 		if healthStatusChangeEvent.Alive {
 			result.Action = types.ServiceWentUp
 		} else {
@@ -116,52 +242,20 @@ func (m *Adapter) toServiceEvent(marathonEvent *marathonClient.Event) (result *t
 	return
 }
 
-func mapDefault(dict map[string]string, key, defaultValue string) string {
-	v, ok := dict[key]
-	if !ok || v == "" {
-		return defaultValue
-	}
-	return v
+// serviceMetadata collects service metadata from application environment and labels, the latter take precedence.
+func serviceMetadata(app *marathonClient.Application, port int) (metadata.Metadata, []*metadata.Decision) {
+	return metadata.Extract(
+		port,
+		metadata.Source{Name: "env", Values: stringMap(app.Env)},
+		metadata.Source{Name: "label", Values: stringMap(app.Labels)},
+	)
 }
 
-func extractServiceMetadata(source, destination map[string]string, port string) {
-	for k, v := range source {
-		if !strings.HasPrefix(k, "SERVICE_") {
-			continue
-		}
-
-		key := strings.ToLower(strings.TrimPrefix(k, "SERVICE_"))
-		portKey := strings.SplitN(key, "_", 2)
-		_, err := strconv.Atoi(portKey[0])
-		if err == nil && len(portKey) > 1 {
-			if portKey[0] != port {
-				continue
-			}
-			destination[portKey[1]] = v
-		} else {
-			destination[key] = v
-		}
+func stringMap(dict *map[string]string) map[string]string {
+	if dict == nil {
+		return map[string]string{}
 	}
-}
-
-func serviceMetadata(application *marathonClient.Application, port int) map[string]string {
-	result := make(map[string]string)
-	stringPort := strconv.Itoa(port)
-	if application.Env != nil {
-		extractServiceMetadata(*application.Env, result, stringPort)
-	}
-	if application.Labels != nil {
-		extractServiceMetadata(*application.Labels, result, stringPort)
-	}
-	return result
-}
-
-func parseTags(tagString string) []string {
-	var tags []string
-	if tagString != "" {
-		tags = append(tags, strings.Split(tagString, ",")...)
-	}
-	return tags
+	return *dict
 }
 
 func originalPorts(app *marathonClient.Application) []int {
@@ -197,8 +291,8 @@ func isHealthy(task *marathonClient.Task, app *marathonClient.Application) bool
 	return true
 }
 
-func (m *Adapter) toServiceGroup(task *marathonClient.Task, app *marathonClient.Application) (*types.ServiceGroup, error) {
-	taskIP, err := m.resolver.Resolve(task.Host)
+func (m *Adapter) toServiceGroup(ctx context.Context, task *marathonClient.Task, app *marathonClient.Application) (*types.ServiceGroup, error) {
+	taskIP, err := m.resolver.Resolve(ctx, task.Host)
 	if err != nil {
 		return nil, err
 	}
@@ -224,14 +318,23 @@ func (m *Adapter) toServiceGroup(task *marathonClient.Task, app *marathonClient.
 		if isGroup {
 			name += fmt.Sprintf("-%d", originalPort)
 		}
-		metadata := serviceMetadata(app, originalPort)
-		service := &types.Service{
-			ID:           fmt.Sprintf("%s:%d", serviceGroup.ID, originalPort),
-			Name:         mapDefault(metadata, "name", name),
-			Tags:         parseTags(mapDefault(metadata, "tags", "")),
-			Healthy:      isHealthy(task, app),
+		md, _ := serviceMetadata(app, originalPort)
+		context := &metadata.TemplateContext{
+			AppID:        app.ID,
+			TaskID:       task.ID,
+			Host:         task.Host,
+			IP:           taskIP,
 			OriginalPort: originalPort,
 			ExposedPort:  exposedPort,
+			Labels:       stringMap(app.Labels),
+			Env:          stringMap(app.Env),
+		}
+		service := md.Service(fmt.Sprintf("%s:%d", serviceGroup.ID, originalPort), name, context)
+		service.Healthy = isHealthy(task, app)
+
+		// Checks defined with labels take precedence over ones derived from Marathon application health checks.
+		if len(service.HealthChecks) == 0 {
+			service.HealthChecks = m.marathonHealthChecks(app, taskIP, i, exposedPort)
 		}
 		services[i] = service
 	}
@@ -241,17 +344,27 @@ func (m *Adapter) toServiceGroup(task *marathonClient.Task, app *marathonClient.
 
 // Services returns the list of registered services.
 func (m *Adapter) Services() ([]*types.ServiceGroup, error) {
+	return m.ServicesContext(context.Background())
+}
+
+// ServicesContext lists services of Marathon tasks tracing requests as part of the operation carried by ctx.
+// Marathon client does not take context, so applications request is traced with a span of its own.
+func (m *Adapter) ServicesContext(ctx context.Context) ([]*types.ServiceGroup, error) {
 	params := make(url.Values)
 	params.Add("embed", "apps.tasks")
-	applications, err := m.client.Applications(params)
+	_, span := tracing.Start(ctx, "marathon.Applications", attribute.String("endpoint", m.ActiveEndpoint()))
+	applications, err := m.currentClient().Applications(params)
+	tracing.End(span, err)
 	if err != nil {
+		// Failure may be caused by the leader being gone.
+		m.suspectLeaderChange()
 		return nil, err
 	}
 
 	var result []*types.ServiceGroup
 	for _, app := range applications.Apps {
 		for _, task := range app.Tasks {
-			group, err := m.toServiceGroup(task, &app)
+			group, err := m.toServiceGroup(ctx, task, &app)
 			if err != nil {
 				return nil, err
 			}
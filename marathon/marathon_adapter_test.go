@@ -4,6 +4,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/x-cray/marathon-registrator/metadata"
 	"github.com/x-cray/marathon-registrator/types"
 
 	log "github.com/Sirupsen/logrus"
@@ -129,6 +130,31 @@ var _ = Describe("MarathonAdapter", func() {
 		},
 	}
 
+	stagingApplications := &marathonClient.Applications{
+		Apps: []marathonClient.Application{
+			{
+				ID:    "/app/staging/web-app",
+				Ports: []int{80},
+				Tasks: []*marathonClient.Task{
+					{
+						ID:    "web_app_2c033893-7993-11e5-8878-56847afe9799",
+						AppID: "/app/staging/web-app",
+						Host:  "web.eu-west-1.internal",
+						Ports: []int{31045},
+						State: "TASK_RUNNING",
+					},
+					{
+						ID:    "web_app_3d144904-7993-11e5-8878-56847afe9799",
+						AppID: "/app/staging/web-app",
+						Host:  "web.eu-west-1.internal",
+						Ports: []int{31046},
+						State: "TASK_STAGING",
+					},
+				},
+			},
+		},
+	}
+
 	singlePortApplicationsWithLabels := &marathonClient.Applications{
 		Apps: []marathonClient.Application{
 			{
@@ -216,6 +242,74 @@ var _ = Describe("MarathonAdapter", func() {
 		},
 	}
 
+	metadataApplications := &marathonClient.Applications{
+		Apps: []marathonClient.Application{
+			{
+				ID: "/app/staging/web-app",
+				Env: &map[string]string{
+					"SERVICE_TAGS":         "production,version={{.Labels.VERSION}},port={{.ExposedPort}}",
+					"SERVICE_META_OWNER":   "web-team",
+					"SERVICE_80_META_TIER": "frontend",
+				},
+				Labels: &map[string]string{
+					"VERSION":                     "1.2.3",
+					"SERVICE_ENABLE_TAG_OVERRIDE": "true",
+					"SERVICE_WEIGHTS_PASSING":     "10",
+				},
+				Ports: []int{80},
+				Tasks: []*marathonClient.Task{
+					{
+						ID:    "web_app_2c033893-7993-11e5-8878-56847afe9799",
+						AppID: "/app/staging/web-app",
+						Host:  "web.eu-west-1.internal",
+						Ports: []int{31045},
+					},
+				},
+			},
+		},
+	}
+
+	healthCheckPath := "/health"
+	healthCheckPortIndex := 1
+	healthCheckApplications := &marathonClient.Applications{
+		Apps: []marathonClient.Application{
+			{
+				ID: "/app/staging/web-app",
+				Labels: &map[string]string{
+					"SERVICE_80_CHECK_HTTP":     "/status",
+					"SERVICE_80_CHECK_INTERVAL": "5s",
+					"SERVICE_80_CHECK_TIMEOUT":  "1s",
+				},
+				HealthChecks: &[]marathonClient.HealthCheck{
+					{
+						Protocol:        "HTTP",
+						Path:            &healthCheckPath,
+						IntervalSeconds: 30,
+						TimeoutSeconds:  20,
+					},
+					{
+						Protocol:        "TCP",
+						PortIndex:       &healthCheckPortIndex,
+						IntervalSeconds: 15,
+					},
+				},
+				Ports: []int{80, 8080},
+				Tasks: []*marathonClient.Task{
+					{
+						ID:    "web_app_2c033893-7993-11e5-8878-56847afe9799",
+						AppID: "/app/staging/web-app",
+						Host:  "web.eu-west-1.internal",
+						Ports: []int{31045, 31046},
+						HealthCheckResults: []*marathonClient.HealthCheckResult{
+							{Alive: true},
+							{Alive: true},
+						},
+					},
+				},
+			},
+		},
+	}
+
 	BeforeEach(func() {
 		mockCtrl = gomock.NewController(GinkgoT())
 		client = NewMockClient(mockCtrl)
@@ -242,7 +336,7 @@ var _ = Describe("MarathonAdapter", func() {
 		It("Should forward resolver errors", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(singlePortApplications, nil)
-			resolver.EXPECT().Resolve("web.eu-west-1.internal").Return("", errors.New("resolve-error"))
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("", errors.New("resolve-error"))
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -255,7 +349,7 @@ var _ = Describe("MarathonAdapter", func() {
 		It("Should detect inconsistent ports in app definition", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(inconsistentPortsApplications, nil)
-			resolver.EXPECT().Resolve(gomock.Any()).Return("10.10.10.20", nil).AnyTimes()
+			resolver.EXPECT().Resolve(gomock.Any(), gomock.Any()).Return("10.10.10.20", nil).AnyTimes()
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -268,7 +362,7 @@ var _ = Describe("MarathonAdapter", func() {
 		It("Should correctly handle instance health status", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(unhealthyApplications, nil)
-			resolver.EXPECT().Resolve(gomock.Any()).Return("10.10.10.20", nil).AnyTimes()
+			resolver.EXPECT().Resolve(gomock.Any(), gomock.Any()).Return("10.10.10.20", nil).AnyTimes()
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -292,7 +386,7 @@ var _ = Describe("MarathonAdapter", func() {
 		It("Should convert Marathon single-port application to service group with 1 service", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(singlePortApplications, nil)
-			resolver.EXPECT().Resolve("web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -317,10 +411,24 @@ var _ = Describe("MarathonAdapter", func() {
 			}))
 		})
 
+		It("Should keep tasks which are not running yet", func() {
+			// Arrange.
+			client.EXPECT().Applications(gomock.Any()).Return(stagingApplications, nil)
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			marathonAdapter := &Adapter{client: client, resolver: resolver}
+
+			// Act.
+			services, err := marathonAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(2))
+		})
+
 		It("Should convert Marathon single-port application to service group with respect to labels over environment variables", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(singlePortApplicationsWithLabels, nil)
-			resolver.EXPECT().Resolve("web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -348,7 +456,7 @@ var _ = Describe("MarathonAdapter", func() {
 		It("Should convert Marathon multi-port application with simple config to service group with 2 services", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(multiPortSimpleApplications, nil)
-			resolver.EXPECT().Resolve("web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -385,7 +493,7 @@ var _ = Describe("MarathonAdapter", func() {
 		It("Should convert Marathon multi-port dockerized application with complex config to service group with 2 services", func() {
 			// Arrange.
 			client.EXPECT().Applications(gomock.Any()).Return(multiPortComplexDockerApplications, nil)
-			resolver.EXPECT().Resolve("web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
 			marathonAdapter := &Adapter{client: client, resolver: resolver}
 
 			// Act.
@@ -418,5 +526,148 @@ var _ = Describe("MarathonAdapter", func() {
 				},
 			}))
 		})
+
+		It("Should convert service metadata and render tag templates", func() {
+			// Arrange.
+			client.EXPECT().Applications(gomock.Any()).Return(metadataApplications, nil)
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			marathonAdapter := &Adapter{client: client, resolver: resolver}
+
+			// Act.
+			services, err := marathonAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(1))
+			Ω(services[0]).Should(Equal(&types.ServiceGroup{
+				ID: "web_app_2c033893-7993-11e5-8878-56847afe9799",
+				IP: "10.10.10.20",
+				Services: []*types.Service{
+					{
+						ID:   "web_app_2c033893-7993-11e5-8878-56847afe9799:80",
+						Name: "web-app",
+						Tags: []string{"production", "version=1.2.3", "port=31045"},
+						Meta: map[string]string{
+							"owner": "web-team",
+							"tier":  "frontend",
+						},
+						EnableTagOverride: true,
+						Weights: &types.ServiceWeights{
+							Passing: 10,
+							Warning: 1,
+						},
+						Healthy:      true,
+						OriginalPort: 80,
+						ExposedPort:  31045,
+					},
+				},
+			}))
+		})
+
+		It("Should convert health checks preferring label checks over Marathon ones", func() {
+			// Arrange.
+			client.EXPECT().Applications(gomock.Any()).Return(healthCheckApplications, nil)
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			marathonAdapter := &Adapter{client: client, resolver: resolver}
+
+			// Act.
+			services, err := marathonAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(1))
+			Ω(services[0].Services).Should(HaveLen(2))
+			Ω(services[0].Services[0].HealthChecks).Should(Equal([]*types.ServiceHealthCheck{
+				{
+					ID:       "http",
+					HTTP:     "http://10.10.10.20:31045/status",
+					Interval: "5s",
+					Timeout:  "1s",
+				},
+			}))
+			Ω(services[0].Services[1].HealthChecks).Should(Equal([]*types.ServiceHealthCheck{
+				{
+					ID:       "marathon-1",
+					TCP:      "10.10.10.20:31046",
+					Interval: "15s",
+				},
+			}))
+		})
+	})
+
+	Describe("Explain()", func() {
+		It("Should fail for unknown application", func() {
+			// Arrange.
+			client.EXPECT().Applications(gomock.Any()).Return(multiPortComplexDockerApplications, nil)
+			marathonAdapter := &Adapter{client: client, resolver: resolver}
+
+			// Act.
+			_, err := marathonAdapter.Explain("/app/staging/unknown-app", "10.10.10.20", false)
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should explain service and metadata decisions for each task port", func() {
+			// Arrange.
+			client.EXPECT().Applications(gomock.Any()).Return(multiPortComplexDockerApplications, nil)
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			marathonAdapter := &Adapter{client: client, resolver: resolver}
+
+			// Act.
+			explanation, err := marathonAdapter.Explain("/app/staging/web-app", "10.10.10.20", false)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(explanation.Tasks).Should(HaveLen(1))
+			Ω(explanation.Tasks[0].IP).Should(Equal("10.10.10.20"))
+			Ω(explanation.Tasks[0].Ports).Should(HaveLen(2))
+
+			port := explanation.Tasks[0].Ports[0]
+			Ω(port.Name).Should(Equal("web-app-1"))
+			Ω(port.Local).Should(BeTrue())
+			Ω(port.Decision).Should(Equal("registered"))
+			Ω(port.Metadata).Should(Equal([]*metadata.Decision{
+				{
+					Source: "env",
+					Key:    "SERVICE_8080_NAME",
+					Value:  "web-app-2",
+					Reason: "ignored, applies to port 8080",
+				},
+				{
+					Source: "env",
+					Key:    "SERVICE_TAGS",
+					Value:  "production",
+					Field:  "tags",
+					Reason: "applies to all ports",
+				},
+				{
+					Source: "env",
+					Key:    "SERVICE_80_NAME",
+					Value:  "web-app-1",
+					Field:  "name",
+					Reason: "applies to port 80",
+				},
+			}))
+		})
+
+		It("Should not explain tasks which are not running yet and skip not local services", func() {
+			// Arrange.
+			client.EXPECT().Applications(gomock.Any()).Return(stagingApplications, nil)
+			resolver.EXPECT().Resolve(gomock.Any(), "web.eu-west-1.internal").Return("10.10.10.20", nil).AnyTimes()
+			marathonAdapter := &Adapter{client: client, resolver: resolver}
+
+			// Act.
+			explanation, err := marathonAdapter.Explain("/app/staging/web-app", "10.10.10.30", false)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(explanation.Tasks).Should(HaveLen(2))
+			Ω(explanation.Tasks[0].Decision).Should(BeEmpty())
+			Ω(explanation.Tasks[0].Ports).Should(HaveLen(1))
+			Ω(explanation.Tasks[0].Ports[0].Decision).Should(Equal("skipped, runs on 10.10.10.20 which is not registry advertise address 10.10.10.30"))
+			Ω(explanation.Tasks[1].Decision).Should(Equal("not running, task is TASK_STAGING"))
+			Ω(explanation.Tasks[1].Ports).Should(BeEmpty())
+		})
 	})
 })
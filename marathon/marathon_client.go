@@ -11,4 +11,6 @@ type Client interface {
 	Applications(url.Values) (*marathonClient.Applications, error)
 	AddEventsListener(channel marathonClient.EventsChannel, filter int) error
 	RemoveEventsListener(channel marathonClient.EventsChannel)
+	Subscribe(callbackURL string) error
+	Unsubscribe(callbackURL string) error
 }
@@ -58,3 +58,23 @@ func (_m *MockClient) RemoveEventsListener(channel go_marathon.EventsChannel) {
 func (_mr *_MockClientRecorder) RemoveEventsListener(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoveEventsListener", arg0)
 }
+
+func (_m *MockClient) Subscribe(callbackURL string) error {
+	ret := _m.ctrl.Call(_m, "Subscribe", callbackURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) Subscribe(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Subscribe", arg0)
+}
+
+func (_m *MockClient) Unsubscribe(callbackURL string) error {
+	ret := _m.ctrl.Call(_m, "Unsubscribe", callbackURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) Unsubscribe(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Unsubscribe", arg0)
+}
@@ -0,0 +1,88 @@
+package marathon
+
+import (
+	"github.com/x-cray/marathon-registrator/marathon/marathontest"
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MarathonAdapter with fake Marathon", func() {
+	var (
+		server          *marathontest.Server
+		marathonAdapter *Adapter
+	)
+
+	BeforeEach(func() {
+		server = marathontest.NewServer()
+		var err error
+		marathonAdapter, err = New(server.URL, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should connect to discovered leader", func() {
+		// Assert.
+		Ω(marathonAdapter.ActiveEndpoint()).Should(Equal(server.URL))
+	})
+
+	It("Should decode applications with embedded tasks", func() {
+		// Arrange.
+		server.Deploy(marathontest.App{
+			ID:     "/web/app",
+			Ports:  []int{80, 8080},
+			Labels: map[string]string{"SERVICE_80_NAME": "web"},
+		}, 2)
+		server.Deploy(marathontest.App{ID: "/db", Ports: []int{27017}, HealthChecked: true}, 1)
+
+		// Act.
+		groups, err := marathonAdapter.Services()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(groups).Should(HaveLen(3))
+		Ω(groups[0].ID).Should(Equal("db.00000003"))
+		Ω(groups[0].Services[0].Name).Should(Equal("db"))
+		Ω(groups[0].Services[0].Healthy).Should(BeFalse())
+		Ω(groups[0].Services[0].HealthChecks).Should(HaveLen(1))
+		Ω(groups[1].ID).Should(Equal("web_app.00000001"))
+		Ω(groups[1].IP).Should(Equal("127.0.0.1"))
+		Ω(groups[1].Services).Should(HaveLen(2))
+		Ω(groups[1].Services[0].Name).Should(Equal("web"))
+		Ω(groups[1].Services[0].ExposedPort).Should(Equal(31000))
+		Ω(groups[1].Services[1].Name).Should(Equal("app-8080"))
+		Ω(groups[1].Services[1].Healthy).Should(BeTrue())
+	})
+
+	It("Should convert streamed events skipping unsupported ones", func() {
+		// Arrange.
+		channel := make(types.EventsChannel, 10)
+		err := marathonAdapter.ListenForEvents(channel)
+		Ω(err).ShouldNot(HaveOccurred())
+		Eventually(server.Subscribers).Should(Equal(1))
+
+		// Act.
+		tasks := server.Deploy(marathontest.App{ID: "/db", Ports: []int{27017}, HealthChecked: true}, 1)
+		server.SetHealth(tasks[0].ID, true)
+		server.SetHealth(tasks[0].ID, false)
+		server.FailTask(tasks[0].ID)
+
+		// Assert.
+		var event *types.ServiceEvent
+		for _, action := range []types.ServiceAction{
+			types.ServiceStarted,
+			types.ServiceWentUp,
+			types.ServiceWentDown,
+			types.ServiceStopped,
+		} {
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal(tasks[0].ID))
+			Ω(event.Action).Should(Equal(action))
+		}
+		Consistently(channel, "100ms").ShouldNot(Receive())
+	})
+})
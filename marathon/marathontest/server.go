@@ -0,0 +1,380 @@
+// Package marathontest provides in-memory Marathon server for integration tests.
+// It serves the excerpt of Marathon API used by registrator: leader discovery, applications
+// with embedded tasks and event stream, which is fed by changes made to programmable app/task model.
+package marathontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// App is the Marathon application definition.
+type App struct {
+	ID     string
+	Ports  []int
+	Env    map[string]string
+	Labels map[string]string
+
+	// HealthChecked application has HTTP health check on its first port. Its tasks are
+	// not healthy until health check passes.
+	HealthChecked bool
+}
+
+// Task is the running instance of Marathon application.
+type Task struct {
+	ID      string
+	AppID   string
+	Host    string
+	Ports   []int
+	Healthy bool
+}
+
+type app struct {
+	definition App
+	tasks      []*Task
+}
+
+// Server is the fake Marathon instance.
+type Server struct {
+	*httptest.Server
+
+	// Host tasks are started on.
+	TaskHost string
+
+	lock        sync.Mutex
+	apps        map[string]*app
+	taskCounter int
+	nextPort    int
+	subscribers map[chan []byte]bool
+	closed      bool
+}
+
+// NewServer starts fake Marathon without applications. Tasks are started on 127.0.0.1.
+func NewServer() *Server {
+	s := &Server{
+		TaskHost:    "127.0.0.1",
+		apps:        make(map[string]*app),
+		nextPort:    31000,
+		subscribers: make(map[chan []byte]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", s.handlePing)
+	mux.HandleFunc("/v2/leader", s.handleLeader)
+	mux.HandleFunc("/v2/apps", s.handleApps)
+	mux.HandleFunc("/v2/events", s.handleEvents)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Close terminates event streams and shuts the server down.
+func (s *Server) Close() {
+	s.lock.Lock()
+	s.closed = true
+	for subscriber := range s.subscribers {
+		close(subscriber)
+		delete(s.subscribers, subscriber)
+	}
+	s.lock.Unlock()
+
+	s.Server.CloseClientConnections()
+	s.Server.Close()
+}
+
+// Deploy creates application and starts its instances.
+func (s *Server) Deploy(definition App, instances int) []*Task {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.apps[definition.ID] = &app{definition: definition}
+	tasks := s.startTasks(definition.ID, instances)
+	s.publish("deployment_success", map[string]interface{}{"id": definition.ID})
+
+	return tasks
+}
+
+// Scale starts or kills application instances to get the requested number of them.
+func (s *Server) Scale(appID string, instances int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	a := s.app(appID)
+	if len(a.tasks) < instances {
+		s.startTasks(appID, instances-len(a.tasks))
+	}
+	for len(a.tasks) > instances {
+		s.killTask(a, a.tasks[len(a.tasks)-1], "TASK_KILLED")
+	}
+	s.publish("deployment_success", map[string]interface{}{"id": appID})
+}
+
+// KillTask kills application instance.
+func (s *Server) KillTask(taskID string) {
+	s.stopTask(taskID, "TASK_KILLED")
+}
+
+// FailTask fails application instance.
+func (s *Server) FailTask(taskID string) {
+	s.stopTask(taskID, "TASK_FAILED")
+}
+
+// SetHealth changes the result of task health check.
+func (s *Server) SetHealth(taskID string, alive bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	task, _ := s.task(taskID)
+	task.Healthy = alive
+	s.publish("health_status_changed_event", map[string]interface{}{
+		"appId":  task.AppID,
+		"taskId": task.ID,
+		"alive":  alive,
+	})
+}
+
+// Tasks returns running instances of application.
+func (s *Server) Tasks(appID string) []*Task {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var result []*Task
+	for _, task := range s.app(appID).tasks {
+		taskCopy := *task
+		result = append(result, &taskCopy)
+	}
+	return result
+}
+
+// Subscribers returns the number of connected event stream listeners.
+func (s *Server) Subscribers() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.subscribers)
+}
+
+func (s *Server) app(appID string) *app {
+	a, ok := s.apps[appID]
+	if !ok {
+		panic(fmt.Sprintf("marathontest: unknown application %s", appID))
+	}
+	return a
+}
+
+func (s *Server) task(taskID string) (*Task, *app) {
+	for _, a := range s.apps {
+		for _, task := range a.tasks {
+			if task.ID == taskID {
+				return task, a
+			}
+		}
+	}
+	panic(fmt.Sprintf("marathontest: unknown task %s", taskID))
+}
+
+func (s *Server) startTasks(appID string, instances int) []*Task {
+	a := s.app(appID)
+	var started []*Task
+	for i := 0; i < instances; i++ {
+		s.taskCounter++
+		task := &Task{
+			ID:      fmt.Sprintf("%s.%08d", strings.Replace(strings.TrimPrefix(appID, "/"), "/", "_", -1), s.taskCounter),
+			AppID:   appID,
+			Host:    s.TaskHost,
+			Healthy: !a.definition.HealthChecked,
+		}
+		for range a.definition.Ports {
+			task.Ports = append(task.Ports, s.nextPort)
+			s.nextPort++
+		}
+
+		a.tasks = append(a.tasks, task)
+		started = append(started, task)
+		s.publishStatusUpdate(task, "TASK_RUNNING")
+	}
+	return started
+}
+
+func (s *Server) stopTask(taskID, status string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	task, a := s.task(taskID)
+	s.killTask(a, task, status)
+}
+
+func (s *Server) killTask(a *app, task *Task, status string) {
+	for i, t := range a.tasks {
+		if t == task {
+			a.tasks = append(a.tasks[:i], a.tasks[i+1:]...)
+			break
+		}
+	}
+	s.publishStatusUpdate(task, status)
+}
+
+func (s *Server) publishStatusUpdate(task *Task, status string) {
+	s.publish("status_update_event", map[string]interface{}{
+		"appId":      task.AppID,
+		"taskId":     task.ID,
+		"taskStatus": status,
+		"host":       task.Host,
+		"ports":      task.Ports,
+		"slaveId":    "20151026-125553-16842879-5050-1172-S0",
+		"version":    "2015-10-26T13:05:30.000Z",
+	})
+}
+
+// publish writes event to all event stream listeners. Must be called with lock held.
+func (s *Server) publish(eventType string, event map[string]interface{}) {
+	event["eventType"] = eventType
+	event["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, _ := json.Marshal(event)
+
+	message := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data))
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- message:
+		default:
+			// Listener does not keep up, event is lost as it would be with real Marathon.
+		}
+	}
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "pong")
+}
+
+func (s *Server) handleLeader(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"leader": strings.TrimPrefix(s.URL, "http://")})
+}
+
+func (s *Server) handleApps(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	embedTasks := false
+	for _, embed := range r.URL.Query()["embed"] {
+		embedTasks = embedTasks || embed == "apps.tasks"
+	}
+	id := r.URL.Query().Get("id")
+
+	ids := make([]string, 0, len(s.apps))
+	for appID := range s.apps {
+		if id == "" || strings.Contains(appID, id) {
+			ids = append(ids, appID)
+		}
+	}
+	sort.Strings(ids)
+
+	apps := make([]map[string]interface{}, 0, len(ids))
+	for _, appID := range ids {
+		apps = append(apps, s.appJSON(s.apps[appID], embedTasks))
+	}
+
+	writeJSON(w, map[string]interface{}{"apps": apps})
+}
+
+func (s *Server) appJSON(a *app, embedTasks bool) map[string]interface{} {
+	result := map[string]interface{}{
+		"id":        a.definition.ID,
+		"ports":     a.definition.Ports,
+		"env":       stringMap(a.definition.Env),
+		"labels":    stringMap(a.definition.Labels),
+		"instances": len(a.tasks),
+	}
+
+	var healthChecks []map[string]interface{}
+	if a.definition.HealthChecked {
+		healthChecks = append(healthChecks, map[string]interface{}{
+			"protocol":        "HTTP",
+			"path":            "/health",
+			"portIndex":       0,
+			"intervalSeconds": 10,
+			"timeoutSeconds":  5,
+		})
+	}
+	result["healthChecks"] = healthChecks
+
+	if embedTasks {
+		tasks := make([]map[string]interface{}, 0, len(a.tasks))
+		for _, task := range a.tasks {
+			taskJSON := map[string]interface{}{
+				"id":    task.ID,
+				"appId": task.AppID,
+				"host":  task.Host,
+				"ports": task.Ports,
+			}
+			if a.definition.HealthChecked {
+				taskJSON["healthCheckResults"] = []map[string]interface{}{
+					{"taskId": task.ID, "alive": task.Healthy},
+				}
+			}
+			tasks = append(tasks, taskJSON)
+		}
+		result["tasks"] = tasks
+	}
+
+	return result
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	subscriber := make(chan []byte, 100)
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		http.Error(w, "Server is closed", http.StatusServiceUnavailable)
+		return
+	}
+	s.subscribers[subscriber] = true
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		if s.subscribers[subscriber] {
+			delete(s.subscribers, subscriber)
+		}
+		s.lock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case message, more := <-subscriber:
+			if !more {
+				return
+			}
+			w.Write(message)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func stringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return map[string]string{}
+	}
+	return values
+}
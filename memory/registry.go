@@ -0,0 +1,171 @@
+// Package memory provides in-memory adapters, i.e. to replay recorded scheduler events
+// without touching real service registry, or to embed Bridge in simulations and tests.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Registry is the implementation of RegistryAdapter keeping registered services in memory.
+type Registry struct {
+	lock          sync.Mutex
+	advertiseAddr string
+	groups        map[string]*types.ServiceGroup
+	err           error
+}
+
+// NewRegistry creates empty Registry advertising advertiseAddr.
+func NewRegistry(advertiseAddr string) *Registry {
+	return &Registry{
+		advertiseAddr: advertiseAddr,
+		groups:        make(map[string]*types.ServiceGroup),
+	}
+}
+
+// Fail makes all registry calls but AdvertiseAddr() return err until Fail(nil) is called.
+func (r *Registry) Fail(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.err = err
+}
+
+// Ping succeeds unless registry is set to fail.
+func (r *Registry) Ping() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Register stores services of the group replacing the ones registered with the same IDs.
+func (r *Registry) Register(group *types.ServiceGroup) error {
+	return r.RegisterContext(context.Background(), group)
+}
+
+// RegisterContext registers services of the group logging correlation ID carried by ctx.
+func (r *Registry) RegisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	for _, service := range group.Services {
+		log.WithFields(log.Fields{
+			"prefix": "memory",
+			"ip":     group.IP,
+			"id":     service.ID,
+			"name":   service.Name,
+			"port":   service.ExposedPort,
+		}).WithFields(types.ContextFields(ctx)).Info("Registering service")
+
+		r.groups[service.ID] = &types.ServiceGroup{
+			ID:       group.ID,
+			IP:       group.IP,
+			Services: []*types.Service{copyService(service)},
+		}
+	}
+
+	return nil
+}
+
+// Deregister removes services of the group.
+func (r *Registry) Deregister(group *types.ServiceGroup) error {
+	return r.DeregisterContext(context.Background(), group)
+}
+
+// DeregisterContext deregisters services of the group logging correlation ID carried by ctx.
+func (r *Registry) DeregisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	for _, service := range group.Services {
+		log.WithFields(log.Fields{
+			"prefix": "memory",
+			"ip":     group.IP,
+			"id":     service.ID,
+			"name":   service.Name,
+			"port":   service.ExposedPort,
+		}).WithFields(types.ContextFields(ctx)).Info("Deregistering service")
+
+		delete(r.groups, service.ID)
+	}
+
+	return nil
+}
+
+// Services returns registered services, each in its own group as Consul does, ordered by service ID.
+func (r *Registry) Services() ([]*types.ServiceGroup, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	ids := make([]string, 0, len(r.groups))
+	for id := range r.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := make([]*types.ServiceGroup, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, copyGroup(r.groups[id]))
+	}
+
+	return result, nil
+}
+
+// AdvertiseAddr returns the address the registry was created with.
+func (r *Registry) AdvertiseAddr() (string, error) {
+	return r.advertiseAddr, nil
+}
+
+// copyGroup returns deep copy of the group, so that callers can't modify adapter state.
+func copyGroup(group *types.ServiceGroup) *types.ServiceGroup {
+	result := &types.ServiceGroup{
+		ID:       group.ID,
+		IP:       group.IP,
+		Services: make([]*types.Service, len(group.Services)),
+	}
+	for i, service := range group.Services {
+		result.Services[i] = copyService(service)
+	}
+	return result
+}
+
+func copyService(service *types.Service) *types.Service {
+	result := *service
+	if service.Tags != nil {
+		result.Tags = append([]string{}, service.Tags...)
+	}
+	if service.Meta != nil {
+		result.Meta = make(map[string]string, len(service.Meta))
+		for key, value := range service.Meta {
+			result.Meta[key] = value
+		}
+	}
+	if service.Weights != nil {
+		weights := *service.Weights
+		result.Weights = &weights
+	}
+	if service.HealthChecks != nil {
+		result.HealthChecks = make([]*types.ServiceHealthCheck, len(service.HealthChecks))
+		for i, check := range service.HealthChecks {
+			checkCopy := *check
+			result.HealthChecks[i] = &checkCopy
+		}
+	}
+	return &result
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMemory(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memory Adapters Suite")
+}
+
+var _ = Describe("Registry", func() {
+	group := &types.ServiceGroup{
+		ID: "web_app_2c033893-7993-11e5-8878-56847afe9799",
+		IP: "10.10.10.10",
+		Services: []*types.Service{
+			{ID: "web_app_2c033893-7993-11e5-8878-56847afe9799:8080", Name: "web-app-8080", ExposedPort: 31001},
+			{ID: "web_app_2c033893-7993-11e5-8878-56847afe9799:80", Name: "web-app-80", ExposedPort: 31000},
+		},
+	}
+
+	It("Should report advertise address", func() {
+		// Act.
+		addr, err := NewRegistry("10.10.10.10").AdvertiseAddr()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(addr).Should(Equal("10.10.10.10"))
+	})
+
+	It("Should return registered services in separate groups ordered by ID", func() {
+		// Arrange.
+		registry := NewRegistry("10.10.10.10")
+
+		// Act.
+		err := registry.Register(group)
+		services, _ := registry.Services()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(services).Should(HaveLen(2))
+		Ω(services[0].ID).Should(Equal(group.ID))
+		Ω(services[0].Services[0].Name).Should(Equal("web-app-80"))
+		Ω(services[1].Services[0].Name).Should(Equal("web-app-8080"))
+	})
+
+	It("Should deregister services", func() {
+		// Arrange.
+		registry := NewRegistry("10.10.10.10")
+		registry.Register(group)
+
+		// Act.
+		err := registry.Deregister(group)
+		services, _ := registry.Services()
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(services).Should(BeEmpty())
+	})
+
+	It("Should keep services intact while set to fail", func() {
+		// Arrange.
+		registry := NewRegistry("10.10.10.10")
+		registry.Fail(errors.New("registry-error"))
+
+		// Act.
+		err := registry.Register(group)
+
+		// Assert.
+		Ω(err).Should(MatchError("registry-error"))
+		Ω(registry.Ping()).Should(MatchError("registry-error"))
+		registry.Fail(nil)
+		Ω(registry.Services()).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// Scheduler is the implementation of SchedulerAdapter with programmable services and events.
+// Changes made with Start, Stop and SetHealthy are published to event listeners the way real
+// schedulers do, arbitrary events may be published with Emit.
+type Scheduler struct {
+	lock   sync.Mutex
+	groups map[string]*types.ServiceGroup
+	err    error
+
+	// Serializes publishing events and closing listeners. Kept separate from lock, since listeners
+	// may call Services() while processing event.
+	listenersLock sync.Mutex
+	listeners     []types.EventsChannel
+	closed        bool
+}
+
+// NewScheduler creates Scheduler without services.
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		groups: make(map[string]*types.ServiceGroup),
+	}
+}
+
+// Services returns copies of service groups ordered by group ID, or error set with Fail.
+func (s *Scheduler) Services() ([]*types.ServiceGroup, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	ids := make([]string, 0, len(s.groups))
+	for id := range s.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := make([]*types.ServiceGroup, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, copyGroup(s.groups[id]))
+	}
+
+	return result, nil
+}
+
+// ListenForEvents subscribes channel to scheduler events. Channel is closed by Close.
+func (s *Scheduler) ListenForEvents(channel types.EventsChannel) error {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	if s.closed {
+		return errors.New("Scheduler is closed")
+	}
+	s.listeners = append(s.listeners, channel)
+
+	return nil
+}
+
+// Close closes all event listener channels.
+func (s *Scheduler) Close() error {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		for _, listener := range s.listeners {
+			close(listener)
+		}
+	}
+
+	return nil
+}
+
+// Fail makes Services() return err until Fail(nil) is called.
+func (s *Scheduler) Fail(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+// Start adds service group, replacing the one with the same ID, and publishes ServiceStarted event.
+func (s *Scheduler) Start(group *types.ServiceGroup) {
+	s.lock.Lock()
+	s.groups[group.ID] = copyGroup(group)
+	s.lock.Unlock()
+
+	s.Emit(&types.ServiceEvent{
+		ServiceID: group.ID,
+		IP:        group.IP,
+		Action:    types.ServiceStarted,
+	})
+}
+
+// Stop removes service group and publishes ServiceStopped event.
+func (s *Scheduler) Stop(groupID string) error {
+	s.lock.Lock()
+	group, ok := s.groups[groupID]
+	delete(s.groups, groupID)
+	s.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Unknown service group %s", groupID)
+	}
+
+	s.Emit(&types.ServiceEvent{
+		ServiceID: groupID,
+		IP:        group.IP,
+		Action:    types.ServiceStopped,
+	})
+	return nil
+}
+
+// SetHealthy changes health of all services of the group and publishes ServiceWentUp or ServiceWentDown event.
+func (s *Scheduler) SetHealthy(groupID string, healthy bool) error {
+	s.lock.Lock()
+	group, ok := s.groups[groupID]
+	if ok {
+		for _, service := range group.Services {
+			service.Healthy = healthy
+		}
+	}
+	s.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Unknown service group %s", groupID)
+	}
+
+	action := types.ServiceWentDown
+	if healthy {
+		action = types.ServiceWentUp
+	}
+	s.Emit(&types.ServiceEvent{
+		ServiceID: groupID,
+		IP:        group.IP,
+		Action:    action,
+	})
+	return nil
+}
+
+// Emit publishes event to all listeners, blocking until each of them accepts it.
+func (s *Scheduler) Emit(event *types.ServiceEvent) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	if s.closed {
+		return
+	}
+	for _, listener := range s.listeners {
+		listener <- event
+	}
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"errors"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		scheduler *Scheduler
+		group     *types.ServiceGroup
+	)
+
+	BeforeEach(func() {
+		scheduler = NewScheduler()
+		group = &types.ServiceGroup{
+			ID: "web_app.1",
+			IP: "10.10.10.10",
+			Services: []*types.Service{
+				{ID: "web_app.1:80", Name: "web-app", Meta: map[string]string{"version": "1"}, ExposedPort: 31000},
+			},
+		}
+	})
+
+	It("Should return copies of started services ordered by group ID", func() {
+		// Arrange.
+		scheduler.Start(&types.ServiceGroup{ID: "web_app.2", IP: "10.10.10.10"})
+		scheduler.Start(group)
+
+		// Act.
+		services, err := scheduler.Services()
+		services[0].Services[0].Meta["version"] = "2"
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(services).Should(HaveLen(2))
+		Ω(services[0].ID).Should(Equal("web_app.1"))
+		Ω(services[1].ID).Should(Equal("web_app.2"))
+		services, _ = scheduler.Services()
+		Ω(services[0].Services[0].Meta["version"]).Should(Equal("1"))
+	})
+
+	It("Should publish events for service changes", func() {
+		// Arrange.
+		channel := make(types.EventsChannel, 3)
+		scheduler.ListenForEvents(channel)
+
+		// Act.
+		scheduler.Start(group)
+		scheduler.SetHealthy("web_app.1", true)
+		scheduler.Stop("web_app.1")
+
+		// Assert.
+		Ω((<-channel).Action).Should(Equal(types.ServiceStarted))
+		Ω((<-channel).Action).Should(Equal(types.ServiceWentUp))
+		Ω(<-channel).Should(Equal(&types.ServiceEvent{
+			ServiceID: "web_app.1",
+			IP:        "10.10.10.10",
+			Action:    types.ServiceStopped,
+		}))
+		services, _ := scheduler.Services()
+		Ω(services).Should(BeEmpty())
+	})
+
+	It("Should change health of all group services", func() {
+		// Arrange.
+		scheduler.Start(group)
+
+		// Act.
+		err := scheduler.SetHealthy("web_app.1", true)
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		services, _ := scheduler.Services()
+		Ω(services[0].Services[0].Healthy).Should(BeTrue())
+	})
+
+	It("Should fail to change unknown service group", func() {
+		// Act.
+		healthErr := scheduler.SetHealthy("web_app.1", true)
+		stopErr := scheduler.Stop("web_app.1")
+
+		// Assert.
+		Ω(healthErr).Should(MatchError("Unknown service group web_app.1"))
+		Ω(stopErr).Should(MatchError("Unknown service group web_app.1"))
+	})
+
+	It("Should publish arbitrary events", func() {
+		// Arrange.
+		channel := make(types.EventsChannel, 1)
+		scheduler.ListenForEvents(channel)
+		event := &types.ServiceEvent{Action: types.ServiceResync}
+
+		// Act.
+		scheduler.Emit(event)
+
+		// Assert.
+		Ω(channel).Should(Receive(Equal(event)))
+	})
+
+	It("Should return error it is set to fail with", func() {
+		// Arrange.
+		scheduler.Start(group)
+		scheduler.Fail(errors.New("scheduler-error"))
+
+		// Act.
+		_, err := scheduler.Services()
+
+		// Assert.
+		Ω(err).Should(MatchError("scheduler-error"))
+		scheduler.Fail(nil)
+		Ω(scheduler.Services()).Should(HaveLen(1))
+	})
+
+	It("Should close event listeners on close", func() {
+		// Arrange.
+		channel := make(types.EventsChannel)
+		scheduler.ListenForEvents(channel)
+
+		// Act.
+		scheduler.Close()
+		scheduler.Start(group)
+
+		// Assert.
+		Ω(channel).Should(BeClosed())
+		Ω(scheduler.ListenForEvents(make(types.EventsChannel))).Should(MatchError("Scheduler is closed"))
+	})
+})
@@ -0,0 +1,374 @@
+package mesos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/metadata"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	resubscribeInterval = 5 * time.Second
+)
+
+var (
+	terminalTaskStates = map[string]bool{
+		"TASK_FINISHED":         true,
+		"TASK_FAILED":           true,
+		"TASK_KILLED":           true,
+		"TASK_LOST":             true,
+		"TASK_ERROR":            true,
+		"TASK_DROPPED":          true,
+		"TASK_GONE":             true,
+		"TASK_GONE_BY_OPERATOR": true,
+		"TASK_UNREACHABLE":      true,
+		"TASK_UNKNOWN":          true,
+	}
+)
+
+// Adapter is the implementation of SchedulerAdapter for Mesos master.
+// It exposes tasks of all frameworks having discovery info with ports.
+type Adapter struct {
+	sync.Mutex
+
+	masterURL  string
+	frameworks map[string]bool
+	client     *http.Client
+
+	// Event stream is interrupted and no longer resubscribed once ctx is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Agent ID to agent address map.
+	agents map[string]string
+}
+
+// New creates a new Adapter. When frameworks are specified, only tasks of frameworks with these names are exposed.
+func New(masterURL string, frameworks []string) (*Adapter, error) {
+	log.WithField("prefix", "mesos").Infof("Connecting to Mesos master at %v", masterURL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	adapter := &Adapter{
+		masterURL: strings.TrimRight(masterURL, "/"),
+		client:    &http.Client{},
+		ctx:       ctx,
+		cancel:    cancel,
+		agents:    make(map[string]string),
+	}
+	if len(frameworks) > 0 {
+		adapter.frameworks = make(map[string]bool)
+		for _, name := range frameworks {
+			adapter.frameworks[name] = true
+		}
+	}
+
+	return adapter, nil
+}
+
+func (m *Adapter) agentAddress(agentID string) string {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.agents[agentID]
+}
+
+func (m *Adapter) setAgentAddress(agentID, address string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.agents[agentID] = address
+}
+
+// Services returns the list of running tasks exposing ports.
+func (m *Adapter) Services() ([]*types.ServiceGroup, error) {
+	response, err := m.client.Get(m.masterURL + "/master/state")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected Mesos master response: %s", response.Status)
+	}
+
+	state := &masterState{}
+	if err := json.NewDecoder(response.Body).Decode(state); err != nil {
+		return nil, err
+	}
+
+	for _, agent := range state.Slaves {
+		m.setAgentAddress(agent.ID, pidAddress(agent.PID))
+	}
+
+	var result []*types.ServiceGroup
+	for _, framework := range state.Frameworks {
+		if m.frameworks != nil && !m.frameworks[framework.Name] {
+			continue
+		}
+
+		for _, task := range framework.Tasks {
+			if task.State != "TASK_RUNNING" || task.Discovery == nil || task.Discovery.Ports == nil {
+				continue
+			}
+
+			group := m.toServiceGroup(task)
+			if group.IP == "" {
+				log.WithFields(log.Fields{
+					"prefix": "mesos",
+					"task":   task.ID,
+					"agent":  task.SlaveID,
+				}).Warn("Unable to determine task agent address")
+				continue
+			}
+
+			result = append(result, group)
+			for _, service := range group.Services {
+				log.WithFields(log.Fields{
+					"prefix": "mesos",
+					"ip":     group.IP,
+					"id":     service.ID,
+					"name":   service.Name,
+					"port":   service.ExposedPort,
+				}).Debug("Service")
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func isHealthy(task *task) bool {
+	if len(task.Statuses) == 0 {
+		return false
+	}
+
+	// Task has no health checks. Assume healthy.
+	status := task.Statuses[len(task.Statuses)-1]
+	if status.Healthy == nil {
+		return true
+	}
+
+	return *status.Healthy
+}
+
+func (m *Adapter) toServiceGroup(task *task) *types.ServiceGroup {
+	ip := m.agentAddress(task.SlaveID)
+	group := &types.ServiceGroup{
+		ID: task.ID,
+		IP: ip,
+	}
+
+	taskLabels := make(map[string]string)
+	for _, label := range task.Labels {
+		taskLabels[label.Key] = label.Value
+	}
+	discoveryLabels := labelsMap(make(map[string]string), task.Discovery.Labels)
+
+	defaultName := task.Discovery.Name
+	if defaultName == "" {
+		defaultName = task.Name
+	}
+
+	discoveryPorts := task.Discovery.Ports.Ports
+	isGroup := len(discoveryPorts) > 1
+	for _, discoveryPort := range discoveryPorts {
+		name := defaultName
+		if isGroup {
+			portName := discoveryPort.Name
+			if portName == "" {
+				portName = strconv.Itoa(discoveryPort.Number)
+			}
+			name += "-" + portName
+		}
+
+		portLabels := labelsMap(make(map[string]string), discoveryPort.Labels)
+		md, _ := metadata.Extract(
+			discoveryPort.Number,
+			metadata.Source{Name: "label", Values: taskLabels},
+			metadata.Source{Name: "discovery", Values: discoveryLabels},
+			metadata.Source{Name: "port", Values: portLabels},
+		)
+		context := &metadata.TemplateContext{
+			AppID:        defaultName,
+			TaskID:       task.ID,
+			IP:           ip,
+			OriginalPort: discoveryPort.Number,
+			ExposedPort:  discoveryPort.Number,
+			Labels:       mergeMaps(taskLabels, discoveryLabels, portLabels),
+			Env:          map[string]string{},
+		}
+
+		service := md.Service(fmt.Sprintf("%s:%d", task.ID, discoveryPort.Number), name, context)
+		service.Healthy = isHealthy(task)
+		group.Services = append(group.Services, service)
+	}
+
+	return group
+}
+
+// ListenForEvents subscribes to Mesos master operator API events and publishes them to channel.
+// Broken event stream is resubscribed automatically until the adapter is closed.
+func (m *Adapter) ListenForEvents(channel types.EventsChannel) error {
+	body, err := m.subscribe()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			err := m.readEvents(body, channel)
+			body.Close()
+			if m.ctx.Err() != nil {
+				return
+			}
+			log.WithFields(log.Fields{
+				"prefix": "mesos",
+				"err":    err,
+			}).Warnf("Event stream closed, resubscribing in %v", resubscribeInterval)
+
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case <-time.After(resubscribeInterval):
+				}
+				body, err = m.subscribe()
+				if err == nil {
+					break
+				}
+				log.WithFields(log.Fields{
+					"prefix": "mesos",
+					"err":    err,
+				}).Warnf("Unable to subscribe to event stream, retrying in %v", resubscribeInterval)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close interrupts event stream and stops resubscribing to it.
+func (m *Adapter) Close() error {
+	m.cancel()
+	return nil
+}
+
+func (m *Adapter) subscribe() (io.ReadCloser, error) {
+	request, err := http.NewRequest("POST", m.masterURL+"/api/v1", bytes.NewBufferString(`{"type":"SUBSCRIBE"}`))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := m.client.Do(request.WithContext(m.ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("Unexpected Mesos master response: %s", response.Status)
+	}
+
+	log.WithField("prefix", "mesos").Info("Subscribed to Mesos master event stream")
+
+	return response.Body, nil
+}
+
+// readEvents reads RecordIO-framed events until the stream is closed.
+func (m *Adapter) readEvents(body io.Reader, channel types.EventsChannel) error {
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		length, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			return fmt.Errorf("Invalid RecordIO record length: %v", err)
+		}
+
+		record := make([]byte, length)
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return err
+		}
+
+		event := &operatorEvent{}
+		if err := json.Unmarshal(record, event); err != nil {
+			return err
+		}
+
+		if serviceEvent := m.toServiceEvent(event); serviceEvent != nil {
+			select {
+			case channel <- serviceEvent:
+			case <-m.ctx.Done():
+				return m.ctx.Err()
+			}
+		}
+	}
+}
+
+func (m *Adapter) toServiceEvent(event *operatorEvent) *types.ServiceEvent {
+	switch event.Type {
+	case "SUBSCRIBED":
+		if event.Subscribed != nil && event.Subscribed.GetState != nil && event.Subscribed.GetState.GetAgents != nil {
+			for _, agent := range event.Subscribed.GetState.GetAgents.Agents {
+				m.addAgent(agent)
+			}
+		}
+	case "AGENT_ADDED":
+		if event.AgentAdded != nil {
+			m.addAgent(event.AgentAdded.Agent)
+		}
+	case "TASK_UPDATED":
+		if event.TaskUpdated == nil || event.TaskUpdated.Status == nil {
+			return nil
+		}
+
+		status := event.TaskUpdated.Status
+		result := &types.ServiceEvent{
+			ServiceID:     status.TaskID.Value,
+			IP:            m.agentAddress(status.AgentID.Value),
+			Action:        types.ServiceUnchanged,
+			OriginalEvent: event.TaskUpdated,
+			EventType:     event.Type,
+		}
+
+		switch {
+		case terminalTaskStates[status.State]:
+			result.Action = types.ServiceStopped
+		case status.Healthy != nil && *status.Healthy:
+			result.Action = types.ServiceWentUp
+		case status.Healthy != nil:
+			result.Action = types.ServiceWentDown
+		case status.State == "TASK_RUNNING":
+			result.Action = types.ServiceStarted
+		}
+
+		return result
+	}
+
+	return nil
+}
+
+func (m *Adapter) addAgent(agent *operatorAgent) {
+	if agent == nil || agent.AgentInfo == nil {
+		return
+	}
+
+	m.setAgentAddress(agent.AgentInfo.ID.Value, pidAddress(agent.PID))
+}
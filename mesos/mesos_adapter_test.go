@@ -0,0 +1,188 @@
+package mesos
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMesosAdapter(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mesos Adapter Suite")
+}
+
+// newFixtureServer serves recorded Mesos master responses.
+func newFixtureServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master/state", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/state.json")
+	})
+	mux.HandleFunc("/api/v1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		events, err := os.Open("testdata/events.jsonl")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer events.Close()
+
+		// Frame recorded events with RecordIO.
+		w.Header().Set("Content-Type", "application/json")
+		scanner := bufio.NewScanner(events)
+		for scanner.Scan() {
+			fmt.Fprintf(w, "%d\n%s", len(scanner.Bytes()), scanner.Bytes())
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+var _ = Describe("MesosAdapter", func() {
+	var (
+		server       *httptest.Server
+		mesosAdapter *Adapter
+	)
+
+	BeforeEach(func() {
+		server = newFixtureServer()
+	})
+
+	AfterEach(func() {
+		if mesosAdapter != nil {
+			mesosAdapter.Close()
+			mesosAdapter = nil
+		}
+		server.Close()
+	})
+
+	Describe("Services()", func() {
+		It("Should forward Mesos master errors", func() {
+			// Arrange.
+			mesosAdapter, _ := New(server.URL+"/unknown", nil)
+
+			// Act.
+			_, err := mesosAdapter.Services()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert running tasks with discovery ports to service groups", func() {
+			// Arrange.
+			mesosAdapter, _ := New(server.URL, nil)
+
+			// Act.
+			services, err := mesosAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(2))
+			Ω(services[0]).Should(Equal(&types.ServiceGroup{
+				ID: "web-app.2c033893-7993-11e5-8878-56847afe9799",
+				IP: "10.10.10.10",
+				Services: []*types.Service{
+					{
+						ID:           "web-app.2c033893-7993-11e5-8878-56847afe9799:31045",
+						Name:         "web-app-http",
+						Tags:         []string{"production"},
+						Meta:         map[string]string{"owner": "web-team"},
+						Healthy:      true,
+						OriginalPort: 31045,
+						ExposedPort:  31045,
+					},
+					{
+						ID:           "web-app.2c033893-7993-11e5-8878-56847afe9799:31046",
+						Name:         "web-app-admin",
+						Tags:         []string{"production"},
+						Meta:         map[string]string{"owner": "web-team"},
+						Healthy:      true,
+						OriginalPort: 31046,
+						ExposedPort:  31046,
+					},
+				},
+			}))
+			Ω(services[1]).Should(Equal(&types.ServiceGroup{
+				ID: "1445956200000-www-data-prod-cache-0-6a2f0a1c",
+				IP: "10.10.10.20",
+				Services: []*types.Service{
+					{
+						ID:           "1445956200000-www-data-prod-cache-0-6a2f0a1c:31048",
+						Name:         "cache",
+						Healthy:      false,
+						OriginalPort: 31048,
+						ExposedPort:  31048,
+					},
+				},
+			}))
+		})
+
+		It("Should only expose tasks of specified frameworks", func() {
+			// Arrange.
+			mesosAdapter, _ := New(server.URL, []string{"aurora"})
+
+			// Act.
+			services, err := mesosAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(1))
+			Ω(services[0].ID).Should(Equal("1445956200000-www-data-prod-cache-0-6a2f0a1c"))
+		})
+	})
+
+	Describe("ListenForEvents()", func() {
+		It("Should forward subscription errors", func() {
+			// Arrange.
+			mesosAdapter, _ = New(server.URL+"/unknown", nil)
+
+			// Act.
+			err := mesosAdapter.ListenForEvents(make(types.EventsChannel))
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert task updates to service events", func() {
+			// Arrange.
+			mesosAdapter, _ = New(server.URL, nil)
+			channel := make(types.EventsChannel, 10)
+
+			// Act.
+			err := mesosAdapter.ListenForEvents(channel)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var event *types.ServiceEvent
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("web-app.2c033893-7993-11e5-8878-56847afe9799"))
+			Ω(event.IP).Should(Equal("10.10.10.10"))
+			Ω(event.Action).Should(Equal(types.ServiceStarted))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceWentUp))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceWentDown))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("db.6a2f0a1c-7b4b-11e5-b945-56847afe9799"))
+			Ω(event.IP).Should(Equal("10.10.10.30"))
+			Ω(event.Action).Should(Equal(types.ServiceStopped))
+		})
+	})
+})
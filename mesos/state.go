@@ -0,0 +1,142 @@
+package mesos
+
+import (
+	"strings"
+)
+
+// Excerpt of Mesos master /master/state response.
+type masterState struct {
+	Frameworks []*framework `json:"frameworks"`
+	Slaves     []*agent     `json:"slaves"`
+}
+
+type framework struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Tasks []*task `json:"tasks"`
+}
+
+type agent struct {
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+	PID      string `json:"pid"`
+}
+
+type task struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	FrameworkID string         `json:"framework_id"`
+	SlaveID     string         `json:"slave_id"`
+	State       string         `json:"state"`
+	Statuses    []*taskStatus  `json:"statuses"`
+	Labels      []*label       `json:"labels"`
+	Discovery   *discoveryInfo `json:"discovery"`
+}
+
+type taskStatus struct {
+	State   string `json:"state"`
+	Healthy *bool  `json:"healthy"`
+}
+
+type label struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type labels struct {
+	Labels []*label `json:"labels"`
+}
+
+type discoveryInfo struct {
+	Name   string  `json:"name"`
+	Ports  *ports  `json:"ports"`
+	Labels *labels `json:"labels"`
+}
+
+type ports struct {
+	Ports []*port `json:"ports"`
+}
+
+type port struct {
+	Number   int     `json:"number"`
+	Name     string  `json:"name"`
+	Protocol string  `json:"protocol"`
+	Labels   *labels `json:"labels"`
+}
+
+// Excerpt of Mesos v1 operator API event.
+type operatorEvent struct {
+	Type        string            `json:"type"`
+	Subscribed  *subscribedEvent  `json:"subscribed"`
+	TaskUpdated *taskUpdatedEvent `json:"task_updated"`
+	AgentAdded  *agentAddedEvent  `json:"agent_added"`
+}
+
+type subscribedEvent struct {
+	GetState *struct {
+		GetAgents *struct {
+			Agents []*operatorAgent `json:"agents"`
+		} `json:"get_agents"`
+	} `json:"get_state"`
+}
+
+type taskUpdatedEvent struct {
+	Status *struct {
+		TaskID  value  `json:"task_id"`
+		AgentID value  `json:"agent_id"`
+		State   string `json:"state"`
+		Healthy *bool  `json:"healthy"`
+	} `json:"status"`
+	State string `json:"state"`
+}
+
+type agentAddedEvent struct {
+	Agent *operatorAgent `json:"agent"`
+}
+
+type operatorAgent struct {
+	AgentInfo *struct {
+		ID       value  `json:"id"`
+		Hostname string `json:"hostname"`
+	} `json:"agent_info"`
+	PID string `json:"pid"`
+}
+
+type value struct {
+	Value string `json:"value"`
+}
+
+// labelsMap converts Mesos labels to map.
+func labelsMap(dst map[string]string, l *labels) map[string]string {
+	if l == nil {
+		return dst
+	}
+	for _, label := range l.Labels {
+		dst[label.Key] = label.Value
+	}
+	return dst
+}
+
+func mergeMaps(maps ...map[string]string) map[string]string {
+	result := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// pidAddress extracts agent address from its PID, i.e. slave(1)@10.0.0.5:5051.
+func pidAddress(pid string) string {
+	i := strings.LastIndex(pid, "@")
+	if i < 0 {
+		return ""
+	}
+
+	address := pid[i+1:]
+	if j := strings.LastIndex(address, ":"); j >= 0 {
+		address = address[:j]
+	}
+	return address
+}
@@ -0,0 +1,264 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultCheckInterval is the interval of health checks which do not specify one.
+	DefaultCheckInterval = "10s"
+
+	keyPrefix = "SERVICE_"
+)
+
+// Source is the named set of key-value pairs to extract service metadata from, i.e. environment or labels.
+type Source struct {
+	Name   string
+	Values map[string]string
+}
+
+// Decision describes how a SERVICE_* key was interpreted for a particular port.
+type Decision struct {
+	Source string `json:"source"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// TemplateContext is the data available to service tag templates, i.e. version={{.Labels.VERSION}}.
+type TemplateContext struct {
+	AppID        string
+	TaskID       string
+	Host         string
+	IP           string
+	OriginalPort int
+	ExposedPort  int
+	Labels       map[string]string
+	Env          map[string]string
+}
+
+// Metadata holds lowercased SERVICE_* keys (without prefix) applicable to a single service port.
+type Metadata map[string]string
+
+// Extract collects service metadata for the port from sources, latter sources take precedence.
+// Within a source port-specific keys (i.e. SERVICE_80_NAME) take precedence over generic ones (i.e. SERVICE_NAME).
+func Extract(port int, sources ...Source) (Metadata, []*Decision) {
+	result := make(Metadata)
+	var decisions []*Decision
+	stringPort := strconv.Itoa(port)
+	for _, source := range sources {
+		decisions = append(decisions, extract(source, result, stringPort)...)
+	}
+
+	// Mark decisions overridden by subsequent ones.
+	applied := make(map[string]*Decision)
+	for i := len(decisions) - 1; i >= 0; i-- {
+		decision := decisions[i]
+		if decision.Field == "" {
+			continue
+		}
+		if winner, ok := applied[decision.Field]; ok {
+			decision.Reason += fmt.Sprintf(", overridden by %s %s", winner.Source, winner.Key)
+			continue
+		}
+		applied[decision.Field] = decision
+	}
+
+	return result, decisions
+}
+
+func extract(source Source, destination Metadata, port string) []*Decision {
+	var keys []string
+	for k := range source.Values {
+		if strings.HasPrefix(k, keyPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var decisions, portDecisions []*Decision
+	for _, k := range keys {
+		decision := &Decision{
+			Source: source.Name,
+			Key:    k,
+			Value:  source.Values[k],
+		}
+
+		key := strings.ToLower(strings.TrimPrefix(k, keyPrefix))
+		portKey := strings.SplitN(key, "_", 2)
+		_, err := strconv.Atoi(portKey[0])
+		if err == nil && len(portKey) > 1 {
+			if portKey[0] != port {
+				decision.Reason = fmt.Sprintf("ignored, applies to port %s", portKey[0])
+				decisions = append(decisions, decision)
+				continue
+			}
+			decision.Field = portKey[1]
+			decision.Reason = fmt.Sprintf("applies to port %s", port)
+			portDecisions = append(portDecisions, decision)
+		} else {
+			decision.Field = key
+			decision.Reason = "applies to all ports"
+			decisions = append(decisions, decision)
+		}
+	}
+
+	decisions = append(decisions, portDecisions...)
+	for _, decision := range decisions {
+		if decision.Field != "" {
+			destination[decision.Field] = decision.Value
+		}
+	}
+
+	return decisions
+}
+
+// Get returns metadata value or defaultValue if the value is missing or empty.
+func (m Metadata) Get(key, defaultValue string) string {
+	v, ok := m[key]
+	if !ok || v == "" {
+		return defaultValue
+	}
+	return v
+}
+
+// Service creates the service for the port described by template context.
+// Its health is left for scheduler adapter to determine.
+func (m Metadata) Service(id, defaultName string, context *TemplateContext) *types.Service {
+	return &types.Service{
+		ID:                id,
+		Name:              m.Get("name", defaultName),
+		Tags:              m.Tags(context),
+		Meta:              m.Meta(),
+		EnableTagOverride: m.EnableTagOverride(),
+		Weights:           m.Weights(),
+		HealthChecks:      m.HealthChecks(context.IP, context.ExposedPort),
+		OriginalPort:      context.OriginalPort,
+		ExposedPort:       context.ExposedPort,
+	}
+}
+
+// Tags returns service tags rendering tag templates with context.
+func (m Metadata) Tags(context *TemplateContext) []string {
+	var tags []string
+	if tagString := m["tags"]; tagString != "" {
+		tags = append(tags, strings.Split(tagString, ",")...)
+	}
+
+	for i, tag := range tags {
+		if !strings.Contains(tag, "{{") {
+			continue
+		}
+
+		tagTemplate, err := template.New("tag").Option("missingkey=zero").Parse(tag)
+		if err == nil {
+			var buffer bytes.Buffer
+			err = tagTemplate.Execute(&buffer, context)
+			if err == nil {
+				tags[i] = buffer.String()
+				continue
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"prefix": "metadata",
+			"app":    context.AppID,
+			"tag":    tag,
+			"err":    err,
+		}).Warn("Unable to render service tag template")
+	}
+
+	return tags
+}
+
+// Meta returns SERVICE_META_* entries.
+func (m Metadata) Meta() map[string]string {
+	var meta map[string]string
+	for k, v := range m {
+		if !strings.HasPrefix(k, "meta_") {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[strings.TrimPrefix(k, "meta_")] = v
+	}
+	return meta
+}
+
+// EnableTagOverride tells whether SERVICE_ENABLE_TAG_OVERRIDE is set.
+func (m Metadata) EnableTagOverride() bool {
+	enableTagOverride, _ := strconv.ParseBool(m["enable_tag_override"])
+	return enableTagOverride
+}
+
+// Weights returns SERVICE_WEIGHTS_* settings or nil if none of them are set.
+func (m Metadata) Weights() *types.ServiceWeights {
+	passing, passingErr := strconv.Atoi(m["weights_passing"])
+	warning, warningErr := strconv.Atoi(m["weights_warning"])
+	if passingErr != nil && warningErr != nil {
+		return nil
+	}
+
+	// Consul defaults for unspecified weights.
+	weights := &types.ServiceWeights{Passing: 1, Warning: 1}
+	if passingErr == nil {
+		weights.Passing = passing
+	}
+	if warningErr == nil {
+		weights.Warning = warning
+	}
+	return weights
+}
+
+// HealthChecks builds health checks from registrator-compatible SERVICE_CHECK_* keys.
+func (m Metadata) HealthChecks(ip string, port int) []*types.ServiceHealthCheck {
+	var checks []*types.ServiceHealthCheck
+	interval := m.Get("check_interval", DefaultCheckInterval)
+	timeout := m["check_timeout"]
+
+	if path := m["check_http"]; path != "" {
+		checks = append(checks, &types.ServiceHealthCheck{
+			ID:       "http",
+			HTTP:     fmt.Sprintf("http://%s:%d%s", ip, port, path),
+			Interval: interval,
+			Timeout:  timeout,
+		})
+	}
+	if tcp, _ := strconv.ParseBool(m["check_tcp"]); tcp {
+		checks = append(checks, &types.ServiceHealthCheck{
+			ID:       "tcp",
+			TCP:      fmt.Sprintf("%s:%d", ip, port),
+			Interval: interval,
+			Timeout:  timeout,
+		})
+	}
+	if script := m["check_script"]; script != "" {
+		script = strings.Replace(script, "$SERVICE_IP", ip, -1)
+		script = strings.Replace(script, "$SERVICE_PORT", strconv.Itoa(port), -1)
+		checks = append(checks, &types.ServiceHealthCheck{
+			ID:       "script",
+			Script:   script,
+			Interval: interval,
+			Timeout:  timeout,
+		})
+	}
+	if ttl := m["check_ttl"]; ttl != "" {
+		checks = append(checks, &types.ServiceHealthCheck{
+			ID:  "ttl",
+			TTL: ttl,
+		})
+	}
+
+	return checks
+}
@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetadata(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metadata Suite")
+}
+
+var _ = Describe("Metadata", func() {
+	Describe("Extract()", func() {
+		It("Should prefer latter sources and port-specific keys", func() {
+			// Arrange.
+			env := Source{Name: "env", Values: map[string]string{
+				"SERVICE_NAME":    "env-name",
+				"SERVICE_TAGS":    "env-tag",
+				"SERVICE_80_NAME": "env-port-name",
+			}}
+			labels := Source{Name: "label", Values: map[string]string{
+				"SERVICE_TAGS":    "label-tag",
+				"SERVICE_81_NAME": "other-port-name",
+				"VERSION":         "1.0",
+			}}
+
+			// Act.
+			md, decisions := Extract(80, env, labels)
+
+			// Assert.
+			Ω(md).Should(Equal(Metadata{
+				"name": "env-port-name",
+				"tags": "label-tag",
+			}))
+			Ω(decisions).Should(Equal([]*Decision{
+				{Source: "env", Key: "SERVICE_NAME", Value: "env-name", Field: "name", Reason: "applies to all ports, overridden by env SERVICE_80_NAME"},
+				{Source: "env", Key: "SERVICE_TAGS", Value: "env-tag", Field: "tags", Reason: "applies to all ports, overridden by label SERVICE_TAGS"},
+				{Source: "env", Key: "SERVICE_80_NAME", Value: "env-port-name", Field: "name", Reason: "applies to port 80"},
+				{Source: "label", Key: "SERVICE_81_NAME", Value: "other-port-name", Reason: "ignored, applies to port 81"},
+				{Source: "label", Key: "SERVICE_TAGS", Value: "label-tag", Field: "tags", Reason: "applies to all ports"},
+			}))
+		})
+	})
+
+	Describe("Extract() precedence", func() {
+		It("Should prefer port-specific keys over generic ones within source regardless of their order", func() {
+			// Arrange.
+			labels := Source{Name: "label", Values: map[string]string{
+				"SERVICE_80_NAME": "port-name",
+				"SERVICE_NAME":    "generic-name",
+			}}
+
+			// Act.
+			md, _ := Extract(80, labels)
+
+			// Assert.
+			Ω(md.Get("name", "app")).Should(Equal("port-name"))
+		})
+
+		It("Should let generic keys of latter sources override port-specific keys of former ones", func() {
+			// Arrange.
+			env := Source{Name: "env", Values: map[string]string{"SERVICE_80_NAME": "env-port-name"}}
+			labels := Source{Name: "label", Values: map[string]string{"SERVICE_NAME": "label-name"}}
+
+			// Act.
+			md, decisions := Extract(80, env, labels)
+
+			// Assert.
+			Ω(md.Get("name", "app")).Should(Equal("label-name"))
+			Ω(decisions[0].Reason).Should(Equal("applies to port 80, overridden by label SERVICE_NAME"))
+		})
+
+		It("Should let port-specific keys of latter sources override port-specific keys of former ones", func() {
+			// Arrange.
+			label := Source{Name: "label", Values: map[string]string{"SERVICE_80_CHECK_HTTP": "/label"}}
+			discovery := Source{Name: "discovery", Values: map[string]string{"SERVICE_80_CHECK_HTTP": "/discovery"}}
+			port := Source{Name: "port", Values: map[string]string{"SERVICE_80_CHECK_HTTP": "/port"}}
+
+			// Act.
+			md, _ := Extract(80, label, discovery, port)
+
+			// Assert.
+			Ω(md["check_http"]).Should(Equal("/port"))
+		})
+
+		It("Should keep values of former sources when latter ones specify other ports only", func() {
+			// Arrange.
+			env := Source{Name: "env", Values: map[string]string{"SERVICE_TAGS": "env-tag"}}
+			labels := Source{Name: "label", Values: map[string]string{"SERVICE_81_TAGS": "other-port-tag"}}
+
+			// Act.
+			md, _ := Extract(80, env, labels)
+
+			// Assert.
+			Ω(md).Should(Equal(Metadata{"tags": "env-tag"}))
+		})
+
+		It("Should fall back to default once latter source clears the value", func() {
+			// Arrange.
+			env := Source{Name: "env", Values: map[string]string{"SERVICE_NAME": "env-name"}}
+			labels := Source{Name: "label", Values: map[string]string{"SERVICE_NAME": ""}}
+
+			// Act.
+			md, _ := Extract(80, env, labels)
+
+			// Assert.
+			Ω(md.Get("name", "app")).Should(Equal("app"))
+		})
+	})
+
+	Describe("Service()", func() {
+		It("Should build service from metadata and template context", func() {
+			// Arrange.
+			md := Metadata{
+				"tags":            "version={{.Labels.VERSION}},{{.Env.MISSING}}x",
+				"meta_owner":      "team",
+				"weights_passing": "5",
+				"check_tcp":       "true",
+				"check_interval":  "5s",
+			}
+			context := &TemplateContext{
+				IP:           "10.10.10.10",
+				OriginalPort: 80,
+				ExposedPort:  31000,
+				Labels:       map[string]string{"VERSION": "1.0"},
+				Env:          map[string]string{},
+			}
+
+			// Act.
+			service := md.Service("task:80", "app", context)
+
+			// Assert.
+			Ω(service).Should(Equal(&types.Service{
+				ID:      "task:80",
+				Name:    "app",
+				Tags:    []string{"version=1.0", "x"},
+				Meta:    map[string]string{"owner": "team"},
+				Weights: &types.ServiceWeights{Passing: 5, Warning: 1},
+				HealthChecks: []*types.ServiceHealthCheck{
+					{ID: "tcp", TCP: "10.10.10.10:31000", Interval: "5s"},
+				},
+				OriginalPort: 80,
+				ExposedPort:  31000,
+			}))
+		})
+	})
+})
@@ -0,0 +1,117 @@
+package nomad
+
+// Excerpt of Nomad /v1/allocations response item and /v1/allocation/:id response.
+type allocation struct {
+	ID                 string              `json:"ID"`
+	Name               string              `json:"Name"`
+	NodeID             string              `json:"NodeID"`
+	JobID              string              `json:"JobID"`
+	TaskGroup          string              `json:"TaskGroup"`
+	ClientStatus       string              `json:"ClientStatus"`
+	DeploymentStatus   *deploymentStatus   `json:"DeploymentStatus"`
+	AllocatedResources *allocatedResources `json:"AllocatedResources"`
+	Job                *job                `json:"Job"`
+}
+
+type deploymentStatus struct {
+	Healthy *bool `json:"Healthy"`
+}
+
+type allocatedResources struct {
+	Shared struct {
+		Networks []*network `json:"Networks"`
+		Ports    []*port    `json:"Ports"`
+	} `json:"Shared"`
+}
+
+type network struct {
+	IP            string  `json:"IP"`
+	ReservedPorts []*port `json:"ReservedPorts"`
+	DynamicPorts  []*port `json:"DynamicPorts"`
+}
+
+type port struct {
+	Label  string `json:"Label"`
+	Value  int    `json:"Value"`
+	To     int    `json:"To"`
+	HostIP string `json:"HostIP"`
+}
+
+type job struct {
+	ID         string            `json:"ID"`
+	Meta       map[string]string `json:"Meta"`
+	TaskGroups []*taskGroup      `json:"TaskGroups"`
+}
+
+type taskGroup struct {
+	Name string            `json:"Name"`
+	Meta map[string]string `json:"Meta"`
+}
+
+// Excerpt of Nomad /v1/event/stream response item.
+type eventBatch struct {
+	Index  uint64   `json:"Index"`
+	Events []*event `json:"Events"`
+}
+
+type event struct {
+	Topic   string `json:"Topic"`
+	Type    string `json:"Type"`
+	Key     string `json:"Key"`
+	Payload struct {
+		Allocation *allocation `json:"Allocation"`
+	} `json:"Payload"`
+}
+
+// ports returns allocation ports along with the address they are exposed on.
+func (a *allocation) ports() (string, []*port) {
+	if a.AllocatedResources == nil {
+		return "", nil
+	}
+
+	shared := a.AllocatedResources.Shared
+	if len(shared.Ports) > 0 {
+		return shared.Ports[0].HostIP, shared.Ports
+	}
+
+	// Allocations of Nomad prior to 0.12 expose ports in networks only.
+	var ip string
+	var result []*port
+	for _, n := range shared.Networks {
+		if ip == "" {
+			ip = n.IP
+		}
+		result = append(result, n.ReservedPorts...)
+		result = append(result, n.DynamicPorts...)
+	}
+	return ip, result
+}
+
+// groupMeta returns meta of allocation task group.
+func (a *allocation) groupMeta() map[string]string {
+	if a.Job == nil {
+		return map[string]string{}
+	}
+	for _, group := range a.Job.TaskGroups {
+		if group.Name == a.TaskGroup && group.Meta != nil {
+			return group.Meta
+		}
+	}
+	return map[string]string{}
+}
+
+// jobMeta returns meta of allocation job.
+func (a *allocation) jobMeta() map[string]string {
+	if a.Job == nil || a.Job.Meta == nil {
+		return map[string]string{}
+	}
+	return a.Job.Meta
+}
+
+// originalPort returns port number inside of allocation network namespace.
+func (p *port) originalPort() int {
+	if p.To > 0 {
+		return p.To
+	}
+	return p.Value
+}
@@ -0,0 +1,322 @@
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/metadata"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	reconnectInterval = 5 * time.Second
+)
+
+var (
+	terminalClientStatuses = map[string]bool{
+		"complete": true,
+		"failed":   true,
+		"lost":     true,
+	}
+)
+
+// Adapter is the implementation of SchedulerAdapter for Nomad.
+// It exposes running allocations having network ports.
+type Adapter struct {
+	address string
+	token   string
+	client  *http.Client
+
+	// Event stream is interrupted and no longer reconnected once ctx is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a new Adapter. Token is Nomad ACL token, it may be empty when ACLs are disabled.
+func New(nomadURL, token string) (*Adapter, error) {
+	log.WithField("prefix", "nomad").Infof("Connecting to Nomad at %v", nomadURL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Adapter{
+		address: strings.TrimRight(nomadURL, "/"),
+		token:   token,
+		client:  &http.Client{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+func (n *Adapter) request(path string, params url.Values) (*http.Response, error) {
+	uri := n.address + path
+	if len(params) > 0 {
+		uri += "?" + params.Encode()
+	}
+
+	request, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n.token != "" {
+		request.Header.Set("X-Nomad-Token", n.token)
+	}
+
+	response, err := n.client.Do(request.WithContext(n.ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("Unexpected Nomad response: %s", response.Status)
+	}
+
+	return response, nil
+}
+
+func (n *Adapter) get(path string, params url.Values, result interface{}) error {
+	response, err := n.request(path, params)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Services returns the list of running allocations exposing ports.
+func (n *Adapter) Services() ([]*types.ServiceGroup, error) {
+	params := make(url.Values)
+	params.Add("resources", "true")
+	var allocations []*allocation
+	if err := n.get("/v1/allocations", params, &allocations); err != nil {
+		return nil, err
+	}
+
+	var result []*types.ServiceGroup
+	for _, stub := range allocations {
+		if stub.ClientStatus != "running" {
+			continue
+		}
+		if _, ports := stub.ports(); len(ports) == 0 {
+			continue
+		}
+
+		// Allocation list does not include job definition.
+		alloc := &allocation{}
+		if err := n.get("/v1/allocation/"+stub.ID, nil, alloc); err != nil {
+			return nil, err
+		}
+
+		group := toServiceGroup(alloc)
+		if group.IP == "" {
+			log.WithFields(log.Fields{
+				"prefix":     "nomad",
+				"allocation": alloc.ID,
+			}).Warn("Unable to determine allocation address")
+			continue
+		}
+
+		result = append(result, group)
+		for _, service := range group.Services {
+			log.WithFields(log.Fields{
+				"prefix": "nomad",
+				"ip":     group.IP,
+				"id":     service.ID,
+				"name":   service.Name,
+				"port":   service.ExposedPort,
+			}).Debug("Service")
+		}
+	}
+
+	return result, nil
+}
+
+func isHealthy(alloc *allocation) bool {
+	// Allocation is not a part of deployment. Assume healthy.
+	if alloc.DeploymentStatus == nil {
+		return true
+	}
+
+	return alloc.DeploymentStatus.Healthy != nil && *alloc.DeploymentStatus.Healthy
+}
+
+func toServiceGroup(alloc *allocation) *types.ServiceGroup {
+	ip, ports := alloc.ports()
+	group := &types.ServiceGroup{
+		ID: alloc.ID,
+		IP: ip,
+	}
+
+	jobMeta := alloc.jobMeta()
+	groupMeta := alloc.groupMeta()
+	defaultName := alloc.JobID + "-" + alloc.TaskGroup
+	isGroup := len(ports) > 1
+	for _, p := range ports {
+		name := defaultName
+		if isGroup {
+			name += "-" + p.Label
+		}
+
+		originalPort := p.originalPort()
+		md, _ := metadata.Extract(
+			originalPort,
+			metadata.Source{Name: "job", Values: jobMeta},
+			metadata.Source{Name: "group", Values: groupMeta},
+		)
+		context := &metadata.TemplateContext{
+			AppID:        alloc.JobID,
+			TaskID:       alloc.ID,
+			IP:           ip,
+			OriginalPort: originalPort,
+			ExposedPort:  p.Value,
+			Labels:       mergeMaps(jobMeta, groupMeta),
+			Env:          map[string]string{},
+		}
+
+		service := md.Service(fmt.Sprintf("%s:%d", alloc.ID, originalPort), name, context)
+		service.Healthy = isHealthy(alloc)
+		group.Services = append(group.Services, service)
+	}
+
+	return group
+}
+
+func mergeMaps(maps ...map[string]string) map[string]string {
+	result := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// ListenForEvents subscribes to Nomad allocation events and publishes them to channel.
+// Broken event stream is reconnected automatically starting from the last seen index
+// until the adapter is closed.
+func (n *Adapter) ListenForEvents(channel types.EventsChannel) error {
+	body, err := n.events(0)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var index uint64
+		for {
+			var err error
+			index, err = n.readEvents(body, channel, index)
+			body.Close()
+			if n.ctx.Err() != nil {
+				return
+			}
+			log.WithFields(log.Fields{
+				"prefix": "nomad",
+				"err":    err,
+			}).Warnf("Event stream closed, reconnecting in %v", reconnectInterval)
+
+			for {
+				select {
+				case <-n.ctx.Done():
+					return
+				case <-time.After(reconnectInterval):
+				}
+				body, err = n.events(index + 1)
+				if err == nil {
+					break
+				}
+				log.WithFields(log.Fields{
+					"prefix": "nomad",
+					"err":    err,
+				}).Warnf("Unable to connect to event stream, retrying in %v", reconnectInterval)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close interrupts event stream and stops reconnecting to it.
+func (n *Adapter) Close() error {
+	n.cancel()
+	return nil
+}
+
+func (n *Adapter) events(index uint64) (io.ReadCloser, error) {
+	params := make(url.Values)
+	params.Add("topic", "Allocation")
+	if index > 0 {
+		params.Add("index", fmt.Sprintf("%d", index))
+	}
+
+	response, err := n.request("/v1/event/stream", params)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("prefix", "nomad").Info("Connected to Nomad event stream")
+
+	return response.Body, nil
+}
+
+// readEvents reads event batches until the stream is closed and returns the index of the last batch read.
+func (n *Adapter) readEvents(body io.Reader, channel types.EventsChannel, index uint64) (uint64, error) {
+	decoder := json.NewDecoder(body)
+	for {
+		batch := &eventBatch{}
+		if err := decoder.Decode(batch); err != nil {
+			return index, err
+		}
+
+		// Heartbeats are empty objects.
+		if batch.Index > index {
+			index = batch.Index
+		}
+
+		for _, e := range batch.Events {
+			if serviceEvent := toServiceEvent(e); serviceEvent != nil {
+				select {
+				case channel <- serviceEvent:
+				case <-n.ctx.Done():
+					return index, n.ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+func toServiceEvent(e *event) *types.ServiceEvent {
+	alloc := e.Payload.Allocation
+	if e.Topic != "Allocation" || alloc == nil {
+		return nil
+	}
+
+	ip, _ := alloc.ports()
+	result := &types.ServiceEvent{
+		ServiceID:     alloc.ID,
+		IP:            ip,
+		Action:        types.ServiceUnchanged,
+		OriginalEvent: e,
+		EventType:     e.Type,
+	}
+
+	switch {
+	case terminalClientStatuses[alloc.ClientStatus]:
+		result.Action = types.ServiceStopped
+	case alloc.DeploymentStatus != nil && alloc.DeploymentStatus.Healthy != nil && *alloc.DeploymentStatus.Healthy:
+		result.Action = types.ServiceWentUp
+	case alloc.DeploymentStatus != nil && alloc.DeploymentStatus.Healthy != nil:
+		result.Action = types.ServiceWentDown
+	case alloc.ClientStatus == "running":
+		result.Action = types.ServiceStarted
+	}
+
+	return result
+}
@@ -0,0 +1,169 @@
+package nomad
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNomadAdapter(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Nomad Adapter Suite")
+}
+
+// newFixtureServer serves recorded Nomad responses to requests bearing token.
+func newFixtureServer(token string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/allocations", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/allocations.json")
+	})
+	mux.HandleFunc("/v1/allocation/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/allocation_"+path.Base(r.URL.Path)+".json")
+	})
+	mux.HandleFunc("/v1/event/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("topic") != "Allocation" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, r, "testdata/events.jsonl")
+	})
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Nomad-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+var _ = Describe("NomadAdapter", func() {
+	var (
+		server       *httptest.Server
+		nomadAdapter *Adapter
+	)
+
+	BeforeEach(func() {
+		server = newFixtureServer("secret")
+	})
+
+	AfterEach(func() {
+		if nomadAdapter != nil {
+			nomadAdapter.Close()
+			nomadAdapter = nil
+		}
+		server.Close()
+	})
+
+	Describe("Services()", func() {
+		It("Should forward Nomad errors", func() {
+			// Arrange.
+			nomadAdapter, _ := New(server.URL, "invalid")
+
+			// Act.
+			_, err := nomadAdapter.Services()
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert running allocations with ports to service groups", func() {
+			// Arrange.
+			nomadAdapter, _ := New(server.URL, "secret")
+
+			// Act.
+			services, err := nomadAdapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(services).Should(HaveLen(2))
+			Ω(services[0]).Should(Equal(&types.ServiceGroup{
+				ID: "5456bd7a-9fc0-c0dd-6131-cbee77f57577",
+				IP: "10.10.10.10",
+				Services: []*types.Service{
+					{
+						ID:           "5456bd7a-9fc0-c0dd-6131-cbee77f57577:8080",
+						Name:         "web",
+						Tags:         []string{"production"},
+						Meta:         map[string]string{"owner": "web-team"},
+						Healthy:      true,
+						OriginalPort: 8080,
+						ExposedPort:  23456,
+					},
+					{
+						ID:           "5456bd7a-9fc0-c0dd-6131-cbee77f57577:23457",
+						Name:         "shop",
+						Tags:         []string{"production"},
+						Meta:         map[string]string{"owner": "web-team"},
+						Healthy:      true,
+						OriginalPort: 23457,
+						ExposedPort:  23457,
+					},
+				},
+			}))
+			Ω(services[1]).Should(Equal(&types.ServiceGroup{
+				ID: "e3f4a5b6-1c2d-4e5f-8a9b-0c1d2e3f4a5b",
+				IP: "10.10.10.20",
+				Services: []*types.Service{
+					{
+						ID:           "e3f4a5b6-1c2d-4e5f-8a9b-0c1d2e3f4a5b:25000",
+						Name:         "cache-redis",
+						Healthy:      true,
+						OriginalPort: 25000,
+						ExposedPort:  25000,
+					},
+				},
+			}))
+		})
+	})
+
+	Describe("ListenForEvents()", func() {
+		It("Should forward event stream errors", func() {
+			// Arrange.
+			nomadAdapter, _ = New(server.URL, "invalid")
+
+			// Act.
+			err := nomadAdapter.ListenForEvents(make(types.EventsChannel))
+
+			// Assert.
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Should convert allocation updates to service events", func() {
+			// Arrange.
+			nomadAdapter, _ = New(server.URL, "secret")
+			channel := make(types.EventsChannel, 10)
+
+			// Act.
+			err := nomadAdapter.ListenForEvents(channel)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var event *types.ServiceEvent
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("5456bd7a-9fc0-c0dd-6131-cbee77f57577"))
+			Ω(event.IP).Should(Equal("10.10.10.10"))
+			Ω(event.Action).Should(Equal(types.ServiceStarted))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceWentUp))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.Action).Should(Equal(types.ServiceWentDown))
+
+			Eventually(channel).Should(Receive(&event))
+			Ω(event.ServiceID).Should(Equal("e3f4a5b6-1c2d-4e5f-8a9b-0c1d2e3f4a5b"))
+			Ω(event.IP).Should(Equal("10.10.10.20"))
+			Ω(event.Action).Should(Equal(types.ServiceStopped))
+		})
+	})
+})
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/x-cray/marathon-registrator/bridge"
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+const (
+	exitCodeDrift = 2
+)
+
+var planActionSymbols = map[bridge.PlanAction]string{
+	bridge.PlanRegister:   "+",
+	bridge.PlanDeregister: "-",
+	bridge.PlanUpdate:     "~",
+	bridge.PlanSkip:       " ",
+}
+
+// plan prints sync plans of all registries and returns process exit code.
+func plan(config *types.Config) int {
+	b, err := bridge.New(config)
+	assert(err)
+
+	plans, err := b.Plan()
+	assert(err)
+
+	if *planOutput == "json" {
+		printJSON(os.Stdout, plans)
+	} else {
+		for i, p := range plans {
+			if i > 0 {
+				fmt.Fprintln(os.Stdout)
+			}
+			printPlan(os.Stdout, p)
+		}
+	}
+
+	for _, p := range plans {
+		if p.HasDrift() {
+			return exitCodeDrift
+		}
+	}
+
+	return 0
+}
+
+func printPlan(w io.Writer, p *bridge.Plan) {
+	fmt.Fprintf(
+		w,
+		"Plan for %s: %d to register, %d to deregister, %d to update, %d skipped\n",
+		p.Registry,
+		len(p.Register),
+		len(p.Deregister),
+		len(p.Update),
+		len(p.Skipped),
+	)
+
+	printPlanSection(w, "Register", p.Register)
+	printPlanSection(w, "Deregister", p.Deregister)
+	printPlanSection(w, "Update", p.Update)
+	printPlanSection(w, "Skipped", p.Skipped)
+}
+
+func printPlanSection(w io.Writer, title string, entries []*bridge.PlanEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, entry := range entries {
+		fmt.Fprintf(
+			w,
+			"  %s %s (%s) at %s:%d: %s\n",
+			planActionSymbols[entry.Action],
+			entry.Name,
+			entry.ServiceID,
+			entry.IP,
+			entry.Port,
+			entry.Reason,
+		)
+		for _, change := range entry.Diff {
+			fmt.Fprintf(w, "      %s\n", change)
+		}
+	}
+}
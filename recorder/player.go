@@ -0,0 +1,175 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// Target is the sync engine records are replayed into, i.e. bridge.Bridge.
+type Target interface {
+	Sync() error
+	ProcessEvent(event *types.ServiceEvent) error
+}
+
+// Report summarizes replay.
+type Report struct {
+	Events int      `json:"events"`
+	Syncs  int      `json:"syncs"`
+	Errors []string `json:"errors"`
+}
+
+// Player replays recording. Schedulers returned by Player respond to Services() calls with recorded
+// snapshots in the order they were recorded, so that replay reproduces the recorded run exactly as
+// long as sync logic behaves the same.
+type Player struct {
+	lock     sync.Mutex
+	records  []*Record
+	consumed []bool
+	position int
+	last     map[string]*Record
+}
+
+// Load reads recording file.
+func Load(path string) (*Player, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewPlayer(records), nil
+}
+
+// NewPlayer creates Player replaying records.
+func NewPlayer(records []*Record) *Player {
+	return &Player{
+		records:  records,
+		consumed: make([]bool, len(records)),
+		last:     make(map[string]*Record),
+	}
+}
+
+// Schedulers returns names of recorded schedulers in order of appearance.
+func (p *Player) Schedulers() []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, record := range p.records {
+		if !seen[record.Scheduler] {
+			seen[record.Scheduler] = true
+			result = append(result, record.Scheduler)
+		}
+	}
+	return result
+}
+
+// Scheduler returns scheduler adapter responding with services recorded for the named scheduler.
+// Its events are not streamed but fed by Replay directly to the target.
+func (p *Player) Scheduler(name string) types.SchedulerAdapter {
+	return &replayScheduler{player: p, name: name}
+}
+
+// Replay plays records into target. Speed is the factor intervals between records are divided by,
+// zero means no delays at all. Services recorded without preceding event are the result of periodic
+// resync, so target is synced to consume them. Periodic snapshots are only kept for inspection.
+func (p *Player) Replay(target Target, speed float64) *Report {
+	report := &Report{Errors: []string{}}
+	for i, record := range p.records {
+		if i > 0 && speed > 0 {
+			time.Sleep(time.Duration(float64(record.Time.Sub(p.records[i-1].Time)) / speed))
+		}
+
+		p.lock.Lock()
+		p.position = i
+		consumed := p.consumed[i]
+		p.lock.Unlock()
+
+		var err error
+		switch {
+		case record.Periodic:
+		case !record.IsSnapshot():
+			report.Events++
+			err = target.ProcessEvent(record.Event.ServiceEvent())
+		case !consumed:
+			report.Syncs++
+			err = target.Sync()
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", record.Time.Format(time.RFC3339Nano), err))
+		}
+	}
+
+	return report
+}
+
+// nextSnapshot returns the first snapshot of the scheduler not yet consumed since the current position,
+// or the last consumed one if there are no more.
+func (p *Player) nextSnapshot(name string) *Record {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i := p.position; i < len(p.records); i++ {
+		record := p.records[i]
+		if p.consumed[i] || record.Periodic || record.Scheduler != name {
+			continue
+		}
+		if !record.IsSnapshot() {
+			if i == p.position {
+				// The event being replayed.
+				continue
+			}
+			// Services requested after the next event are not due yet.
+			break
+		}
+
+		p.consumed[i] = true
+		p.last[name] = record
+		return record
+	}
+
+	return p.last[name]
+}
+
+type replayScheduler struct {
+	player *Player
+	name   string
+}
+
+func (s *replayScheduler) Services() ([]*types.ServiceGroup, error) {
+	record := s.player.nextSnapshot(s.name)
+	if record == nil {
+		return []*types.ServiceGroup{}, nil
+	}
+	if record.Error != "" {
+		return nil, errors.New(record.Error)
+	}
+	return record.Services, nil
+}
+
+func (s *replayScheduler) ListenForEvents(channel types.EventsChannel) error {
+	return nil
+}
@@ -0,0 +1,237 @@
+// Package recorder records scheduler events and services to JSON lines file and replays them,
+// so that production issues like event bursts during large deployments could be reproduced.
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Record is a single line of the recording. It holds either scheduler event or scheduler services.
+// Services are recorded when registrator requests them, i.e. on sync or ServiceStarted event, and
+// periodically when snapshot interval is set, so that scheduler state is known between syncs.
+type Record struct {
+	Time      time.Time             `json:"time"`
+	Scheduler string                `json:"scheduler"`
+	Event     *Event                `json:"event,omitempty"`
+	Services  []*types.ServiceGroup `json:"services,omitempty"`
+	Error     string                `json:"error,omitempty"`
+
+	// Periodic snapshots were not requested by registrator, so they are not fed to it on replay.
+	Periodic bool `json:"periodic,omitempty"`
+}
+
+// IsSnapshot tells whether record holds scheduler services.
+func (r *Record) IsSnapshot() bool {
+	return r.Event == nil
+}
+
+// Event is the scheduler event along with the raw event it was converted from, i.e. Marathon status update.
+type Event struct {
+	ServiceID string              `json:"serviceId"`
+	IP        string              `json:"ip,omitempty"`
+	Action    types.ServiceAction `json:"action"`
+	Type      string              `json:"type,omitempty"`
+	ID        string              `json:"id,omitempty"`
+	Raw       json.RawMessage     `json:"raw,omitempty"`
+}
+
+func newEvent(event *types.ServiceEvent) *Event {
+	result := &Event{
+		ServiceID: event.ServiceID,
+		IP:        event.IP,
+		Action:    event.Action,
+		Type:      event.EventType,
+		ID:        event.EventID,
+	}
+
+	// Prefer event bytes as they were received, so that fields unknown to scheduler client are kept.
+	// Events decoded by scheduler client are only available re-marshalled.
+	switch {
+	case len(event.RawEvent) > 0:
+		result.Raw = event.RawEvent
+	case event.OriginalEvent != nil:
+		if raw, err := json.Marshal(event.OriginalEvent); err == nil {
+			result.Raw = raw
+		}
+	}
+	return result
+}
+
+// ServiceEvent converts recorded event back to scheduler event.
+func (e *Event) ServiceEvent() *types.ServiceEvent {
+	return &types.ServiceEvent{
+		ServiceID:     e.ServiceID,
+		IP:            e.IP,
+		Action:        e.Action,
+		OriginalEvent: string(e.Raw),
+		RawEvent:      e.Raw,
+		EventType:     e.Type,
+		EventID:       e.ID,
+	}
+}
+
+// Recorder writes records to file.
+type Recorder struct {
+	lock       sync.Mutex
+	file       *os.File
+	encoder    *json.Encoder
+	now        func() time.Time
+	closed     bool
+	schedulers []*recordingScheduler
+
+	// Periodic snapshots are stopped once done is closed by Close.
+	done chan struct{}
+}
+
+// Create creates recording file truncating the existing one.
+func Create(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("prefix", "recorder").Infof("Recording scheduler events to %s", path)
+	return &Recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Close stops periodic snapshots and closes recording file.
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+
+	r.closed = true
+	close(r.done)
+	return r.file.Close()
+}
+
+// SnapshotEvery records services of every wrapped scheduler each interval until recorder is closed.
+func (r *Recorder) SnapshotEvery(interval time.Duration) {
+	log.WithField("prefix", "recorder").Infof("Recording scheduler services every %v", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+			}
+
+			r.lock.Lock()
+			schedulers := r.schedulers
+			r.lock.Unlock()
+			for _, scheduler := range schedulers {
+				scheduler.snapshot(context.Background(), true)
+			}
+		}
+	}()
+}
+
+func (r *Recorder) write(record *Record) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+
+	record.Time = r.now().UTC()
+	if err := r.encoder.Encode(record); err != nil {
+		log.WithFields(log.Fields{
+			"prefix": "recorder",
+			"err":    err,
+		}).Error("Failed to write record")
+	}
+}
+
+// Wrap returns scheduler adapter recording events and services of the adapter under the name.
+func (r *Recorder) Wrap(name string, adapter types.SchedulerAdapter) types.SchedulerAdapter {
+	scheduler := &recordingScheduler{
+		name:     name,
+		adapter:  adapter,
+		recorder: r,
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.schedulers = append(r.schedulers, scheduler)
+	return scheduler
+}
+
+// recordingScheduler is the SchedulerAdapter decorator writing everything passed through it to recorder.
+type recordingScheduler struct {
+	name     string
+	adapter  types.SchedulerAdapter
+	recorder *Recorder
+}
+
+func (s *recordingScheduler) Services() ([]*types.ServiceGroup, error) {
+	return s.ServicesContext(context.Background())
+}
+
+// ServicesContext records services of wrapped adapter passing ctx to it if it takes context into account.
+func (s *recordingScheduler) ServicesContext(ctx context.Context) ([]*types.ServiceGroup, error) {
+	return s.snapshot(ctx, false)
+}
+
+func (s *recordingScheduler) snapshot(ctx context.Context, periodic bool) ([]*types.ServiceGroup, error) {
+	groups, err := types.ServicesContext(ctx, s.adapter)
+
+	record := &Record{Scheduler: s.name, Services: groups, Periodic: periodic}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	s.recorder.write(record)
+
+	return groups, err
+}
+
+func (s *recordingScheduler) ListenForEvents(channel types.EventsChannel) error {
+	events := make(types.EventsChannel, 5)
+	if err := s.adapter.ListenForEvents(events); err != nil {
+		return err
+	}
+
+	go func() {
+		for event := range events {
+			s.recorder.write(&Record{Scheduler: s.name, Event: newEvent(event)})
+			channel <- event
+		}
+		close(channel)
+	}()
+
+	return nil
+}
+
+// Close closes wrapped adapter if it holds any resources.
+func (s *recordingScheduler) Close() error {
+	if closer, ok := s.adapter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ActiveEndpoint reports active endpoint of wrapped adapter if it has any.
+func (s *recordingScheduler) ActiveEndpoint() string {
+	if reporter, ok := s.adapter.(types.SchedulerEndpointReporter); ok {
+		return reporter.ActiveEndpoint()
+	}
+	return ""
+}
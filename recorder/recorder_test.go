@@ -0,0 +1,290 @@
+package recorder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRecorder(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Recorder Suite")
+}
+
+// fakeTarget mimics bridge requesting scheduler services on sync and on ServiceStarted events.
+type fakeTarget struct {
+	scheduler types.SchedulerAdapter
+	seen      []string
+}
+
+func (t *fakeTarget) services() error {
+	groups, err := t.scheduler.Services()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		t.seen = append(t.seen, group.ID)
+	}
+	return nil
+}
+
+func (t *fakeTarget) Sync() error {
+	return t.services()
+}
+
+func (t *fakeTarget) ProcessEvent(event *types.ServiceEvent) error {
+	if event.Action == types.ServiceStarted {
+		return t.services()
+	}
+	return nil
+}
+
+func snapshot(at int, groupIDs ...string) *Record {
+	record := &Record{
+		Time:      time.Date(2016, 1, 1, 0, 0, at, 0, time.UTC),
+		Scheduler: "marathon",
+		Services:  []*types.ServiceGroup{},
+	}
+	for _, id := range groupIDs {
+		record.Services = append(record.Services, &types.ServiceGroup{ID: id})
+	}
+	return record
+}
+
+func event(at int, action types.ServiceAction) *Record {
+	return &Record{
+		Time:      time.Date(2016, 1, 1, 0, 0, at, 0, time.UTC),
+		Scheduler: "marathon",
+		Event:     &Event{ServiceID: "web.2", Action: action},
+	}
+}
+
+var _ = Describe("Recorder", func() {
+	var (
+		mockCtrl         *gomock.Controller
+		schedulerAdapter *types.MockSchedulerAdapter
+		dir              string
+		path             string
+		rec              *Recorder
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		schedulerAdapter = types.NewMockSchedulerAdapter(mockCtrl)
+		var err error
+		dir, err = ioutil.TempDir("", "recorder")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "events.jsonl")
+		rec, err = Create(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		rec.now = func() time.Time {
+			return time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+		os.RemoveAll(dir)
+	})
+
+	It("Should record services and raw events", func() {
+		// Arrange.
+		groups := []*types.ServiceGroup{{ID: "web.1", IP: "10.10.10.10"}}
+		schedulerAdapter.EXPECT().Services().Return(groups, nil)
+		schedulerAdapter.EXPECT().Services().Return(nil, errors.New("scheduler-error"))
+		schedulerAdapter.EXPECT().ListenForEvents(gomock.Any()).Do(func(channel types.EventsChannel) {
+			channel <- &types.ServiceEvent{
+				ServiceID:     "web.2",
+				IP:            "10.10.10.10",
+				Action:        types.ServiceStarted,
+				OriginalEvent: map[string]string{"eventType": "status_update_event"},
+			}
+			close(channel)
+		}).Return(nil)
+		scheduler := rec.Wrap("marathon", schedulerAdapter)
+		channel := make(types.EventsChannel, 1)
+
+		// Act.
+		scheduler.Services()
+		scheduler.Services()
+		err := scheduler.ListenForEvents(channel)
+		Ω(err).ShouldNot(HaveOccurred())
+		Eventually(channel).Should(Receive())
+		Eventually(channel).Should(BeClosed())
+		rec.Close()
+
+		// Assert.
+		player, err := Load(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(player.records).Should(HaveLen(3))
+		Ω(player.records[0].Scheduler).Should(Equal("marathon"))
+		Ω(player.records[0].Services).Should(Equal(groups))
+		Ω(player.records[1].Error).Should(Equal("scheduler-error"))
+		Ω(player.records[2].IsSnapshot()).Should(BeFalse())
+		Ω(player.records[2].Event.ServiceID).Should(Equal("web.2"))
+		Ω(player.records[2].Event.Action).Should(Equal(types.ServiceStarted))
+		Ω(string(player.records[2].Event.Raw)).Should(MatchJSON(`{"eventType":"status_update_event"}`))
+	})
+
+	It("Should record events exactly as they were received", func() {
+		// Arrange.
+		raw := `{"eventType":"status_update_event", "unknownField":1}`
+		schedulerAdapter.EXPECT().ListenForEvents(gomock.Any()).Do(func(channel types.EventsChannel) {
+			channel <- &types.ServiceEvent{
+				ServiceID:     "web.2",
+				Action:        types.ServiceStarted,
+				OriginalEvent: map[string]string{"eventType": "status_update_event"},
+				RawEvent:      []byte(raw),
+				EventType:     "status_update_event",
+				EventID:       "2016-01-01T00:00:00.000Z",
+			}
+			close(channel)
+		}).Return(nil)
+		scheduler := rec.Wrap("marathon", schedulerAdapter)
+		channel := make(types.EventsChannel, 1)
+
+		// Act.
+		err := scheduler.ListenForEvents(channel)
+		Ω(err).ShouldNot(HaveOccurred())
+		Eventually(channel).Should(BeClosed())
+		rec.Close()
+
+		// Assert.
+		player, err := Load(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(player.records).Should(HaveLen(1))
+		event := player.records[0].Event.ServiceEvent()
+		Ω(string(event.RawEvent)).Should(Equal(raw))
+		Ω(event.EventType).Should(Equal("status_update_event"))
+		Ω(event.EventID).Should(Equal("2016-01-01T00:00:00.000Z"))
+	})
+
+	It("Should record services periodically until closed", func() {
+		// Arrange.
+		groups := []*types.ServiceGroup{{ID: "web.1", IP: "10.10.10.10"}}
+		schedulerAdapter.EXPECT().Services().Return(groups, nil).MinTimes(2)
+		rec.Wrap("marathon", schedulerAdapter)
+
+		// Act.
+		rec.SnapshotEvery(10 * time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		rec.Close()
+
+		// Assert.
+		player, err := Load(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(len(player.records)).Should(BeNumerically(">=", 2))
+		for _, record := range player.records {
+			Ω(record.Periodic).Should(BeTrue())
+			Ω(record.Services).Should(Equal(groups))
+		}
+	})
+
+	It("Should fail to load malformed recording", func() {
+		// Arrange.
+		ioutil.WriteFile(path, []byte("{\"time\":\"2016-01-01T00:00:00Z\"}\nnot json\n"), 0644)
+
+		// Act.
+		_, err := Load(path)
+
+		// Assert.
+		Ω(err).Should(MatchError(ContainSubstring("events.jsonl:2")))
+	})
+})
+
+var _ = Describe("Player", func() {
+	It("Should feed recorded services in the order they were requested", func() {
+		// Arrange.
+		player := NewPlayer([]*Record{
+			snapshot(0, "web.1"),
+			event(1, types.ServiceStarted),
+			snapshot(1, "web.1", "web.2"),
+			event(2, types.ServiceWentUp),
+			snapshot(5, "web.2"),
+		})
+		target := &fakeTarget{scheduler: player.Scheduler("marathon")}
+
+		// Act.
+		report := player.Replay(target, 0)
+
+		// Assert.
+		Ω(report.Events).Should(Equal(2))
+		Ω(report.Syncs).Should(Equal(2))
+		Ω(report.Errors).Should(BeEmpty())
+		Ω(target.seen).Should(Equal([]string{"web.1", "web.1", "web.2", "web.2"}))
+	})
+
+	It("Should not feed periodic snapshots to target", func() {
+		// Arrange.
+		periodic := snapshot(1, "web.2")
+		periodic.Periodic = true
+		player := NewPlayer([]*Record{
+			snapshot(0, "web.1"),
+			periodic,
+			event(2, types.ServiceStarted),
+			snapshot(2, "web.1", "web.3"),
+		})
+		target := &fakeTarget{scheduler: player.Scheduler("marathon")}
+
+		// Act.
+		report := player.Replay(target, 0)
+
+		// Assert.
+		Ω(report.Events).Should(Equal(1))
+		Ω(report.Syncs).Should(Equal(1))
+		Ω(target.seen).Should(Equal([]string{"web.1", "web.1", "web.3"}))
+	})
+
+	It("Should report recorded scheduler errors", func() {
+		// Arrange.
+		failed := snapshot(1)
+		failed.Error = "scheduler-error"
+		player := NewPlayer([]*Record{snapshot(0, "web.1"), failed})
+		target := &fakeTarget{scheduler: player.Scheduler("marathon")}
+
+		// Act.
+		report := player.Replay(target, 0)
+
+		// Assert.
+		Ω(report.Syncs).Should(Equal(2))
+		Ω(report.Errors).Should(Equal([]string{"2016-01-01T00:00:01Z: scheduler-error"}))
+	})
+
+	It("Should keep recorded intervals divided by speed", func() {
+		// Arrange.
+		player := NewPlayer([]*Record{snapshot(0), snapshot(1)})
+		target := &fakeTarget{scheduler: player.Scheduler("marathon")}
+		started := time.Now()
+
+		// Act.
+		player.Replay(target, 10)
+
+		// Assert.
+		Ω(time.Since(started)).Should(BeNumerically(">=", 100*time.Millisecond))
+		Ω(time.Since(started)).Should(BeNumerically("<", time.Second))
+	})
+
+	It("Should list recorded schedulers in order of appearance", func() {
+		// Arrange.
+		docker := snapshot(1)
+		docker.Scheduler = "docker"
+		player := NewPlayer([]*Record{snapshot(0), docker, snapshot(2)})
+
+		// Act.
+		schedulers := player.Schedulers()
+
+		// Assert.
+		Ω(schedulers).Should(Equal([]string{"marathon", "docker"}))
+	})
+})
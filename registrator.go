@@ -4,10 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"log/syslog"
+	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/x-cray/marathon-registrator/bridge"
+	"github.com/x-cray/marathon-registrator/chaos"
+	"github.com/x-cray/marathon-registrator/tracing"
 	"github.com/x-cray/marathon-registrator/types"
 
 	log "github.com/Sirupsen/logrus"
@@ -21,21 +26,143 @@ const (
 )
 
 var (
-	version        string
-	app            = kingpin.New("registrator", "Automatically registers/deregisters Marathon tasks as services in Consul.")
-	consul         = app.Flag("consul", "Address and port of Consul agent").Short('c').Default("http://127.0.0.1:8500").URL()
-	marathon       = app.Flag("marathon", "URL of Marathon instance. Multiple instances may be specified in case of HA setup: http://addr1:8080,addr2:8080,addr3:8080").Short('m').Default("http://127.0.0.1:8080").String()
-	resyncInterval = app.Flag("resync-interval", "Time interval to resync Marathon services to determine dangling instances. Valid time units are \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\"").Short('i').Default("5m").Duration()
-	enableDryRun   = app.Flag("dry-run", "Do not perform actual service registration/deregistration. Just log intents").Short('d').Bool()
-	logLevel       = app.Flag("log-level", "Set the logging level - valid values are \"debug\", \"info\", \"warn\", \"error\", and \"fatal\"").Short('l').Default("info").Enum("debug", "info", "warn", "error", "fatal")
-	enableSyslog   = app.Flag("syslog", "Send the log output to syslog").Short('s').Bool()
-	forceColors    = app.Flag("force-colors", "Force colored log output").Short('r').Bool()
+	version string
+
+	// Tells whether --registry-retries is given explicitly rather than defaulted.
+	registryRetriesSet bool
+)
+
+var (
+	app                 = kingpin.New("registrator", "Automatically registers/deregisters Marathon tasks as services in Consul.")
+	consul              = app.Flag("consul", "Address and port of Consul agent used when no --registry is specified").Short('c').Default("http://127.0.0.1:8500").URL()
+	registries          = app.Flag("registry", "URL of service registry to sync services to, i.e. consul://127.0.0.1:8500 or consul+https://127.0.0.1:8501. Supported URL schemes are \"consul\", \"kubernetes\" and \"file\". May be repeated to populate several registries").Strings()
+	registryRetries     = app.Flag("registry-retries", "Number of times to retry failed sync of a single registry, unless specified with retries registry URL parameter. Not allowed in sync --once mode, see --retries").PreAction(markRegistryRetriesSet).Default("2").Int()
+	consulToken         = app.Flag("consul-token", "Consul ACL token").Envar("CONSUL_HTTP_TOKEN").String()
+	consulTokenFile     = app.Flag("consul-token-file", "File to read Consul ACL token from. The file is re-read when modified").Envar("CONSUL_HTTP_TOKEN_FILE").String()
+	consulCAFile        = app.Flag("consul-ca-file", "CA certificate file to verify Consul agent TLS certificate").Envar("CONSUL_CACERT").String()
+	consulCertFile      = app.Flag("consul-cert-file", "Client certificate file for Consul mutual TLS").Envar("CONSUL_CLIENT_CERT").String()
+	consulKeyFile       = app.Flag("consul-key-file", "Client key file for Consul mutual TLS").Envar("CONSUL_CLIENT_KEY").String()
+	consulTLSSkipVerify = app.Flag("consul-tls-skip-verify", "Do not verify Consul agent TLS certificate").Bool()
+	consulDatacenter    = app.Flag("consul-datacenter", "Consul datacenter").Envar("CONSUL_DATACENTER").String()
+	consulNamespace     = app.Flag("consul-namespace", "Consul Enterprise namespace").Envar("CONSUL_NAMESPACE").String()
+	consulPartition     = app.Flag("consul-partition", "Consul Enterprise admin partition").Envar("CONSUL_PARTITION").String()
+	marathon            = app.Flag("marathon", "URL of Marathon instance used when no --scheduler is specified. Multiple instances may be specified in case of HA setup: http://addr1:8080,addr2:8080,addr3:8080").Short('m').Default("http://127.0.0.1:8080").String()
+	marathonEvents      = app.Flag("marathon-events", "How to receive events from Marathon - valid values are \"sse\" (event stream) and \"callback\" (HTTP callback subscription)").Default("sse").Enum("sse", "callback")
+	marathonListen      = app.Flag("marathon-callback-listen", "Address to listen for Marathon HTTP callbacks on, i.e. :4000").Default(":4000").String()
+	marathonCallbackURL = app.Flag("marathon-callback-url", "URL Marathon posts events to, i.e. http://10.10.10.10:4000/marathon/events. Required when listening on all interfaces").String()
+	schedulers          = app.Flag("scheduler", "Named scheduler to get services from in NAME=URL format, i.e. roles=marathon://addr1:8080,addr2:8080. Supported URL schemes are \"marathon\", \"mesos\", \"docker\" and \"nomad\". May be repeated").Strings()
+	nomadToken          = app.Flag("nomad-token", "Nomad ACL token").Envar("NOMAD_TOKEN").String()
+	resyncInterval      = app.Flag("resync-interval", "Time interval to resync Marathon services to determine dangling instances. Valid time units are \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\"").Short('i').Default("5m").Duration()
+	enableDryRun        = app.Flag("dry-run", "Do not perform actual service registration/deregistration. Just log intents").Short('d').Bool()
+	recordEvents        = app.Flag("record-events", "Record scheduler events and services to the file in JSON lines format to replay them later. Services are recorded whenever registrator requests them from scheduler, i.e. on sync, and every --record-snapshot-interval. Raw Marathon events are kept exactly as received only with callback transport, event stream ones are re-encoded after decoding").PlaceHolder("FILE").String()
+	recordInterval      = app.Flag("record-snapshot-interval", "Time interval to record scheduler services at with --record-events in addition to the ones requested on sync. 0 disables periodic snapshots").Default("1m").Duration()
+	registryChaos       = app.Flag("chaos-registry", "Inject faults into registries, i.e. error-rate=0.1,latency=200ms,jitter=100ms,partial=1,seed=42").Hidden().String()
+	schedulerChaos      = app.Flag("chaos-scheduler", "Inject faults into schedulers, i.e. error-rate=0.1,latency=200ms,drop-rate=0.05").Hidden().String()
+	auditFile           = app.Flag("audit-file", "Append audit trail of registration changes to the file in JSON lines format").PlaceHolder("FILE").String()
+	auditMaxSize        = app.Flag("audit-max-size", "Rotate audit file once it grows over the size, i.e. 100MB. 0 disables rotation").Default("100MB").Bytes()
+	auditMaxBackups     = app.Flag("audit-max-backups", "Number of rotated audit files to keep, at least 1 unless --audit-max-size is 0").Default("5").Int()
+	auditConsulPrefix   = app.Flag("audit-consul-prefix", "Consul KV prefix to store audit trail under in addition to audit file, i.e. registrator/audit. The first Consul registry is used").String()
+	otlpEndpoint        = app.Flag("otlp-endpoint", "OTLP/HTTP endpoint to export traces to, i.e. http://127.0.0.1:4318. Traces are not collected when it is not specified").Envar("OTEL_EXPORTER_OTLP_ENDPOINT").String()
+	logLevel            = app.Flag("log-level", "Set the logging level - valid values are \"debug\", \"info\", \"warn\", \"error\", and \"fatal\"").Short('l').Default("info").Enum("debug", "info", "warn", "error", "fatal")
+	logFormat           = app.Flag("log-format", "Set the log output format - valid values are \"text\", \"json\" and \"logfmt\"").Default("text").Enum("text", "json", "logfmt")
+	enableSyslog        = app.Flag("syslog", "Send the log output to syslog").Short('s').Bool()
+	forceColors         = app.Flag("force-colors", "Force colored log output").Short('r').Bool()
+
+	runCommand  = app.Command("run", "Run registrator continuously syncing scheduler services to registry").Default()
+	planCommand = app.Command("plan", "Print actions required to sync scheduler services to registry and exit. Exit code is 2 when there are drifts")
+	planOutput  = planCommand.Flag("output", "Plan output format - valid values are \"text\" and \"json\"").Short('o').Default("text").Enum("text", "json")
+	syncCommand = app.Command("sync", "Sync scheduler services to registry")
+	syncOnce    = syncCommand.Flag("once", "Perform a single sync without listening for scheduler events, report a summary and exit. Exit code is 1 on failure").Bool()
+	syncTimeout = syncCommand.Flag("timeout", "Maximum duration of a single sync including retries").Default("5m").Duration()
+	syncRetries = syncCommand.Flag("retries", "Number of times to retry failed sync in --once mode").Default("3").Int()
+
+	servicesCommand = app.Command("services", "List services known to scheduler or registry and exit")
+	servicesSource  = servicesCommand.Flag("source", "Where to get services from - valid values are registry types (the first registry of the type, i.e. \"consul\"), registry and scheduler names").Default("marathon").String()
+	servicesOutput  = servicesCommand.Flag("output", "Output format - valid values are \"table\" and \"json\"").Short('o').Default("table").Enum("table", "json")
+	explainCommand  = app.Command("explain", "Explain how Marathon application tasks are converted to services and exit")
+	explainApp      = explainCommand.Arg("app", "Marathon application ID, i.e. /my/app").Required().String()
+	explainOutput   = explainCommand.Flag("output", "Output format - valid values are \"text\" and \"json\"").Short('o').Default("text").Enum("text", "json")
+	statusCommand   = app.Command("status", "Print the state of schedulers, i.e. active Marathon leader, and exit")
+	statusOutput    = statusCommand.Flag("output", "Output format - valid values are \"table\" and \"json\"").Short('o').Default("table").Enum("table", "json")
+	replayCommand   = app.Command("replay", "Replay recorded scheduler events into in-memory registry, report its final state and exit. Exit code is 1 when errors occurred")
+	replayFile      = replayCommand.Arg("file", "File recorded with --record-events").Required().ExistingFile()
+	replaySpeed     = replayCommand.Flag("speed", "Replay speed factor, i.e. 10 replays 10 times faster than recorded. 0 replays without delays").Default("1").Float64()
+	replayAddr      = replayCommand.Flag("advertise-addr", "Registry advertise address of the node events were recorded on").Required().String()
+	replayOutput    = replayCommand.Flag("output", "Output format - valid values are \"table\" and \"json\"").Short('o').Default("table").Enum("table", "json")
+	auditCommand    = app.Command("audit", "Print audit trail of registration changes and exit")
+	auditSourceName = auditCommand.Flag("source", "Where to read audit trail from - valid values are \"file\" (--audit-file) and \"consul\" (--audit-consul-prefix)").Default("file").Enum("file", "consul")
+	auditService    = auditCommand.Flag("service", "Only show changes of services or groups with IDs containing the text").String()
+	auditRegistry   = auditCommand.Flag("registry", "Only show changes of the registry, i.e. consul://127.0.0.1:8500").String()
+	auditAction     = auditCommand.Flag("action", "Only show changes of the kind - valid values are \"register\", \"deregister\" and \"update\"").Enum("register", "deregister", "update")
+	auditOutcome    = auditCommand.Flag("outcome", "Only show changes with the outcome - valid values are \"success\", \"failure\" and \"dry-run\"").Enum("success", "failure", "dry-run")
+	auditSince      = auditCommand.Flag("since", "Only show changes made within the duration, i.e. 24h").Duration()
+	auditOutput     = auditCommand.Flag("output", "Output format - valid values are \"table\" and \"json\"").Short('o').Default("table").Enum("table", "json")
 )
 
 func validateParams(app *kingpin.Application) error {
 	if *resyncInterval <= 0 {
 		return errors.New("--resync-interval must be greater than 0")
 	}
+	if *syncTimeout <= 0 {
+		return errors.New("--timeout must be greater than 0")
+	}
+	if *replaySpeed < 0 {
+		return errors.New("--speed must not be negative")
+	}
+	if *syncRetries < 0 {
+		return errors.New("--retries must not be negative")
+	}
+	if *registryRetries < 0 {
+		return errors.New("--registry-retries must not be negative")
+	}
+	if *recordInterval < 0 {
+		return errors.New("--record-snapshot-interval must not be negative")
+	}
+	if *auditMaxSize < 0 {
+		return errors.New("--audit-max-size must not be negative")
+	}
+	if *auditMaxBackups < 0 {
+		return errors.New("--audit-max-backups must not be negative")
+	}
+	if *auditMaxSize > 0 && *auditMaxBackups < 1 {
+		return errors.New("--audit-max-backups must be at least 1 when --audit-max-size enables rotation")
+	}
+	if *syncOnce && registryRetriesSet {
+		return errors.New("--registry-retries is not applied in sync --once mode, use --retries instead")
+	}
+	for _, spec := range *registries {
+		registryConfig, err := bridge.ParseRegistryConfig(spec)
+		if err != nil {
+			return err
+		}
+		if *syncOnce && registryConfig.Retries != nil {
+			return fmt.Errorf("Registry %q retries parameter is not applied in sync --once mode, use --retries instead", spec)
+		}
+	}
+	for _, spec := range []string{*registryChaos, *schedulerChaos} {
+		if _, err := chaos.ParseOptions(spec); err != nil {
+			return err
+		}
+	}
+	if (*consulCertFile == "") != (*consulKeyFile == "") {
+		return errors.New("--consul-cert-file and --consul-key-file must be specified together")
+	}
+	names := make(map[string]bool)
+	for _, spec := range *schedulers {
+		schedulerConfig, err := bridge.ParseSchedulerConfig(spec)
+		if err != nil {
+			return err
+		}
+		if names[schedulerConfig.Name] {
+			return fmt.Errorf("Scheduler %s is specified more than once", schedulerConfig.Name)
+		}
+		names[schedulerConfig.Name] = true
+	}
+	return nil
+}
+
+func markRegistryRetriesSet(*kingpin.ParseContext) error {
+	registryRetriesSet = true
 	return nil
 }
 
@@ -61,13 +188,59 @@ func trySync(b *bridge.Bridge) bool {
 }
 
 func main() {
-	config, err := getConfig()
+	command, config, err := getConfig()
 	assert(err)
+	assert(tracing.Setup(*otlpEndpoint, version))
 
+	switch command {
+	case planCommand.FullCommand():
+		exit(plan(config))
+	case syncCommand.FullCommand():
+		if *syncOnce {
+			exit(syncOnceWithTimeout(config))
+		}
+		run(config)
+	case servicesCommand.FullCommand():
+		listServices(config)
+	case explainCommand.FullCommand():
+		explain(config)
+	case statusCommand.FullCommand():
+		printStatus(config)
+	case replayCommand.FullCommand():
+		exit(replay(config))
+	case auditCommand.FullCommand():
+		printAudit(config)
+	case runCommand.FullCommand():
+		run(config)
+	}
+
+	tracing.Shutdown()
+}
+
+// exit exports pending spans and exits with code.
+func exit(code int) {
+	tracing.Shutdown()
+	os.Exit(code)
+}
+
+func run(config *types.Config) {
 	log.Infof("Starting Marathon service registrator v%s", version)
 	b, err := bridge.New(config)
 	assert(err)
 
+	log.Info("Checking service registry availability")
+	assert(b.Ping())
+
+	// Release scheduler resources, i.e. Marathon callback subscription, on shutdown.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("Received %v, shutting down", sig)
+		b.Close()
+		exit(0)
+	}()
+
 	log.Info("Performing initial sync")
 	for {
 		if trySync(b) {
@@ -107,38 +280,117 @@ func main() {
 	close(quit)
 }
 
-func getConfig() (*types.Config, error) {
+func getConfig() (string, *types.Config, error) {
 	app.Validate(validateParams)
 	kingpin.HelpFlag.Short('h')
 	app.Flag("version", "Print application version and exit").PreAction(printVersion).Short('v').Bool()
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 
 	c := &types.Config{
-		Consul:         *consul,
-		Marathon:       *marathon,
-		ResyncInterval: *resyncInterval,
-		DryRun:         *enableDryRun,
+		ConsulOptions: &types.ConsulOptions{
+			Token:         *consulToken,
+			TokenFile:     *consulTokenFile,
+			CAFile:        *consulCAFile,
+			CertFile:      *consulCertFile,
+			KeyFile:       *consulKeyFile,
+			TLSSkipVerify: *consulTLSSkipVerify,
+			Datacenter:    *consulDatacenter,
+			Namespace:     *consulNamespace,
+			Partition:     *consulPartition,
+		},
+		NomadToken:             *nomadToken,
+		RegistryRetries:        *registryRetries,
+		ResyncInterval:         *resyncInterval,
+		DryRun:                 *enableDryRun,
+		RecordEvents:           *recordEvents,
+		RecordSnapshotInterval: *recordInterval,
+	}
+
+	if *auditFile != "" || *auditConsulPrefix != "" {
+		c.Audit = &types.AuditOptions{
+			File:         *auditFile,
+			MaxSize:      int64(*auditMaxSize),
+			MaxBackups:   *auditMaxBackups,
+			ConsulPrefix: *auditConsulPrefix,
+		}
+	}
+
+	var err error
+	if *registryChaos != "" {
+		if c.RegistryChaos, err = chaos.ParseOptions(*registryChaos); err != nil {
+			return "", nil, err
+		}
+	}
+	if *schedulerChaos != "" {
+		if c.SchedulerChaos, err = chaos.ParseOptions(*schedulerChaos); err != nil {
+			return "", nil, err
+		}
+	}
+
+	for _, spec := range *registries {
+		registryConfig, err := bridge.ParseRegistryConfig(spec)
+		if err != nil {
+			return "", nil, err
+		}
+		c.Registries = append(c.Registries, registryConfig)
+	}
+	if len(c.Registries) == 0 {
+		c.Registries = append(c.Registries, &types.RegistryConfig{
+			Name: "consul://" + (*consul).Host,
+			Type: "consul",
+			URL:  *consul,
+		})
+	}
+
+	for _, spec := range *schedulers {
+		schedulerConfig, err := bridge.ParseSchedulerConfig(spec)
+		if err != nil {
+			return "", nil, err
+		}
+		c.Schedulers = append(c.Schedulers, schedulerConfig)
+	}
+	if len(c.Schedulers) == 0 {
+		c.Schedulers = append(c.Schedulers, &types.SchedulerConfig{
+			Name: "marathon",
+			Type: "marathon",
+			URL:  *marathon,
+			Params: url.Values{
+				"events":          {*marathonEvents},
+				"callback_listen": {*marathonListen},
+				"callback_url":    {*marathonCallbackURL},
+			},
+		})
 	}
 
 	// Setup the logging.
 	level, err := log.ParseLevel(*logLevel)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	log.SetFormatter(&prefixed.TextFormatter{
-		ForceColors: *forceColors,
-	})
+	switch *logFormat {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	case "logfmt":
+		log.SetFormatter(&log.TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		})
+	default:
+		log.SetFormatter(&prefixed.TextFormatter{
+			ForceColors: *forceColors,
+		})
+	}
 	log.SetLevel(level)
 
 	if *enableSyslog {
 		hook, err := logrusSyslog.NewSyslogHook("", "", syslog.LOG_DEBUG, app.Name)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 
 		log.AddHook(hook)
 	}
 
-	return c, nil
+	return command, c, nil
 }
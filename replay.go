@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/x-cray/marathon-registrator/bridge"
+	"github.com/x-cray/marathon-registrator/memory"
+	"github.com/x-cray/marathon-registrator/recorder"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// replayResult is the report of replay along with the final registry state.
+type replayResult struct {
+	*recorder.Report
+	Services []*types.ServiceGroup `json:"services"`
+}
+
+// replay plays recorded scheduler events into bridge backed by in-memory registry and returns process exit code.
+func replay(config *types.Config) int {
+	player, err := recorder.Load(*replayFile)
+	assert(err)
+
+	var schedulers []*bridge.Scheduler
+	for _, name := range player.Schedulers() {
+		schedulers = append(schedulers, &bridge.Scheduler{
+			Name:    name,
+			Adapter: player.Scheduler(name),
+		})
+	}
+	registry := memory.NewRegistry(*replayAddr)
+	b := bridge.NewFromAdapters(config, schedulers, []*bridge.Registry{
+		{Name: "memory", Adapter: registry},
+	})
+
+	log.Infof("Replaying %s at %vx speed", *replayFile, *replaySpeed)
+	result := &replayResult{Report: player.Replay(b, *replaySpeed)}
+	result.Services, err = registry.Services()
+	assert(err)
+
+	if *replayOutput == "json" {
+		printJSON(os.Stdout, result)
+	} else {
+		printReplayResult(os.Stdout, result)
+	}
+
+	if len(result.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printReplayResult(w io.Writer, result *replayResult) {
+	fmt.Fprintf(w, "Replayed %d events, %d resyncs, %d errors\n", result.Events, result.Syncs, len(result.Errors))
+	for _, err := range result.Errors {
+		fmt.Fprintf(w, "  %s\n", err)
+	}
+
+	fmt.Fprintf(w, "\nRegistry has %d services:\n", len(result.Services))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tNAME\tIP\tPORT\tTAGS")
+	for _, group := range result.Services {
+		for _, service := range group.Services {
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%d\t%s\n",
+				service.ID,
+				service.Name,
+				group.IP,
+				service.ExposedPort,
+				strings.Join(service.Tags, ","),
+			)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/bridge"
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// syncOnceWithTimeout performs a single sync and returns process exit code.
+func syncOnceWithTimeout(config *types.Config) int {
+	result := make(chan int, 1)
+	go func() {
+		result <- syncOnceWithRetries(config, *syncRetries)
+	}()
+
+	select {
+	case code := <-result:
+		return code
+	case <-time.After(*syncTimeout):
+		log.Errorf("Sync did not complete in %v", *syncTimeout)
+		return 1
+	}
+}
+
+// syncOnceWithRetries retries the whole sync instead of retrying each registry separately,
+// so that --retries and --registry-retries attempts do not multiply. Explicit registry retries
+// are rejected by validateParams, so only their defaults are overridden here.
+func syncOnceWithRetries(config *types.Config, retries int) int {
+	config.RegistryRetries = 0
+	for _, registryConfig := range config.Registries {
+		registryConfig.Retries = nil
+	}
+	b, err := bridge.New(config)
+	assert(err)
+
+	log.Info("Checking service registry availability")
+	assert(b.Ping())
+
+	for attempt := 0; ; attempt++ {
+		log.Info("Performing sync")
+		summary, err := b.SyncWithSummary()
+		if summary != nil {
+			fmt.Fprintf(os.Stdout, "Sync summary: %s\n", summary)
+		}
+		if err == nil {
+			return 0
+		}
+
+		log.Errorf("Failed to sync services: %v", err)
+		if attempt >= retries {
+			return 1
+		}
+
+		log.Infof("Retrying sync in %v (%d of %d)", reconnectInterval, attempt+1, retries)
+		time.Sleep(reconnectInterval)
+	}
+}
@@ -0,0 +1,103 @@
+// Package tracing sets up OpenTelemetry tracing of scheduler event handling, sync passes and calls
+// to schedulers and registries, so that the slow part of registration can be told apart.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/x-cray/marathon-registrator"
+
+	// Maximum time to wait for pending spans to be exported on shutdown.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Provider set up by Setup, nil when tracing is disabled.
+var provider *sdktrace.TracerProvider
+
+// Setup exports spans over OTLP/HTTP to endpoint, i.e. http://collector:4318. Spans are exported
+// over TLS unless endpoint scheme is http. Tracing is disabled when endpoint is empty.
+func Setup(endpoint, version string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(uri.Host)}
+	if uri.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if uri.Path != "" && uri.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(uri.Path))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return err
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "registrator"),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.WithField("prefix", "tracing").Infof("Exporting traces to %s", endpoint)
+	return nil
+}
+
+// Shutdown exports pending spans. It does nothing when tracing is disabled.
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"prefix": "tracing",
+			"err":    err,
+		}).Warn("Failed to export pending spans")
+	}
+}
+
+// Start starts span of the named operation as a child of the span carried by ctx, if any.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End marks span failed if err is not nil and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport returns HTTP transport making requests with base and recording client span of each of them.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tracing Suite")
+}
+
+var _ = Describe("Tracing", func() {
+	var exporter *tracetest.InMemoryExporter
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	It("Should record nested spans with their errors", func() {
+		// Arrange.
+		ctx, parent := Start(context.Background(), "parent", attribute.String("registry", "consul"))
+
+		// Act.
+		_, child := Start(ctx, "child")
+		End(child, errors.New("registry-error"))
+		End(parent, nil)
+
+		// Assert.
+		spans := exporter.GetSpans()
+		Ω(spans).Should(HaveLen(2))
+		Ω(spans[0].Name).Should(Equal("child"))
+		Ω(spans[0].Parent.SpanID()).Should(Equal(spans[1].SpanContext.SpanID()))
+		Ω(spans[0].Status.Code).Should(Equal(codes.Error))
+		Ω(spans[0].Status.Description).Should(Equal("registry-error"))
+		Ω(spans[1].Name).Should(Equal("parent"))
+		Ω(spans[1].Attributes).Should(ContainElement(attribute.String("registry", "consul")))
+		Ω(spans[1].Status.Code).Should(Equal(codes.Unset))
+	})
+
+	It("Should record client span of each HTTP request", func() {
+		// Arrange.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		client := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+		// Act.
+		response, err := client.Get(server.URL + "/v1/agent/self")
+		Ω(err).ShouldNot(HaveOccurred())
+		response.Body.Close()
+
+		// Assert.
+		spans := exporter.GetSpans()
+		Ω(spans).Should(HaveLen(1))
+		Ω(spans[0].SpanKind).Should(Equal(trace.SpanKindClient))
+		Ω(spans[0].Status.Code).Should(Equal(codes.Error))
+	})
+
+	It("Should not export spans without endpoint", func() {
+		// Act.
+		err := Setup("", "1.0.0")
+
+		// Assert.
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(provider).Should(BeNil())
+	})
+
+	It("Should fail to set up malformed endpoint", func() {
+		// Act.
+		err := Setup("http://[::1", "1.0.0")
+
+		// Assert.
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// CorrelationIDField is the log field holding correlation ID of the operation.
+const CorrelationIDField = "correlation_id"
+
+type correlationIDKey struct{}
+
+// NewCorrelationID generates random ID to correlate log lines of a single operation, i.e. sync pass
+// or scheduler event processing.
+func NewCorrelationID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithCorrelationID returns copy of ctx carrying correlation ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns correlation ID carried by ctx or empty string if there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// ContextFields returns log fields describing ctx, i.e. its correlation ID.
+func ContextFields(ctx context.Context) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if id := CorrelationID(ctx); id != "" {
+		fields[CorrelationIDField] = id
+	}
+	return fields
+}
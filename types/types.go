@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -19,40 +20,135 @@ type RegistryAdapter interface {
 	AdvertiseAddr() (string, error)
 }
 
+// ContextRegistryAdapter is implemented by registry adapters which take context of the operation
+// into account, i.e. log its correlation ID along with registration changes.
+type ContextRegistryAdapter interface {
+	RegisterContext(ctx context.Context, group *ServiceGroup) error
+	DeregisterContext(ctx context.Context, group *ServiceGroup) error
+}
+
+// ServicesLister is the part of scheduler and registry adapters listing services.
+type ServicesLister interface {
+	Services() ([]*ServiceGroup, error)
+}
+
+// ContextServicesLister is implemented by scheduler and registry adapters which pass context of the
+// operation to the requests listing services, so that the requests are traced as part of it.
+type ContextServicesLister interface {
+	ServicesContext(ctx context.Context) ([]*ServiceGroup, error)
+}
+
+// ServicesContext lists services of adapter passing ctx to it if it takes context into account.
+func ServicesContext(ctx context.Context, adapter ServicesLister) ([]*ServiceGroup, error) {
+	if lister, ok := adapter.(ContextServicesLister); ok {
+		return lister.ServicesContext(ctx)
+	}
+	return adapter.Services()
+}
+
+// ContextPinger is implemented by registry adapters which pass context of the check to their requests.
+type ContextPinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingContext checks registry adapter passing ctx to it if it takes context into account.
+func PingContext(ctx context.Context, adapter RegistryAdapter) error {
+	if pinger, ok := adapter.(ContextPinger); ok {
+		return pinger.PingContext(ctx)
+	}
+	return adapter.Ping()
+}
+
+// RegistryChecksCleaner is implemented by registry adapters which register health checks separately
+// from services and therefore may end up with checks orphaned from their services.
+type RegistryChecksCleaner interface {
+	CleanupDanglingChecks(ctx context.Context) error
+}
+
+// RegistryReadinessTracker is implemented by registry adapters which have no health checks of their own,
+// i.e. Kubernetes. Unhealthy services are registered to them as not ready instead of being skipped.
+type RegistryReadinessTracker interface {
+	TracksReadiness() bool
+}
+
+// TracksReadiness tells whether adapter registers unhealthy services as not ready.
+func TracksReadiness(adapter RegistryAdapter) bool {
+	tracker, ok := adapter.(RegistryReadinessTracker)
+	return ok && tracker.TracksReadiness()
+}
+
+// SchedulerEndpointReporter is implemented by scheduler adapters which talk to one of several scheduler
+// instances, i.e. the current leader of HA setup.
+type SchedulerEndpointReporter interface {
+	ActiveEndpoint() string
+}
+
+// SourceMetaKey is the service metadata key holding the name of the scheduler the service is registered from.
+const SourceMetaKey = "registrator_source"
+
 // ServiceGroup represents the collection of services which expose multiple ports.
 // Most of the time it will hold the single Service instance, but if the service exposes multiple ports, it will contain
 // multiple services named by appending exposed port number to them, i.e. foo-service-3000, foo-service-4001, etc.
 type ServiceGroup struct {
-	ID           string
-	IP           string
-	Services     []*Service
-	HealthChecks []*ServiceHealthCheck
+	ID       string
+	IP       string
+	Services []*Service
 }
 
 // Service represents a single entry in the service registry.
 type Service struct {
-	ID           string
-	Name         string
-	Tags         []string
-	Healthy      bool
-	OriginalPort int
-	ExposedPort  int
+	ID                string
+	Name              string
+	Tags              []string
+	Meta              map[string]string
+	EnableTagOverride bool
+	Weights           *ServiceWeights
+	HealthChecks      []*ServiceHealthCheck
+	Healthy           bool
+	OriginalPort      int
+	ExposedPort       int
 }
 
-// ServiceHealthCheck represents health check definition.
+// ServiceWeights defines service instance weights used by registry in DNS SRV responses depending on health status.
+type ServiceWeights struct {
+	Passing int
+	Warning int
+}
+
+// ServiceHealthCheck represents health check definition to be performed by service registry.
+// Only one of HTTP, TCP, Script or TTL is expected to be set. Durations are in Go duration format, i.e. "10s".
 type ServiceHealthCheck struct {
-	ID           string
-	Name         string
-	Tags         []string
-	Healthy      bool
-	OriginalPort int
-	ExposedPort  int
+	ID       string
+	HTTP     string
+	TCP      string
+	Script   string
+	TTL      string
+	Interval string
+	Timeout  string
 }
 
 func (group *ServiceGroup) ServiceKey(service *Service) string {
 	return fmt.Sprintf("%s:%s:%d", service.Name, group.IP, service.ExposedPort)
 }
 
+// SkipReason tells why the group service is not to be registered in registry with advertiseAddr
+// address, or returns empty string when it is to be registered. Unhealthy services are only registered
+// to registries tracking readiness.
+func (group *ServiceGroup) SkipReason(service *Service, advertiseAddr string, tracksReadiness bool) string {
+	if group.IP != advertiseAddr {
+		return fmt.Sprintf("runs on %s which is not registry advertise address %s", group.IP, advertiseAddr)
+	}
+	if !service.Healthy && !tracksReadiness {
+		return "service is not healthy"
+	}
+	return ""
+}
+
+// Source returns the name of the scheduler the service is registered from or empty string if it is unknown.
+func (service *Service) Source() string {
+	return service.Meta[SourceMetaKey]
+}
+
 type ServiceAction int
 
 const (
@@ -70,6 +166,9 @@ const (
 
 	// ServiceStopped denotes removed service instance
 	ServiceStopped
+
+	// ServiceResync denotes that scheduler events might have been missed and full sync is required
+	ServiceResync
 )
 
 var serviceActionDescriptions = map[int]string{
@@ -78,18 +177,47 @@ var serviceActionDescriptions = map[int]string{
 	int(ServiceWentDown):  "went down",
 	int(ServiceStarted):   "started",
 	int(ServiceStopped):   "stopped",
+	int(ServiceResync):    "resync",
 }
 
 func (action ServiceAction) String() string {
 	return serviceActionDescriptions[int(action)]
 }
 
+// MarshalText encodes action with its description, i.e. "went up".
+func (action ServiceAction) MarshalText() ([]byte, error) {
+	description, ok := serviceActionDescriptions[int(action)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown service action %d", int(action))
+	}
+	return []byte(description), nil
+}
+
+// UnmarshalText decodes action from its description.
+func (action *ServiceAction) UnmarshalText(text []byte) error {
+	for value, description := range serviceActionDescriptions {
+		if description == string(text) {
+			*action = ServiceAction(value)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown service action %q", text)
+}
+
 // ServiceEvent is the definition for an event occurred to Service in scheduler.
 type ServiceEvent struct {
 	ServiceID     string
 	IP            string
 	Action        ServiceAction
 	OriginalEvent interface{}
+
+	// Scheduler event exactly as it was received, if scheduler adapter has access to it.
+	RawEvent []byte
+
+	// Scheduler event type and ID, if scheduler provides them, to tell which event caused
+	// registration change.
+	EventType string
+	EventID   string
 }
 
 func (event *ServiceEvent) String() string {
@@ -100,8 +228,83 @@ func (event *ServiceEvent) String() string {
 type EventsChannel chan *ServiceEvent
 
 type Config struct {
-	Marathon       string
-	Consul         *url.URL
-	DryRun         bool
-	ResyncInterval time.Duration
+	Schedulers      []*SchedulerConfig
+	NomadToken      string
+	Registries      []*RegistryConfig
+	RegistryRetries int
+	ConsulOptions   *ConsulOptions
+	DryRun          bool
+	ResyncInterval  time.Duration
+
+	// File to record scheduler events and services to.
+	RecordEvents string
+
+	// Interval to record scheduler services at in addition to the ones requested by sync, 0 means never.
+	RecordSnapshotInterval time.Duration
+
+	// Faults injected into registries and schedulers, nil means none.
+	RegistryChaos  *ChaosOptions
+	SchedulerChaos *ChaosOptions
+
+	// Audit trail of registration changes, nil means disabled.
+	Audit *AuditOptions
+}
+
+// SchedulerConfig describes a named scheduler to get services from.
+// Type is one of "marathon", "mesos", "docker" or "nomad", URL is the scheduler API endpoint
+// and Params hold type-specific settings, i.e. Mesos frameworks to expose.
+type SchedulerConfig struct {
+	Name   string
+	Type   string
+	URL    string
+	Params url.Values
+}
+
+// RegistryConfig describes a named service registry to sync services to.
+// Type is the registry kind, i.e. "consul", and URL is the registry API endpoint.
+// Retries overrides RegistryRetries of Config for this registry when set.
+type RegistryConfig struct {
+	Name    string
+	Type    string
+	URL     *url.URL
+	Retries *int
+}
+
+// ChaosOptions describes faults injected into adapters to see how bridge copes with slow or flaky
+// registries and schedulers.
+type ChaosOptions struct {
+	// Probability of adapter call failing.
+	ErrorRate float64
+	// Delay of each call, increased by random jitter up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Number of group services registered or deregistered before injected failure.
+	PartialServices int
+	// Probability of scheduler event being dropped.
+	DropRate float64
+	// Seed of random generator, zero seeds it with current time.
+	Seed int64
+}
+
+// AuditOptions describes where audit trail of registration changes is kept.
+type AuditOptions struct {
+	// JSON lines file rotated once it grows over MaxSize bytes, keeping MaxBackups rotated files.
+	File       string
+	MaxSize    int64
+	MaxBackups int
+	// Consul KV prefix to store entries under in addition to file, empty means none.
+	ConsulPrefix string
+}
+
+// ConsulOptions holds Consul connection settings which can not be expressed by the agent URL alone.
+type ConsulOptions struct {
+	Token         string
+	TokenFile     string
+	CAFile        string
+	CertFile      string
+	KeyFile       string
+	TLSSkipVerify bool
+	Datacenter    string
+	Namespace     string
+	Partition     string
 }
@@ -4,6 +4,8 @@
 package types
 
 import (
+	context "context"
+
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -121,3 +123,138 @@ func (_m *MockRegistryAdapter) AdvertiseAddr() (string, error) {
 func (_mr *_MockRegistryAdapterRecorder) AdvertiseAddr() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "AdvertiseAddr")
 }
+
+// Mock of ContextRegistryAdapter interface
+type MockContextRegistryAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockContextRegistryAdapterRecorder
+}
+
+// Recorder for MockContextRegistryAdapter (not exported)
+type _MockContextRegistryAdapterRecorder struct {
+	mock *MockContextRegistryAdapter
+}
+
+func NewMockContextRegistryAdapter(ctrl *gomock.Controller) *MockContextRegistryAdapter {
+	mock := &MockContextRegistryAdapter{ctrl: ctrl}
+	mock.recorder = &_MockContextRegistryAdapterRecorder{mock}
+	return mock
+}
+
+func (_m *MockContextRegistryAdapter) EXPECT() *_MockContextRegistryAdapterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockContextRegistryAdapter) RegisterContext(ctx context.Context, group *ServiceGroup) error {
+	ret := _m.ctrl.Call(_m, "RegisterContext", ctx, group)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockContextRegistryAdapterRecorder) RegisterContext(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RegisterContext", arg0, arg1)
+}
+
+func (_m *MockContextRegistryAdapter) DeregisterContext(ctx context.Context, group *ServiceGroup) error {
+	ret := _m.ctrl.Call(_m, "DeregisterContext", ctx, group)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockContextRegistryAdapterRecorder) DeregisterContext(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeregisterContext", arg0, arg1)
+}
+
+// Mock of ContextServicesLister interface
+type MockContextServicesLister struct {
+	ctrl     *gomock.Controller
+	recorder *_MockContextServicesListerRecorder
+}
+
+// Recorder for MockContextServicesLister (not exported)
+type _MockContextServicesListerRecorder struct {
+	mock *MockContextServicesLister
+}
+
+func NewMockContextServicesLister(ctrl *gomock.Controller) *MockContextServicesLister {
+	mock := &MockContextServicesLister{ctrl: ctrl}
+	mock.recorder = &_MockContextServicesListerRecorder{mock}
+	return mock
+}
+
+func (_m *MockContextServicesLister) EXPECT() *_MockContextServicesListerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockContextServicesLister) ServicesContext(ctx context.Context) ([]*ServiceGroup, error) {
+	ret := _m.ctrl.Call(_m, "ServicesContext", ctx)
+	ret0, _ := ret[0].([]*ServiceGroup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockContextServicesListerRecorder) ServicesContext(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ServicesContext", arg0)
+}
+
+// Mock of RegistryChecksCleaner interface
+type MockRegistryChecksCleaner struct {
+	ctrl     *gomock.Controller
+	recorder *_MockRegistryChecksCleanerRecorder
+}
+
+// Recorder for MockRegistryChecksCleaner (not exported)
+type _MockRegistryChecksCleanerRecorder struct {
+	mock *MockRegistryChecksCleaner
+}
+
+func NewMockRegistryChecksCleaner(ctrl *gomock.Controller) *MockRegistryChecksCleaner {
+	mock := &MockRegistryChecksCleaner{ctrl: ctrl}
+	mock.recorder = &_MockRegistryChecksCleanerRecorder{mock}
+	return mock
+}
+
+func (_m *MockRegistryChecksCleaner) EXPECT() *_MockRegistryChecksCleanerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockRegistryChecksCleaner) CleanupDanglingChecks(ctx context.Context) error {
+	ret := _m.ctrl.Call(_m, "CleanupDanglingChecks", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockRegistryChecksCleanerRecorder) CleanupDanglingChecks(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CleanupDanglingChecks", arg0)
+}
+
+// Mock of SchedulerEndpointReporter interface
+type MockSchedulerEndpointReporter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockSchedulerEndpointReporterRecorder
+}
+
+// Recorder for MockSchedulerEndpointReporter (not exported)
+type _MockSchedulerEndpointReporterRecorder struct {
+	mock *MockSchedulerEndpointReporter
+}
+
+func NewMockSchedulerEndpointReporter(ctrl *gomock.Controller) *MockSchedulerEndpointReporter {
+	mock := &MockSchedulerEndpointReporter{ctrl: ctrl}
+	mock.recorder = &_MockSchedulerEndpointReporterRecorder{mock}
+	return mock
+}
+
+func (_m *MockSchedulerEndpointReporter) EXPECT() *_MockSchedulerEndpointReporterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockSchedulerEndpointReporter) ActiveEndpoint() string {
+	ret := _m.ctrl.Call(_m, "ActiveEndpoint")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+func (_mr *_MockSchedulerEndpointReporterRecorder) ActiveEndpoint() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ActiveEndpoint")
+}
@@ -0,0 +1,258 @@
+package zonefile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/x-cray/marathon-registrator/types"
+)
+
+// Comment prefix of the line holding service definition which can not be expressed by DNS records.
+const definitionComment = "; registrator-service "
+
+var invalidLabelChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// zone is the set of services kept in zone file.
+type zone struct {
+	serial   uint32
+	services map[string]*definition
+}
+
+// definition is the registered service along with its group.
+type definition struct {
+	GroupID string
+	IP      string
+	Service *types.Service
+}
+
+func newZone() *zone {
+	return &zone{services: make(map[string]*definition)}
+}
+
+// groups returns services of the zone, each in its own group, ordered by service ID.
+func (z *zone) groups() []*types.ServiceGroup {
+	var ids []string
+	for id := range z.services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var result []*types.ServiceGroup
+	for _, id := range ids {
+		d := z.services[id]
+		result = append(result, &types.ServiceGroup{
+			ID:       d.GroupID,
+			IP:       d.IP,
+			Services: []*types.Service{d.Service},
+		})
+	}
+	return result
+}
+
+// label converts service name to DNS label, i.e. "web_app" to "web-app".
+func label(name string) (string, error) {
+	result := invalidLabelChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(result) > 63 {
+		result = result[:63]
+	}
+	result = strings.Trim(result, "-")
+	if result == "" {
+		return "", fmt.Errorf("Service name %q can not be converted to DNS label", name)
+	}
+	return result, nil
+}
+
+// instanceLabel returns DNS label of the service instance unique within the service name.
+func instanceLabel(serviceID string) string {
+	hash := sha1.Sum([]byte(serviceID))
+	return hex.EncodeToString(hash[:])[:10]
+}
+
+// render writes zone file with SOA and NS records of origin served by nameserver at advertiseAddr,
+// and address and SRV records of each service, AAAA records being used for IPv6 addresses:
+//
+//	<name>                IN A   <ip>
+//	<instance>.<name>     IN A   <ip>
+//	_<name>._tcp          IN SRV 0 <weight> <port> <instance>.<name>
+func (z *zone) render(w io.Writer, origin, advertiseAddr string, ttl int) error {
+	var buffer bytes.Buffer
+	fmt.Fprintln(&buffer, "; Services registered by registrator. Do not edit, the file is regenerated on every change.")
+	fmt.Fprintf(&buffer, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(&buffer, "$TTL %d\n", ttl)
+	fmt.Fprintf(&buffer, "@\tIN\tSOA\tns hostmaster %d 3600 600 86400 %d\n", z.serial, ttl)
+	fmt.Fprintln(&buffer, "@\tIN\tNS\tns")
+	fmt.Fprintf(&buffer, "ns\tIN\t%s\t%s\n", addressType(advertiseAddr), advertiseAddr)
+
+	names := make(map[string]bool)
+	for _, group := range z.groups() {
+		service := group.Services[0]
+		name, err := label(service.Name)
+		if err != nil {
+			return err
+		}
+
+		definition, err := json.Marshal(z.services[service.ID])
+		if err != nil {
+			return err
+		}
+
+		weight := 1
+		if service.Weights != nil {
+			weight = service.Weights.Passing
+		}
+		instance := instanceLabel(service.ID) + "." + name
+
+		fmt.Fprintln(&buffer)
+		fmt.Fprintf(&buffer, "%s%s\n", definitionComment, definition)
+		if nameRecord := name + "\t" + group.IP; !names[nameRecord] {
+			names[nameRecord] = true
+			fmt.Fprintf(&buffer, "%s\tIN\t%s\t%s\n", name, addressType(group.IP), group.IP)
+		}
+		fmt.Fprintf(&buffer, "%s\tIN\t%s\t%s\n", instance, addressType(group.IP), group.IP)
+		fmt.Fprintf(&buffer, "_%s._tcp\tIN\tSRV\t0 %d %d %s\n", name, weight, service.ExposedPort, instance)
+	}
+
+	_, err := buffer.WriteTo(w)
+	return err
+}
+
+// addressType returns type of the record holding ip, AAAA for IPv6 addresses and A otherwise.
+func addressType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// parseZone reads zone file written by render. Service address and port are taken from A and SRV records,
+// the rest of service definition from the comment preceding them.
+func parseZone(r io.Reader) (*zone, error) {
+	result := newZone()
+	origin := "."
+	addresses := make(map[string]string)
+	ports := make(map[string]int)
+	var definitions []*definition
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.HasPrefix(text, definitionComment) {
+			d := &definition{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(text, definitionComment)), d); err != nil || d.Service == nil {
+				return nil, fmt.Errorf("line %d: invalid service definition", line)
+			}
+			definitions = append(definitions, d)
+			continue
+		}
+
+		if i := strings.Index(text, ";"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "$ORIGIN":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN without domain name", line)
+			}
+			origin = absoluteName(fields[1], origin)
+			continue
+		case "$TTL":
+			continue
+		}
+
+		owner := absoluteName(fields[0], origin)
+		recordType, rdata := recordData(fields[1:])
+		switch recordType {
+		case "SOA":
+			if len(rdata) < 3 {
+				return nil, fmt.Errorf("line %d: malformed SOA record", line)
+			}
+			serial, err := strconv.ParseUint(rdata[2], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid SOA serial: %v", line, err)
+			}
+			result.serial = uint32(serial)
+		case "A", "AAAA":
+			if len(rdata) < 1 {
+				return nil, fmt.Errorf("line %d: malformed %s record", line, recordType)
+			}
+			addresses[owner] = rdata[0]
+		case "SRV":
+			if len(rdata) < 4 {
+				return nil, fmt.Errorf("line %d: malformed SRV record", line)
+			}
+			port, err := strconv.Atoi(rdata[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid SRV port: %v", line, err)
+			}
+			ports[absoluteName(rdata[3], origin)] = port
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range definitions {
+		name, err := label(d.Service.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		instance := absoluteName(instanceLabel(d.Service.ID)+"."+name, origin)
+		ip, hasAddress := addresses[instance]
+		port, hasPort := ports[instance]
+		if !hasAddress || !hasPort {
+			// Records were removed by hand, so the service is no longer resolvable.
+			continue
+		}
+
+		d.IP = ip
+		d.Service.ExposedPort = port
+		result.services[d.Service.ID] = d
+	}
+
+	return result, nil
+}
+
+// recordData skips optional TTL and class of resource record returning its type and data.
+func recordData(fields []string) (string, []string) {
+	for i, field := range fields {
+		if _, err := strconv.Atoi(field); err == nil {
+			continue
+		}
+		if field == "IN" || field == "CH" || field == "HS" {
+			continue
+		}
+		return field, fields[i+1:]
+	}
+	return "", nil
+}
+
+// absoluteName resolves domain name relative to origin.
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	case origin == ".":
+		return name + "."
+	default:
+		return name + "." + origin
+	}
+}
@@ -0,0 +1,355 @@
+// Package zonefile keeps services in RFC 1035 zone file, so that consumers capable of plain DNS only
+// may resolve them through DNS server serving the file, i.e. CoreDNS file plugin, BIND or NSD.
+package zonefile
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultTTL = 30
+
+	// Time to wait for DNS server to acknowledge NOTIFY message.
+	notifyTimeout = 2 * time.Second
+)
+
+// Log messages of zone changes.
+var actionMessages = map[string]string{
+	"register":   "Registering service",
+	"deregister": "Deregistering service",
+}
+
+// Adapter is the implementation of RegistryAdapter keeping services in zone file. Every change rewrites
+// the file atomically with incremented SOA serial and optionally signals DNS server to reload it.
+type Adapter struct {
+	lock          sync.Mutex
+	path          string
+	origin        string
+	ttl           int
+	advertiseAddr string
+	pidFile       string
+	notifyAddr    string
+	dryRun        bool
+	now           func() time.Time
+}
+
+// New creates adapter keeping zone file at uri path, i.e. file:///etc/coredns/marathon.zone. URL parameters are:
+//   - origin: domain name of the zone, i.e. marathon.local (required)
+//   - advertise_addr: address of the node scheduler services are registered from (required)
+//   - ttl: TTL of records in seconds, 30 unless specified
+//   - pid_file: file holding PID of DNS server process to send SIGHUP to once the zone changes
+//   - notify: address of DNS server to send NOTIFY message to once the zone changes, i.e. 127.0.0.1:53
+func New(uri *url.URL, dryRun bool) (*Adapter, error) {
+	params := uri.Query()
+	if uri.Path == "" {
+		return nil, errors.New("Zone file registry requires file path")
+	}
+	if params.Get("origin") == "" {
+		return nil, errors.New("Zone file registry requires origin parameter")
+	}
+	if params.Get("advertise_addr") == "" {
+		return nil, errors.New("Zone file registry requires advertise_addr parameter")
+	}
+
+	ttl := defaultTTL
+	if value := params.Get("ttl"); value != "" {
+		var err error
+		if ttl, err = strconv.Atoi(value); err != nil || ttl < 0 {
+			return nil, fmt.Errorf("Zone file registry has invalid ttl parameter %q", value)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"prefix": "zonefile",
+		"origin": params.Get("origin"),
+	}).Infof("Keeping services in zone file %s", uri.Path)
+
+	return &Adapter{
+		path:          uri.Path,
+		origin:        absoluteName(params.Get("origin"), "."),
+		ttl:           ttl,
+		advertiseAddr: params.Get("advertise_addr"),
+		pidFile:       params.Get("pid_file"),
+		notifyAddr:    params.Get("notify"),
+		dryRun:        dryRun,
+		now:           time.Now,
+	}, nil
+}
+
+// Ping checks that zone file, if it exists, may be parsed and its directory exists.
+func (r *Adapter) Ping() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, err := os.Stat(filepath.Dir(r.path)); err != nil {
+		return err
+	}
+	_, err := r.read()
+	return err
+}
+
+func (r *Adapter) Register(group *types.ServiceGroup) error {
+	return r.RegisterContext(context.Background(), group)
+}
+
+// RegisterContext adds or replaces records of group services.
+func (r *Adapter) RegisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	return r.update(ctx, group, "register", func(z *zone, service *types.Service) bool {
+		z.services[service.ID] = &definition{
+			GroupID: group.ID,
+			IP:      group.IP,
+			Service: service,
+		}
+		return true
+	})
+}
+
+func (r *Adapter) Deregister(group *types.ServiceGroup) error {
+	return r.DeregisterContext(context.Background(), group)
+}
+
+// DeregisterContext removes records of group services.
+func (r *Adapter) DeregisterContext(ctx context.Context, group *types.ServiceGroup) error {
+	return r.update(ctx, group, "deregister", func(z *zone, service *types.Service) bool {
+		if _, ok := z.services[service.ID]; !ok {
+			return false
+		}
+		delete(z.services, service.ID)
+		return true
+	})
+}
+
+// update applies change to each group service and rewrites zone file if any of them changed it.
+func (r *Adapter) update(ctx context.Context, group *types.ServiceGroup, action string, change func(*zone, *types.Service) bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	z, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, service := range group.Services {
+		entry := log.WithFields(log.Fields{
+			"prefix": "zonefile",
+			"ip":     group.IP,
+			"id":     service.ID,
+			"name":   service.Name,
+			"port":   service.ExposedPort,
+		}).WithFields(types.ContextFields(ctx))
+		if r.dryRun {
+			entry.Infof("[dry-run] Would %s service", action)
+			continue
+		}
+		if _, err := label(service.Name); err != nil {
+			return err
+		}
+
+		entry.Info(actionMessages[action])
+		if change(z, service) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := r.write(z); err != nil {
+		return err
+	}
+	r.reload(ctx)
+
+	return nil
+}
+
+// Services parses services back from zone file, each in its own group.
+func (r *Adapter) Services() ([]*types.ServiceGroup, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	z, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	return z.groups(), nil
+}
+
+// AdvertiseAddr returns advertise address registrator instance is configured with, since zone file
+// may be served by DNS server on any node.
+func (r *Adapter) AdvertiseAddr() (string, error) {
+	return r.advertiseAddr, nil
+}
+
+// read parses zone file, missing file is considered an empty zone.
+func (r *Adapter) read() (*zone, error) {
+	file, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return newZone(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	z, err := parseZone(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", r.path, err)
+	}
+	return z, nil
+}
+
+// write replaces zone file with the new version of zone by renaming temporary file over it, so that
+// DNS server never reads partially written zone. SOA serial is the current Unix time, or incremented
+// previous serial if it is not less.
+func (r *Adapter) write(z *zone) error {
+	serial := uint32(r.now().Unix())
+	if serial <= z.serial {
+		serial = z.serial + 1
+	}
+	z.serial = serial
+
+	file, err := ioutil.TempFile(filepath.Dir(r.path), "."+filepath.Base(r.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = z.render(file, r.origin, r.advertiseAddr, r.ttl)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), r.path)
+}
+
+// reload signals DNS server to load the new zone. Failures are logged only since the zone file
+// is already up to date and will be picked up by DNS server eventually.
+func (r *Adapter) reload(ctx context.Context) {
+	if r.pidFile != "" {
+		if err := signalProcess(r.pidFile, syscall.SIGHUP); err != nil {
+			log.WithFields(log.Fields{
+				"prefix": "zonefile",
+				"file":   r.pidFile,
+				"err":    err,
+			}).WithFields(types.ContextFields(ctx)).Warn("Failed to signal DNS server")
+		}
+	}
+
+	if r.notifyAddr != "" {
+		if err := notify(r.notifyAddr, r.origin); err != nil {
+			log.WithFields(log.Fields{
+				"prefix": "zonefile",
+				"addr":   r.notifyAddr,
+				"err":    err,
+			}).WithFields(types.ContextFields(ctx)).Warn("Failed to notify DNS server")
+		}
+	}
+}
+
+// signalProcess sends signal to the process with PID read from pidFile.
+func signalProcess(pidFile string, signal os.Signal) error {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("%s holds invalid PID: %v", pidFile, err)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(signal)
+}
+
+// notify sends DNS NOTIFY message (RFC 1996) about zone origin change to DNS server at addr over UDP
+// and waits for its acknowledgement.
+func notify(addr, origin string) error {
+	message, id, err := notifyMessage(origin)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("udp", addr, notifyTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(notifyTimeout))
+	if _, err := conn.Write(message); err != nil {
+		return err
+	}
+
+	response := make([]byte, 512)
+	n, err := conn.Read(response)
+	if err != nil {
+		return err
+	}
+	if n < 12 || binary.BigEndian.Uint16(response) != id {
+		return errors.New("Malformed NOTIFY response")
+	}
+	if rcode := response[3] & 0x0f; rcode != 0 {
+		return fmt.Errorf("NOTIFY refused with response code %d", rcode)
+	}
+
+	return nil
+}
+
+// notifyMessage encodes NOTIFY message for zone origin returning it along with its ID.
+func notifyMessage(origin string) ([]byte, uint16, error) {
+	const (
+		opcodeNotify = 4
+		flagAA       = 0x0400
+		typeSOA      = 6
+		classIN      = 1
+	)
+
+	id := uint16(rand.Uint32())
+	message := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(message[0:], id)
+	binary.BigEndian.PutUint16(message[2:], opcodeNotify<<11|flagAA)
+	binary.BigEndian.PutUint16(message[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(origin, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("Invalid zone origin %q", origin)
+		}
+		message = append(message, byte(len(label)))
+		message = append(message, label...)
+	}
+	message = append(message, 0, 0, typeSOA, 0, classIN)
+
+	return message, id, nil
+}
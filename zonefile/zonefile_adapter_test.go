@@ -0,0 +1,299 @@
+package zonefile
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/x-cray/marathon-registrator/types"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestZoneFileAdapter(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Zone File Adapter Suite")
+}
+
+var _ = Describe("ZoneFileAdapter", func() {
+	var (
+		dir     string
+		path    string
+		adapter *Adapter
+	)
+
+	newAdapter := func(params string) *Adapter {
+		uri, err := url.Parse("file://" + path + "?origin=marathon.local&advertise_addr=10.10.10.10" + params)
+		Ω(err).ShouldNot(HaveOccurred())
+		result, err := New(uri, false)
+		Ω(err).ShouldNot(HaveOccurred())
+		result.now = func() time.Time { return time.Unix(1456826400, 0) }
+		return result
+	}
+
+	webGroup := func() *types.ServiceGroup {
+		return &types.ServiceGroup{
+			ID: "web_app.2c033893-7993-11e5-8878-56847afe9799",
+			IP: "10.10.10.10",
+			Services: []*types.Service{
+				{
+					ID:           "web_app.2c033893-7993-11e5-8878-56847afe9799:31045",
+					Name:         "web_app",
+					Tags:         []string{"primary"},
+					Meta:         map[string]string{types.SourceMetaKey: "marathon"},
+					Weights:      &types.ServiceWeights{Passing: 10, Warning: 1},
+					HealthChecks: []*types.ServiceHealthCheck{{ID: "tcp", TCP: "10.10.10.10:31045", Interval: "10s"}},
+					Healthy:      true,
+					OriginalPort: 8080,
+					ExposedPort:  31045,
+				},
+			},
+		}
+	}
+
+	zoneFile := func() string {
+		data, err := ioutil.ReadFile(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "zonefile")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "marathon.zone")
+		adapter = newAdapter("")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("New()", func() {
+		It("Should require zone origin", func() {
+			// Arrange.
+			uri, _ := url.Parse("file:///etc/coredns/marathon.zone?advertise_addr=10.10.10.10")
+
+			// Act.
+			_, err := New(uri, false)
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("origin")))
+		})
+	})
+
+	Describe("Register()", func() {
+		It("Should write A and SRV records of services", func() {
+			// Act.
+			err := adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			zone := zoneFile()
+			Ω(zone).Should(ContainSubstring("$ORIGIN marathon.local.\n"))
+			Ω(zone).Should(ContainSubstring("@\tIN\tSOA\tns hostmaster 1456826400 3600 600 86400 30\n"))
+			Ω(zone).Should(ContainSubstring("web-app\tIN\tA\t10.10.10.10\n"))
+			instance := instanceLabel("web_app.2c033893-7993-11e5-8878-56847afe9799:31045") + ".web-app"
+			Ω(zone).Should(ContainSubstring(instance + "\tIN\tA\t10.10.10.10\n"))
+			Ω(zone).Should(ContainSubstring("_web-app._tcp\tIN\tSRV\t0 10 31045 " + instance + "\n"))
+		})
+
+		It("Should write AAAA records of services with IPv6 addresses", func() {
+			// Arrange.
+			group := webGroup()
+			group.IP = "fd00::10"
+
+			// Act.
+			err := adapter.Register(group)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			zone := zoneFile()
+			Ω(zone).Should(ContainSubstring("ns\tIN\tA\t10.10.10.10\n"))
+			Ω(zone).Should(ContainSubstring("web-app\tIN\tAAAA\tfd00::10\n"))
+			instance := instanceLabel("web_app.2c033893-7993-11e5-8878-56847afe9799:31045") + ".web-app"
+			Ω(zone).Should(ContainSubstring(instance + "\tIN\tAAAA\tfd00::10\n"))
+			groups, err := adapter.Services()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(Equal([]*types.ServiceGroup{group}))
+		})
+
+		It("Should bump SOA serial on every change", func() {
+			// Arrange.
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+			group := webGroup()
+			group.Services[0].ExposedPort = 31046
+
+			// Act.
+			err := adapter.Register(group)
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			zone := zoneFile()
+			Ω(zone).Should(ContainSubstring(" hostmaster 1456826401 "))
+			Ω(zone).ShouldNot(ContainSubstring(" 31045 "))
+		})
+
+		It("Should not leave temporary files behind", func() {
+			// Act.
+			err := adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			files, err := ioutil.ReadDir(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(files).Should(HaveLen(1))
+		})
+
+		It("Should signal DNS server process", func() {
+			// Arrange.
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGHUP)
+			defer signal.Stop(signals)
+			pidFile := filepath.Join(dir, "coredns.pid")
+			Ω(ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)).Should(Succeed())
+			adapter = newAdapter("&pid_file=" + pidFile)
+
+			// Act.
+			err := adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(signals).Should(Receive(Equal(syscall.SIGHUP)))
+		})
+
+		It("Should notify DNS server about zone change", func() {
+			// Arrange.
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer conn.Close()
+			messages := make(chan []byte, 1)
+			go func() {
+				buffer := make([]byte, 512)
+				n, addr, err := conn.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				// Acknowledge with the same header turned into response.
+				response := append([]byte(nil), buffer[:n]...)
+				response[2] |= 0x80
+				conn.WriteTo(response, addr)
+				messages <- buffer[:n]
+			}()
+			adapter = newAdapter("&notify=" + conn.LocalAddr().String())
+
+			// Act.
+			err = adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			var message []byte
+			Eventually(messages).Should(Receive(&message))
+			Ω(binary.BigEndian.Uint16(message[2:]) >> 11 & 0x0f).Should(Equal(uint16(4)))
+			Ω(message[12:]).Should(Equal([]byte("\x08marathon\x05local\x00\x00\x06\x00\x01")))
+		})
+	})
+
+	Describe("Deregister()", func() {
+		It("Should remove records of services", func() {
+			// Arrange.
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+
+			// Act.
+			err := adapter.Deregister(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			zone := zoneFile()
+			Ω(zone).ShouldNot(ContainSubstring("web-app"))
+			Ω(zone).Should(ContainSubstring(" hostmaster 1456826401 "))
+		})
+
+		It("Should leave zone intact when services are absent", func() {
+			// Act.
+			err := adapter.Deregister(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(path).ShouldNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("Services()", func() {
+		It("Should parse services back from zone file", func() {
+			// Arrange.
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+
+			// Act.
+			groups, err := newAdapter("").Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(Equal([]*types.ServiceGroup{webGroup()}))
+		})
+
+		It("Should take address and port from records edited by hand", func() {
+			// Arrange.
+			Ω(adapter.Register(webGroup())).Should(Succeed())
+			instance := instanceLabel("web_app.2c033893-7993-11e5-8878-56847afe9799:31045") + ".web-app"
+			zone := strings.Replace(zoneFile(), instance+"\tIN\tA\t10.10.10.10", instance+".marathon.local. 60 IN A 10.10.10.20", 1)
+			zone = strings.Replace(zone, "0 10 31045", "0 10 31050", 1)
+			Ω(ioutil.WriteFile(path, []byte(zone), 0644)).Should(Succeed())
+
+			// Act.
+			groups, err := adapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(HaveLen(1))
+			Ω(groups[0].IP).Should(Equal("10.10.10.20"))
+			Ω(groups[0].Services[0].ExposedPort).Should(Equal(31050))
+		})
+
+		It("Should return no services without zone file", func() {
+			// Act.
+			groups, err := adapter.Services()
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(groups).Should(BeEmpty())
+		})
+
+		It("Should report malformed zone file", func() {
+			// Arrange.
+			Ω(ioutil.WriteFile(path, []byte("$ORIGIN marathon.local.\n@ IN SOA ns hostmaster serial\n"), 0644)).Should(Succeed())
+
+			// Act.
+			_, err := adapter.Services()
+
+			// Assert.
+			Ω(err).Should(MatchError(ContainSubstring("line 2")))
+		})
+	})
+
+	Describe("Dry run", func() {
+		It("Should not write zone file", func() {
+			// Arrange.
+			adapter.dryRun = true
+
+			// Act.
+			err := adapter.Register(webGroup())
+
+			// Assert.
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(path).ShouldNot(BeAnExistingFile())
+		})
+	})
+})